@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/portainer/kubesolo/internal/core/audit"
+)
+
+// auditVerify checks the hash chain of the audit log and its rotated logs, then the last line against the sealed head
+// it fails on the first line that was edited, removed or reordered
+func (s *kubesolo) auditVerify() error {
+	path := s.apiserverConfig.AuditLogPath
+	if path == "" {
+		path = s.embedded.AuditLogFile
+	}
+	if path == "none" || path == "-" {
+		return fmt.Errorf("the audit log is not written to a file on this node")
+	}
+
+	result, err := audit.Verify(path, s.embedded.AuditSealKeyFile)
+	if result != nil {
+		for _, file := range result.Files {
+			fmt.Printf("Checked:    %s\n", file)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("audit log verification failed: %v", err)
+	}
+
+	if result.Records == 0 {
+		fmt.Println("Lines:      none")
+	} else {
+		fmt.Printf("Lines:      %d to %d\n", result.FirstSeq, result.LastSeq)
+	}
+	if result.FirstSeq > 1 {
+		fmt.Printf("Pruned:     lines before %d are no longer kept\n", result.FirstSeq)
+	}
+	fmt.Println("Status:     intact")
+	return nil
+}
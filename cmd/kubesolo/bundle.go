@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/portainer/kubesolo/internal/config/flags"
+	"github.com/portainer/kubesolo/internal/core/bundle"
+	kubesolokubernetes "github.com/portainer/kubesolo/internal/kubernetes"
+	"github.com/portainer/kubesolo/types"
+	"github.com/rs/zerolog/log"
+)
+
+// exportBundle writes the user-created objects of the cluster to the output file or stdout
+// the file is only readable by its owner because the bundle contains secrets
+func (s *kubesolo) exportBundle() error {
+	clientset, err := kubesolokubernetes.GetKubernetesClient(s.embedded.AdminKubeconfigFile)
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes client: %v", err)
+	}
+
+	dynamicClient, err := kubesolokubernetes.GetDynamicClient(s.embedded.AdminKubeconfigFile)
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stdout
+	if *flags.ExportOutput != "-" {
+		file, err := os.OpenFile(*flags.ExportOutput, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to create bundle file: %v", err)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), types.DefaultCommandTimeout)
+	defer cancel()
+
+	count, err := bundle.Export(ctx, clientset.Discovery(), dynamicClient, out)
+	if err != nil {
+		return err
+	}
+
+	log.Info().Str("component", "kubesolo").Msgf("exported %d objects", count)
+	return nil
+}
+
+// importBundle applies a bundle written by export to the cluster
+func (s *kubesolo) importBundle() error {
+	clientset, err := kubesolokubernetes.GetKubernetesClient(s.embedded.AdminKubeconfigFile)
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes client: %v", err)
+	}
+
+	dynamicClient, err := kubesolokubernetes.GetDynamicClient(s.embedded.AdminKubeconfigFile)
+	if err != nil {
+		return err
+	}
+
+	var in io.Reader = os.Stdin
+	if *flags.ImportFile != "-" {
+		file, err := os.Open(*flags.ImportFile)
+		if err != nil {
+			return fmt.Errorf("failed to open bundle file: %v", err)
+		}
+		defer file.Close()
+		in = file
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), types.DefaultCommandTimeout)
+	defer cancel()
+
+	count, err := bundle.Import(ctx, clientset.Discovery(), dynamicClient, in)
+	log.Info().Str("component", "kubesolo").Msgf("imported %d objects", count)
+	return err
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/portainer/kubesolo/internal/config/flags"
+	"github.com/portainer/kubesolo/internal/core/kubeconfig"
+	"github.com/portainer/kubesolo/internal/core/pki"
+	"github.com/portainer/kubesolo/internal/system"
+	"github.com/portainer/kubesolo/pkg/kubernetes/apiserver"
+	"github.com/rs/zerolog/log"
+)
+
+// certsCheck prints every certificate under the pki directory with its subject, SANs, issuer and expiry
+func (s *kubesolo) certsCheck() error {
+	certs, err := pki.ListCertificates(s.embedded.PKIDir)
+	if err != nil {
+		return err
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "FILE\tSUBJECT\tISSUER\tSANS\tEXPIRES\tSTATUS")
+	for _, cert := range certs {
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			strings.TrimPrefix(cert.File, s.embedded.PKIDir+string(os.PathSeparator)),
+			cert.Subject,
+			cert.Issuer,
+			strings.Join(cert.SANs, ","),
+			cert.NotAfter.Format(time.RFC3339),
+			certificateStatus(cert.NotAfter, s.pkiConfig.RenewBeforeDays),
+		)
+	}
+	return writer.Flush()
+}
+
+// certificateStatus describes the expiry of a certificate relative to the renewal window
+func certificateStatus(notAfter time.Time, renewBeforeDays int) string {
+	remaining := time.Until(notAfter)
+	switch {
+	case remaining <= 0:
+		return "expired"
+	case remaining < time.Duration(renewBeforeDays)*24*time.Hour:
+		return fmt.Sprintf("expiring in %dd", int(remaining.Hours()/24))
+	default:
+		return "valid"
+	}
+}
+
+// certsRotate reissues the named leaf certificates, or all of them, with the current CA
+// the running components reload the new certificates from disk
+func (s *kubesolo) certsRotate() error {
+	certTypes := []pki.CertificateType{}
+	for _, name := range *flags.CertsRotateNames {
+		certType, err := pki.ParseCertificateType(name)
+		if err != nil {
+			return err
+		}
+		certTypes = append(certTypes, certType)
+	}
+
+	rotated, err := pki.RotateCertificates(s.embedded, s.pkiConfig, certTypes)
+	if err != nil {
+		return err
+	}
+
+	if slices.Contains(rotated, pki.AdminCert) {
+		if err := kubeconfig.GenerateAdminKubeconfig(s.embedded); err != nil {
+			return fmt.Errorf("failed to regenerate admin kubeconfig: %v", err)
+		}
+		log.Info().Str("component", "kubesolo").Msgf("admin kubeconfig regenerated at %s", s.embedded.AdminKubeconfigFile)
+	}
+	return nil
+}
+
+// certsRotateCA issues a new CA, reissues every leaf certificate and regenerates the kubeconfigs
+// the API server reloads its client CA bundle and serving certificate from disk, so it trusts client certificates of
+// both CAs and serves the new certificate without a restart, the in-process clients of the API server only read the
+// CA bundle when they start though, so kubesolo is restarted for them to trust the certificate issued by the new CA
+func (s *kubesolo) certsRotateCA() error {
+	if err := pki.RotateCA(s.embedded, s.pkiConfig); err != nil {
+		return err
+	}
+
+	if err := kubeconfig.GenerateAdminKubeconfig(s.embedded); err != nil {
+		return fmt.Errorf("failed to regenerate admin kubeconfig: %v", err)
+	}
+	if err := kubeconfig.GenerateKubeletKubeconfig(s.embedded, system.GetHostname()); err != nil {
+		return fmt.Errorf("failed to regenerate kubelet kubeconfig: %v", err)
+	}
+	s.updateWebhookCABundle()
+
+	log.Info().Str("component", "kubesolo").Msgf("CA rotated, the API server picks it up without a restart; restart kubesolo so its own components trust the new API server certificate, and copy the new admin kubeconfig from %s to your clients", s.embedded.AdminKubeconfigFile)
+	return nil
+}
+
+// certsRotateSAKey generates a new service account signing key
+// the API server only loads its service account keys at startup, so kubesolo must be restarted afterwards
+func (s *kubesolo) certsRotateSAKey() error {
+	if err := pki.RotateServiceAccountKey(s.embedded, s.pkiConfig); err != nil {
+		return err
+	}
+
+	log.Info().Str("component", "kubesolo").Msg("service account signing key rotated, restart kubesolo to sign new tokens with it")
+	return nil
+}
+
+// updateWebhookCABundle sets the CA bundle of the webhook configurations and the metrics APIService to the current CA bundle
+// it only warns when the API server is not reachable, they are updated again when kubesolo starts
+func (s *kubesolo) updateWebhookCABundle() {
+	if err := apiserver.UpdateCABundles(s.embedded.AdminKubeconfigFile, s.embedded.CACerts.Bundle); err != nil {
+		log.Warn().Str("component", "kubesolo").Msgf("CA bundle not updated, it is refreshed when kubesolo starts: %v", err)
+	}
+}
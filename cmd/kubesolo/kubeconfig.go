@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/portainer/kubesolo/internal/config/flags"
+	"github.com/portainer/kubesolo/internal/core/kubeconfig"
+	"github.com/portainer/kubesolo/internal/core/pki"
+	kubesolokubernetes "github.com/portainer/kubesolo/internal/kubernetes"
+	"github.com/portainer/kubesolo/internal/runtime/network"
+	"github.com/portainer/kubesolo/types"
+	"github.com/rs/zerolog/log"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+)
+
+// kubeconfigCreate signs a client certificate for the user with the cluster CA and writes a kubeconfig using it
+// the certificate cannot be revoked, access is removed by deleting the role binding or waiting for it to expire
+func (s *kubesolo) kubeconfigCreate() error {
+	user := *flags.KubeconfigUser
+	if user == "" || strings.HasPrefix(user, "system:") {
+		return fmt.Errorf("invalid user name %q", user)
+	}
+	// system: groups such as system:masters grant privileges that bypass RBAC and cannot be revoked with the certificate
+	for _, group := range *flags.KubeconfigGroups {
+		if group == "" || strings.HasPrefix(group, "system:") {
+			return fmt.Errorf("invalid group name %q", group)
+		}
+	}
+
+	// the role binding name is checked before the certificate is issued so a rejected binding leaves nothing behind
+	bindingName := fmt.Sprintf("kubesolo-user-%s-%s", user, *flags.KubeconfigRole)
+	if *flags.KubeconfigRole != "" {
+		if errs := validation.IsDNS1123Subdomain(bindingName); len(errs) > 0 {
+			return fmt.Errorf("invalid role binding name %q for user %q and role %q: %v", bindingName, user, *flags.KubeconfigRole, errs)
+		}
+	}
+
+	server, err := serverURL(*flags.KubeconfigServer)
+	if err != nil {
+		return err
+	}
+
+	certPEM, keyPEM, err := pki.IssueClientCertificate(s.embedded, s.pkiConfig.KeyAlgorithm, user, *flags.KubeconfigGroups, *flags.KubeconfigTTL)
+	if err != nil {
+		return err
+	}
+
+	data, err := kubeconfig.BuildUserKubeconfig(s.embedded, server, user, certPEM, keyPEM)
+	if err != nil {
+		return err
+	}
+
+	if *flags.KubeconfigRole != "" {
+		clientset, err := kubesolokubernetes.GetKubernetesClient(s.embedded.AdminKubeconfigFile)
+		if err != nil {
+			return fmt.Errorf("failed to create kubernetes client: %v", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), types.DefaultCommandTimeout)
+		defer cancel()
+
+		subject := rbacv1.Subject{Kind: rbacv1.UserKind, APIGroup: rbacv1.GroupName, Name: user}
+		if err := bindClusterRole(ctx, clientset, bindingName, subject, *flags.KubeconfigRole, *flags.KubeconfigNamespace, nil); err != nil {
+			return err
+		}
+	}
+
+	if err := writeKubeconfigOutput(*flags.KubeconfigOutput, data); err != nil {
+		return err
+	}
+	log.Info().Str("component", "kubesolo").Msgf("kubeconfig for %s is valid for %s", user, *flags.KubeconfigTTL)
+	return nil
+}
+
+// kubeconfigOIDC writes a kubeconfig that signs users in with the OIDC provider the API server accepts
+// it holds no credentials, so the same kubeconfig can be handed to every engineer
+func (s *kubesolo) kubeconfigOIDC() error {
+	oidc := s.apiserverConfig.OIDC
+	if oidc.IssuerURL == "" {
+		return fmt.Errorf("OIDC is not configured, set --oidc-issuer-url and --oidc-client-id")
+	}
+	if err := oidc.Validate(); err != nil {
+		return err
+	}
+
+	server, err := serverURL(*flags.KubeconfigOIDCServer)
+	if err != nil {
+		return err
+	}
+
+	var issuerCA []byte
+	if oidc.CAFile != "" {
+		issuerCA, err = os.ReadFile(oidc.CAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read OIDC CA file: %v", err)
+		}
+	}
+
+	data, err := kubeconfig.BuildOIDCKubeconfig(s.embedded, server, oidc.IssuerURL, oidc.ClientID, *flags.KubeconfigOIDCSecret, *flags.KubeconfigOIDCScopes, issuerCA)
+	if err != nil {
+		return err
+	}
+	return writeKubeconfigOutput(*flags.KubeconfigOIDCOutput, data)
+}
+
+// writeKubeconfigOutput writes the kubeconfig to stdout when the output is -, or to the file readable only by its owner
+func writeKubeconfigOutput(output string, data []byte) error {
+	if output == "-" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	if err := os.WriteFile(output, data, 0600); err != nil {
+		return fmt.Errorf("failed to write kubeconfig: %v", err)
+	}
+	log.Info().Str("component", "kubesolo").Msgf("kubeconfig written to %s", output)
+	return nil
+}
+
+// serverURL returns the API server URL written to kubeconfigs for remote clients
+// it defaults to the node address, which is one of the API server certificate SANs
+func serverURL(server string) (string, error) {
+	if server != "" {
+		return server, nil
+	}
+
+	nodeIP, err := network.GetNodeIP()
+	if err != nil {
+		return "", fmt.Errorf("failed to get node IP address, set --server: %v", err)
+	}
+	return fmt.Sprintf("https://%s:%d", nodeIP, types.DefaultAPIServerPort), nil
+}
+
+// bindClusterRole binds the cluster role to the subject, in the namespace when it is set and cluster wide otherwise
+// an existing binding with the same name is left as it is
+func bindClusterRole(ctx context.Context, clientset *kubernetes.Clientset, name string, subject rbacv1.Subject, role, namespace string, labels map[string]string) error {
+	subjects := []rbacv1.Subject{subject}
+	roleRef := rbacv1.RoleRef{
+		APIGroup: rbacv1.GroupName,
+		Kind:     "ClusterRole",
+		Name:     role,
+	}
+
+	var err error
+	if namespace != "" {
+		_, err = clientset.RbacV1().RoleBindings(namespace).Create(ctx, &rbacv1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: labels},
+			Subjects:   subjects,
+			RoleRef:    roleRef,
+		}, metav1.CreateOptions{})
+	} else {
+		_, err = clientset.RbacV1().ClusterRoleBindings().Create(ctx, &rbacv1.ClusterRoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+			Subjects:   subjects,
+			RoleRef:    roleRef,
+		}, metav1.CreateOptions{})
+	}
+	if apierrors.IsAlreadyExists(err) {
+		log.Info().Str("component", "kubesolo").Msgf("role binding %s already exists", name)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to bind cluster role %s to %s: %v", role, subject.Name, err)
+	}
+
+	log.Info().Str("component", "kubesolo").Msgf("cluster role %s bound to %s with %s", role, subject.Name, name)
+	return nil
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"net"
 	"os"
 	"os/signal"
 	"path/filepath"
@@ -11,8 +12,11 @@ import (
 	"github.com/alecthomas/kingpin/v2"
 	"github.com/portainer/kubesolo/internal/config/flags"
 	"github.com/portainer/kubesolo/internal/core/embedded"
+	"github.com/portainer/kubesolo/internal/core/encryption"
+	"github.com/portainer/kubesolo/internal/core/featuregates"
 	"github.com/portainer/kubesolo/internal/core/pki"
 	"github.com/portainer/kubesolo/internal/logging"
+	"github.com/portainer/kubesolo/internal/runtime/network"
 	"github.com/portainer/kubesolo/internal/system"
 	"github.com/portainer/kubesolo/pkg/components/coredns"
 	"github.com/portainer/kubesolo/pkg/components/localpath"
@@ -22,6 +26,7 @@ import (
 	"github.com/portainer/kubesolo/pkg/kubernetes/controller"
 	"github.com/portainer/kubesolo/pkg/kubernetes/kubelet"
 	"github.com/portainer/kubesolo/pkg/kubernetes/kubeproxy"
+	"github.com/portainer/kubesolo/pkg/kubernetes/scheduler"
 	"github.com/portainer/kubesolo/pkg/runtime/containerd"
 	"github.com/portainer/kubesolo/types"
 	"github.com/rs/zerolog/log"
@@ -36,6 +41,10 @@ type kubesolo struct {
 	portainerEdgeKey   string
 	portainerEdgeAsync bool
 	localStorage       bool
+	dbRecoveryPolicy   string
+	encryptionProvider string
+	pkiConfig          pki.Config
+	apiserverConfig    apiserver.Config
 	embedded           types.Embedded
 }
 
@@ -47,10 +56,35 @@ var (
 	kubeletReadyCh    = make(chan struct{})
 	controllerReadyCh = make(chan struct{})
 	kubeproxyReadyCh  = make(chan struct{})
+	schedulerReadyCh  = make(chan struct{})
 )
 
 // service creates a new kubesolo application
 func service() (*kubesolo, error) {
+	admissionPlugins, err := apiserver.ParseAdmissionPlugins(*flags.AdmissionPlugins)
+	if err != nil {
+		return nil, err
+	}
+
+	featureGates, err := featuregates.Parse(*flags.FeatureGates)
+	if err != nil {
+		return nil, err
+	}
+
+	runtimeConfig, err := featuregates.ParseRuntimeConfig(*flags.RuntimeConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	oidcConfig := apiserver.OIDCConfig{
+		IssuerURL:      *flags.OIDCIssuerURL,
+		ClientID:       *flags.OIDCClientID,
+		UsernameClaim:  *flags.OIDCUsernameClaim,
+		UsernamePrefix: *flags.OIDCUsernamePrefix,
+		GroupsClaim:    *flags.OIDCGroupsClaim,
+		GroupsPrefix:   *flags.OIDCGroupsPrefix,
+		CAFile:         *flags.OIDCCAFile,
+	}
 	return &kubesolo{
 		hostName:           system.GetHostname(),
 		debug:              *flags.Debug,
@@ -59,28 +93,125 @@ func service() (*kubesolo, error) {
 		portainerEdgeKey:   *flags.PortainerEdgeKey,
 		portainerEdgeAsync: *flags.PortainerEdgeAsync,
 		localStorage:       *flags.LocalStorage,
+		dbRecoveryPolicy:   *flags.DBRecoveryPolicy,
+		encryptionProvider: *flags.EncryptionProvider,
+		pkiConfig: pki.Config{
+			RenewBeforeDays: *flags.CertRenewalDays,
+			KeyAlgorithm:    pki.KeyAlgorithm(*flags.KeyAlgorithm),
+			ExternalCA: pki.ExternalCA{
+				CertFile: *flags.CACert,
+				KeyFile:  *flags.CAKey,
+			},
+			ServiceAccountKeyRotationDays: *flags.SAKeyRotationDays,
+		},
+		apiserverConfig: apiserver.Config{
+			AuditLogPath:        *flags.AuditLogPath,
+			AuditPolicyFile:     *flags.AuditPolicyFile,
+			AuditLogMaxSize:     *flags.AuditLogMaxSize,
+			AuditLogMaxBackup:   *flags.AuditLogMaxBackup,
+			AuditLogMaxAge:      *flags.AuditLogMaxAge,
+			AdmissionPlugins:    admissionPlugins,
+			AdmissionConfigFile: *flags.AdmissionConfig,
+			PodSecurityEnforce:  *flags.PodSecurityEnforce,
+			PodSecurityAudit:    *flags.PodSecurityAudit,
+			PodSecurityWarn:     *flags.PodSecurityWarn,
+			OIDC:                oidcConfig,
+			MetricsAPI:          *flags.MetricsAPI,
+			FeatureGates:        featureGates,
+			RuntimeConfig:       runtimeConfig,
+			HostAliasesFile:     *flags.HostAliasesFile,
+			MutationRulesFile:   *flags.MutationRulesFile,
+			Scheduler:           *flags.Scheduler,
+		},
 	}, nil
 }
 
 // main is the entry point for the kubesolo application
 // it parses the command line arguments and creates a new kubesolo application
-// it then bootstraps the application and runs it
+// management commands such as secrets-encrypt, export, import, certs, kubeconfig, token and audit run once and exit
+// otherwise it bootstraps the application and runs it
 // it also handles the shutdown of the application by listening for interrupt signals
 // and shutting down the application gracefully
 func main() {
-	kingpin.MustParse(flags.Application.Parse(os.Args[1:]))
+	command := kingpin.MustParse(flags.Application.Parse(os.Args[1:]))
 
 	service, err := service()
 	if err != nil {
 		log.Fatal().Err(err).Msg("failed to create service. check the logs for more information. exiting...")
 	}
 
-	service.bootstrap()
-	service.run()
+	switch command {
+	case flags.SecretsEncryptStatus.FullCommand():
+		service.runCommand(service.secretsEncryptStatus)
+	case flags.SecretsEncryptRotate.FullCommand():
+		service.runCommand(service.secretsEncryptRotate)
+	case flags.SecretsEncryptReencrypt.FullCommand():
+		service.runCommand(service.secretsEncryptReencrypt)
+	case flags.Export.FullCommand():
+		service.runCommand(service.exportBundle)
+	case flags.Import.FullCommand():
+		service.runCommand(service.importBundle)
+	case flags.CertsCheck.FullCommand():
+		service.runCommand(service.certsCheck)
+	case flags.CertsRotate.FullCommand():
+		service.runCommand(service.certsRotate)
+	case flags.CertsRotateCA.FullCommand():
+		service.runCommand(service.certsRotateCA)
+	case flags.CertsRotateSAKey.FullCommand():
+		service.runCommand(service.certsRotateSAKey)
+	case flags.KubeconfigCreate.FullCommand():
+		service.runCommand(service.kubeconfigCreate)
+	case flags.KubeconfigOIDC.FullCommand():
+		service.runCommand(service.kubeconfigOIDC)
+	case flags.TokenCreate.FullCommand():
+		service.runCommand(service.tokenCreate)
+	case flags.TokenList.FullCommand():
+		service.runCommand(service.tokenList)
+	case flags.TokenRevoke.FullCommand():
+		service.runCommand(service.tokenRevoke)
+	case flags.AuditVerify.FullCommand():
+		service.runCommand(service.auditVerify)
+	default:
+		if err := service.validate(); err != nil {
+			log.Fatal().Err(err).Msg("invalid configuration. exiting...")
+		}
+		service.bootstrap()
+		service.run()
+	}
+}
+
+// validate checks the files and settings only the node uses before it starts
+// management commands skip it, so a broken host aliases file, mutation rules file or OIDC setting
+// does not prevent the commands needed to repair the node
+func (s *kubesolo) validate() error {
+	if err := apiserver.LoadHostAliases(s.apiserverConfig.HostAliasesFile); err != nil {
+		return err
+	}
+	if err := apiserver.LoadMutationRules(s.apiserverConfig.MutationRulesFile); err != nil {
+		return err
+	}
+	return s.apiserverConfig.OIDC.Validate()
+}
+
+// runCommand runs a management command with logging and paths configured
+// it exits with a non-zero status if the command fails
+func (s *kubesolo) runCommand(command func() error) {
+	logging.ConfigureLogger()
+	logging.SetLoggingMode("PRETTY")
+	logging.SetLoggingLevel("INFO")
+	if s.debug {
+		logging.SetLoggingLevel("DEBUG")
+	}
+	s.setupPaths()
+
+	if err := command(); err != nil {
+		log.Fatal().Err(err).Msg("command failed")
+	}
 }
 
 // run is the main function for the kubesolo application
 // the list of services; containerd, kine, apiserver, controller, kubelet, kubeproxy is started in the order of dependency
+// followed by the scheduler when it is enabled
 // coredns and portainer edge agent (only when the portainer edge id and key are provided) are deployed last
 func (s *kubesolo) run() {
 	ctx, cancel := context.WithCancel(context.Background())
@@ -100,11 +231,22 @@ func (s *kubesolo) run() {
 	}
 
 	log.Info().Str("component", "kubesolo").Msg("generating relevant certificates...")
-	if err := pki.GenerateAllCertificates(s.embedded); err != nil {
+	if err := pki.GenerateAllCertificates(s.embedded, s.pkiConfig); err != nil {
 		log.Fatal().Err(err).Msg("failed to generate full certificates")
 	}
+
+	log.Info().Str("component", "kubesolo").Msg("ensuring service account signing keys...")
+	if err := pki.EnsureServiceAccountKeys(s.embedded, s.pkiConfig); err != nil {
+		log.Fatal().Err(err).Msg("failed to ensure service account signing keys")
+	}
+
+	log.Info().Str("component", "kubesolo").Msg("ensuring secrets encryption configuration...")
+	if err := encryption.EnsureEncryptionConfig(s.embedded.EncryptionConfigFile, s.encryptionProvider); err != nil {
+		log.Fatal().Err(err).Msg("failed to generate secrets encryption configuration")
+	}
 	log.Info().Str("component", "kubesolo").Msg("starting kubesolo services... this may take a few minutes...")
 
+	apiserverService := apiserver.NewService(ctx, cancel, apiServerReadyCh, s.hostName, s.embedded, s.apiserverConfig)
 	services := []struct {
 		name    string
 		start   func()
@@ -121,7 +263,7 @@ func (s *kubesolo) run() {
 		{
 			name: "kine",
 			start: func() {
-				kineService := kine.NewService(ctx, cancel, s.embedded.KineDir, kineReadyCh)
+				kineService := kine.NewService(ctx, cancel, s.embedded.KineDir, kine.RecoveryPolicy(s.dbRecoveryPolicy), kineReadyCh)
 				go kineService.Run()
 			},
 			readyCh: kineReadyCh,
@@ -129,7 +271,6 @@ func (s *kubesolo) run() {
 		{
 			name: "apiserver",
 			start: func() {
-				apiserverService := apiserver.NewService(ctx, cancel, apiServerReadyCh, s.hostName, s.embedded)
 				go apiserverService.Run(kineReadyCh)
 			},
 			readyCh: apiServerReadyCh,
@@ -137,7 +278,7 @@ func (s *kubesolo) run() {
 		{
 			name: "controller",
 			start: func() {
-				controllerService := controller.NewService(ctx, cancel, controllerReadyCh, s.embedded.ControllerDir, s.embedded)
+				controllerService := controller.NewService(ctx, cancel, controllerReadyCh, s.embedded.ControllerDir, s.embedded, s.apiserverConfig.AdmissionPlugins, s.apiserverConfig.FeatureGates, s.apiserverConfig.MetricsAPI)
 				go controllerService.Run(apiServerReadyCh)
 			},
 			readyCh: controllerReadyCh,
@@ -145,7 +286,7 @@ func (s *kubesolo) run() {
 		{
 			name: "kubelet",
 			start: func() {
-				kubeletService := kubelet.NewService(ctx, cancel, kubeletReadyCh, &s.embedded)
+				kubeletService := kubelet.NewService(ctx, cancel, kubeletReadyCh, &s.embedded, s.apiserverConfig.FeatureGates)
 				go kubeletService.Run(apiServerReadyCh)
 			},
 			readyCh: kubeletReadyCh,
@@ -153,7 +294,7 @@ func (s *kubesolo) run() {
 		{
 			name: "kubeproxy",
 			start: func() {
-				kubeproxyService := kubeproxy.NewService(ctx, cancel, kubeproxyReadyCh, s.embedded.AdminKubeconfigFile)
+				kubeproxyService := kubeproxy.NewService(ctx, cancel, kubeproxyReadyCh, s.embedded.ComponentKubeconfigFile, s.apiserverConfig.FeatureGates)
 				go kubeproxyService.Run(kubeletReadyCh)
 			},
 			readyCh: kubeproxyReadyCh,
@@ -168,6 +309,37 @@ func (s *kubesolo) run() {
 		}
 	}
 
+	if s.apiserverConfig.Scheduler {
+		log.Info().Str("component", "kubesolo").Msg("starting scheduler...")
+		schedulerService := scheduler.NewService(ctx, cancel, schedulerReadyCh, s.hostName, s.embedded.AdminKubeconfigFile)
+		go schedulerService.Run(apiServerReadyCh)
+		if !waitForService(ctx, "scheduler", schedulerReadyCh) {
+			return
+		}
+	}
+
+	go pki.RunRenewal(ctx, s.embedded, s.pkiConfig, types.DefaultCertRenewalInterval, apiserverService.CertificatesRenewed)
+	go network.WatchAddresses(ctx, types.DefaultAddressChangeDebounce, func(_, current []net.IP) {
+		// the certificates issued by kubesolo, including the static kubelet serving certificate, are reissued for the new addresses
+		// the kubelet detects its node addresses on every status update and requests a new serving certificate through a CSR by itself
+		renewed, err := pki.RenewCertificates(s.embedded, s.pkiConfig)
+		if err != nil {
+			log.Error().Str("component", "kubesolo").Msgf("failed to reissue certificates after the host addresses changed: %v", err)
+		}
+		if len(renewed) > 0 {
+			apiserverService.CertificatesRenewed(renewed)
+		}
+		if err := apiserverService.ReconcileKubernetesEndpoints(); err != nil {
+			log.Error().Str("component", "kubesolo").Msgf("failed to update the kubernetes endpoints after the host addresses changed, the endpoints reconciler retries: %v", err)
+		}
+		// the API server cannot change its advertise address while running, it only shows in the discovery of the API server
+		// since the kubernetes service endpoints are reconciled by kubesolo
+		log.Warn().Str("component", "kubesolo").Msg("the API server keeps advertising its former address until kubesolo restarts")
+		if err := kubelet.WaitForServingCertificate(ctx, s.embedded.KubeletDir, current, types.DefaultServingCertificateTimeout); err != nil {
+			log.Error().Str("component", "kubesolo").Msgf("the kubelet did not renew its serving certificate after the host addresses changed, check the pending certificate signing requests: %v", err)
+		}
+	})
+
 	log.Info().Str("component", "kubesolo").Msg("deploying coredns...")
 	if err := coredns.Deploy(s.embedded.AdminKubeconfigFile); err != nil {
 		log.Fatal().Err(err).Msg("failed to deploy coredns")
@@ -234,14 +406,19 @@ func (s *kubesolo) bootstrap() {
 	logging.SetLoggingLevel("INFO")
 	logging.ConfigureK8sDefaultLogging()
 
-	// Setup paths
+	s.setupPaths()
+}
+
+// setupPaths sets up all required paths for the application from the base path
+func (s *kubesolo) setupPaths() {
 	basePath := *flags.Path
 	s.embedded = types.Embedded{
 		// System paths
 		SystemCNIDir: types.DefaultSystemCNIDir,
 
 		// Admin kubeconfig file
-		AdminKubeconfigFile: filepath.Join(basePath, types.DefaultPKIDir, "admin", "admin.kubeconfig"),
+		AdminKubeconfigFile:     filepath.Join(basePath, types.DefaultPKIDir, "admin", "admin.kubeconfig"),
+		ComponentKubeconfigFile: filepath.Join(basePath, types.DefaultPKIDir, "admin", "component.kubeconfig"),
 
 		// PKI paths
 		PKIDir:           filepath.Join(basePath, types.DefaultPKIDir),
@@ -251,6 +428,7 @@ func (s *kubesolo) bootstrap() {
 		PKIControllerDir: filepath.Join(basePath, types.DefaultPKIDir, "controller-manager"),
 		PKIKubeletDir:    filepath.Join(basePath, types.DefaultPKIDir, "kubelet"),
 		PKIWebhookDir:    filepath.Join(basePath, types.DefaultPKIDir, "webhook"),
+		PKIFrontProxyDir: filepath.Join(basePath, types.DefaultPKIDir, "front-proxy"),
 
 		// Certificate paths
 		KubeletCerts: types.KubeletCertificatePaths{
@@ -259,6 +437,8 @@ func (s *kubesolo) bootstrap() {
 				Cert:   filepath.Join(basePath, types.DefaultPKIDir, "kubelet", "kubelet.crt"),
 				Key:    filepath.Join(basePath, types.DefaultPKIDir, "kubelet", "kubelet.key"),
 			},
+			ServingCert: filepath.Join(basePath, types.DefaultPKIDir, "kubelet", "kubelet-serving.crt"),
+			ServingKey:  filepath.Join(basePath, types.DefaultPKIDir, "kubelet", "kubelet-serving.key"),
 		},
 		APIServerCerts: types.APIServerCertificatePaths{
 			CertificatePaths: types.CertificatePaths{
@@ -289,8 +469,21 @@ func (s *kubesolo) bootstrap() {
 			},
 		},
 		CACerts: types.CACertificatePaths{
-			Cert: filepath.Join(basePath, types.DefaultPKIDir, "ca", "ca.crt"),
-			Key:  filepath.Join(basePath, types.DefaultPKIDir, "ca", "ca.key"),
+			Cert:   filepath.Join(basePath, types.DefaultPKIDir, "ca", "ca.crt"),
+			Key:    filepath.Join(basePath, types.DefaultPKIDir, "ca", "ca.key"),
+			Chain:  filepath.Join(basePath, types.DefaultPKIDir, "ca", "ca-chain.crt"),
+			Bundle: filepath.Join(basePath, types.DefaultPKIDir, "ca", "ca-bundle.crt"),
+		},
+		FrontProxyCACerts: types.CACertificatePaths{
+			Cert: filepath.Join(basePath, types.DefaultPKIDir, "front-proxy", "ca.crt"),
+			Key:  filepath.Join(basePath, types.DefaultPKIDir, "front-proxy", "ca.key"),
+		},
+		FrontProxyClientCerts: types.FrontProxyCertificatePaths{
+			CertificatePaths: types.CertificatePaths{
+				CACert: filepath.Join(basePath, types.DefaultPKIDir, "front-proxy", "ca.crt"),
+				Cert:   filepath.Join(basePath, types.DefaultPKIDir, "front-proxy", "client.crt"),
+				Key:    filepath.Join(basePath, types.DefaultPKIDir, "front-proxy", "client.key"),
+			},
 		},
 
 		// Containerd paths
@@ -320,8 +513,14 @@ func (s *kubesolo) bootstrap() {
 		KubeletPluginsDir:     filepath.Join(basePath, types.DefaultKubeletDir, "volumeplugins"),
 
 		// API Server paths
-		APIServerDir:          filepath.Join(basePath, types.DefaultAPIServerDir),
-		ServiceAccountKeyFile: filepath.Join(basePath, types.DefaultPKIDir, "apiserver", "service-account.key"),
+		APIServerDir:                filepath.Join(basePath, types.DefaultAPIServerDir),
+		ServiceAccountKeyFile:       filepath.Join(basePath, types.DefaultPKIDir, "apiserver", "service-account.key"),
+		ServiceAccountPublicKeyFile: filepath.Join(basePath, types.DefaultPKIDir, "apiserver", "service-account.pub"),
+		EncryptionConfigFile:        filepath.Join(basePath, types.DefaultPKIDir, "apiserver", "encryption-config.yaml"),
+
+		// Audit log paths
+		AuditLogFile:     filepath.Join(basePath, types.DefaultAuditDir, "audit.log"),
+		AuditSealKeyFile: filepath.Join(basePath, types.DefaultPKIDir, "audit", "seal.key"),
 
 		// Kine paths
 		KineDir:        filepath.Join(basePath, types.KubesoloKineDir),
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/portainer/kubesolo/internal/core/encryption"
+	kubesolokubernetes "github.com/portainer/kubesolo/internal/kubernetes"
+	"github.com/portainer/kubesolo/pkg/kine"
+	"github.com/portainer/kubesolo/types"
+	"github.com/rs/zerolog/log"
+)
+
+// secretsEncryptStatus prints the active encryption provider and keys
+func (s *kubesolo) secretsEncryptStatus() error {
+	status, err := encryption.GetStatus(s.embedded.EncryptionConfigFile)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Config:     %s\n", s.embedded.EncryptionConfigFile)
+	fmt.Printf("Provider:   %s\n", status.Provider)
+	fmt.Printf("Active key: %s\n", status.ActiveKey)
+	if len(status.OldKeys) > 0 {
+		fmt.Printf("Old keys:   %s (run 'kubesolo secrets-encrypt reencrypt' to remove them)\n", strings.Join(status.OldKeys, ", "))
+	}
+	return nil
+}
+
+// secretsEncryptRotate adds a new active key to the encryption configuration
+// the API server reloads the configuration automatically
+func (s *kubesolo) secretsEncryptRotate() error {
+	name, err := encryption.RotateKey(s.embedded.EncryptionConfigFile)
+	if err != nil {
+		return err
+	}
+
+	log.Info().Str("component", "kubesolo").Msgf("new encryption key %s is now active, run 'kubesolo secrets-encrypt reencrypt' once the API server has reloaded it", name)
+	return nil
+}
+
+// secretsEncryptReencrypt rewrites every secret with the active key and then removes the old keys
+// the old keys are only removed once every secret is read back from the database encrypted with the active key
+func (s *kubesolo) secretsEncryptReencrypt() error {
+	clientset, err := kubesolokubernetes.GetKubernetesClient(s.embedded.AdminKubeconfigFile)
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes client: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), types.DefaultCommandTimeout)
+	defer cancel()
+
+	count, err := encryption.ReencryptSecrets(ctx, clientset)
+	if err != nil {
+		return fmt.Errorf("old keys were kept: %v", err)
+	}
+	log.Info().Str("component", "kubesolo").Msgf("rewrote %d secrets with the active key", count)
+
+	if err := encryption.VerifyActiveKey(filepath.Join(s.embedded.KineDir, kine.DatabaseFile), s.embedded.EncryptionConfigFile); err != nil {
+		return fmt.Errorf("old keys were kept: %v", err)
+	}
+
+	if err := encryption.PruneKeys(s.embedded.EncryptionConfigFile); err != nil {
+		return err
+	}
+	log.Info().Str("component", "kubesolo").Msg("old encryption keys removed")
+	return nil
+}
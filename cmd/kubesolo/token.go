@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/portainer/kubesolo/internal/config/flags"
+	"github.com/portainer/kubesolo/internal/core/kubeconfig"
+	kubesolokubernetes "github.com/portainer/kubesolo/internal/kubernetes"
+	"github.com/portainer/kubesolo/types"
+	"github.com/rs/zerolog/log"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	// tokenNamespace holds the service accounts backing the issued tokens
+	tokenNamespace = metav1.NamespaceSystem
+	// tokenLabel marks the service accounts and role bindings of a token with the token name
+	tokenLabel = "kubesolo.io/token"
+	// tokenExpiresAnnotation records the expiry of the last token issued for a service account, issued tokens are not stored
+	tokenExpiresAnnotation = "kubesolo.io/token-expires"
+	// tokenMinTTL is the shortest expiry the TokenRequest API accepts
+	tokenMinTTL = 10 * time.Minute
+)
+
+// tokenCreate issues a token for a service account through the TokenRequest API
+// the service account is created on first use, the token is bound to it and stops working when it is revoked
+func (s *kubesolo) tokenCreate() error {
+	name := *flags.TokenCreateName
+	if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+		return fmt.Errorf("invalid token name %q: %v", name, errs)
+	}
+	if *flags.TokenCreateTTL < tokenMinTTL {
+		return fmt.Errorf("token ttl must be at least %s", tokenMinTTL)
+	}
+
+	clientset, err := kubesolokubernetes.GetKubernetesClient(s.embedded.AdminKubeconfigFile)
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes client: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), types.DefaultCommandTimeout)
+	defer cancel()
+
+	serviceAccounts := clientset.CoreV1().ServiceAccounts(tokenNamespace)
+	serviceAccount, err := serviceAccounts.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		serviceAccount, err = serviceAccounts.Create(ctx, &corev1.ServiceAccount{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: tokenNamespace,
+				Labels:    tokenLabels(name),
+			},
+		}, metav1.CreateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get service account for token %s: %v", name, err)
+	}
+	if serviceAccount.Labels[tokenLabel] != name {
+		return fmt.Errorf("service account %s/%s was not created by kubesolo token create", tokenNamespace, name)
+	}
+
+	if *flags.TokenCreateRole != "" {
+		subject := rbacv1.Subject{Kind: rbacv1.ServiceAccountKind, Name: name, Namespace: tokenNamespace}
+		bindingName := fmt.Sprintf("kubesolo-token-%s-%s", name, *flags.TokenCreateRole)
+		if err := bindClusterRole(ctx, clientset, bindingName, subject, *flags.TokenCreateRole, *flags.TokenCreateNamespace, tokenLabels(name)); err != nil {
+			return err
+		}
+	}
+
+	expirationSeconds := int64(flags.TokenCreateTTL.Seconds())
+	tokenRequest, err := serviceAccounts.CreateToken(ctx, name, &authenticationv1.TokenRequest{
+		Spec: authenticationv1.TokenRequestSpec{
+			ExpirationSeconds: &expirationSeconds,
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to issue token %s: %v", name, err)
+	}
+	expires := tokenRequest.Status.ExpirationTimestamp.Time
+
+	if serviceAccount.Annotations == nil {
+		serviceAccount.Annotations = map[string]string{}
+	}
+	serviceAccount.Annotations[tokenExpiresAnnotation] = expires.Format(time.RFC3339)
+	if _, err := serviceAccounts.Update(ctx, serviceAccount, metav1.UpdateOptions{}); err != nil {
+		log.Warn().Str("component", "kubesolo").Msgf("failed to record the expiry of token %s: %v", name, err)
+	}
+
+	if *flags.TokenCreateKubeconfig == "" {
+		fmt.Println(tokenRequest.Status.Token)
+		log.Info().Str("component", "kubesolo").Msgf("token %s issued, expires %s", name, expires.Format(time.RFC3339))
+		return nil
+	}
+
+	server, err := serverURL(*flags.TokenCreateServer)
+	if err != nil {
+		return err
+	}
+	data, err := kubeconfig.BuildTokenKubeconfig(s.embedded, server, name, tokenRequest.Status.Token)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(*flags.TokenCreateKubeconfig, data, 0600); err != nil {
+		return fmt.Errorf("failed to write kubeconfig: %v", err)
+	}
+	log.Info().Str("component", "kubesolo").Msgf("kubeconfig for token %s written to %s, expires %s", name, *flags.TokenCreateKubeconfig, expires.Format(time.RFC3339))
+	return nil
+}
+
+// tokenLabels returns the labels of the service account and role bindings of a token
+func tokenLabels(name string) map[string]string {
+	return map[string]string{
+		"app.kubernetes.io/managed-by": "kubesolo",
+		tokenLabel:                     name,
+	}
+}
+
+// tokenList prints the issued tokens with the expiry of the last token issued under each name
+func (s *kubesolo) tokenList() error {
+	clientset, err := kubesolokubernetes.GetKubernetesClient(s.embedded.AdminKubeconfigFile)
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes client: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), types.DefaultCommandTimeout)
+	defer cancel()
+
+	serviceAccounts, err := clientset.CoreV1().ServiceAccounts(tokenNamespace).List(ctx, metav1.ListOptions{LabelSelector: tokenLabel})
+	if err != nil {
+		return fmt.Errorf("failed to list tokens: %v", err)
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "NAME\tCREATED\tEXPIRES\tSTATUS")
+	for _, serviceAccount := range serviceAccounts.Items {
+		expires := serviceAccount.Annotations[tokenExpiresAnnotation]
+		status := "unknown"
+		if expiresAt, err := time.Parse(time.RFC3339, expires); err == nil {
+			status = "valid"
+			if time.Now().After(expiresAt) {
+				status = "expired"
+			}
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n",
+			serviceAccount.Name,
+			serviceAccount.CreationTimestamp.Format(time.RFC3339),
+			expires,
+			status,
+		)
+	}
+	return writer.Flush()
+}
+
+// tokenRevoke deletes the service account backing a token and its role bindings
+// the API server rejects tokens of deleted service accounts, so every token issued under the name stops working at once
+func (s *kubesolo) tokenRevoke() error {
+	name := *flags.TokenRevokeName
+
+	clientset, err := kubesolokubernetes.GetKubernetesClient(s.embedded.AdminKubeconfigFile)
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes client: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), types.DefaultCommandTimeout)
+	defer cancel()
+
+	serviceAccounts := clientset.CoreV1().ServiceAccounts(tokenNamespace)
+	serviceAccount, err := serviceAccounts.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get token %s: %v", name, err)
+	}
+	if serviceAccount.Labels[tokenLabel] != name {
+		return fmt.Errorf("service account %s/%s was not created by kubesolo token create", tokenNamespace, name)
+	}
+	if err := serviceAccounts.Delete(ctx, name, metav1.DeleteOptions{}); err != nil {
+		return fmt.Errorf("failed to revoke token %s: %v", name, err)
+	}
+
+	selector := metav1.ListOptions{LabelSelector: tokenLabel + "=" + name}
+	roleBindings, err := clientset.RbacV1().RoleBindings(metav1.NamespaceAll).List(ctx, selector)
+	if err != nil {
+		return fmt.Errorf("failed to list role bindings of token %s: %v", name, err)
+	}
+	for _, binding := range roleBindings.Items {
+		if err := clientset.RbacV1().RoleBindings(binding.Namespace).Delete(ctx, binding.Name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete role binding %s/%s: %v", binding.Namespace, binding.Name, err)
+		}
+	}
+	clusterRoleBindings, err := clientset.RbacV1().ClusterRoleBindings().List(ctx, selector)
+	if err != nil {
+		return fmt.Errorf("failed to list cluster role bindings of token %s: %v", name, err)
+	}
+	for _, binding := range clusterRoleBindings.Items {
+		if err := clientset.RbacV1().ClusterRoleBindings().Delete(ctx, binding.Name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete cluster role binding %s: %v", binding.Name, err)
+		}
+	}
+
+	log.Info().Str("component", "kubesolo").Msgf("token %s revoked", name)
+	return nil
+}
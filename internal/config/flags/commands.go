@@ -0,0 +1,66 @@
+package flags
+
+// the full list of commands for the kubesolo application
+// Run is the default command and starts the kubesolo node
+// SecretsEncrypt groups the commands that manage secrets encryption at rest
+// SecretsEncryptStatus prints the active encryption provider and keys
+// SecretsEncryptRotate adds a new encryption key and makes it the active one
+// SecretsEncryptReencrypt rewrites every secret with the active key and removes the old keys
+// Export writes the user-created objects of the cluster to a bundle, ExportOutput is the bundle file
+// Import applies a bundle written by export, ImportFile is the bundle file
+// Certs groups the commands that inspect and rotate the cluster certificates
+// CertsCheck lists every certificate with its subject, SANs, issuer and expiry
+// CertsRotate reissues leaf certificates, CertsRotateNames limits it to the named certificates
+// CertsRotateCA issues a new CA and reissues every leaf certificate
+// CertsRotateSAKey generates a new service account signing key and keeps the previous one for verification
+// Kubeconfig groups the commands that manage user kubeconfigs
+// KubeconfigCreate signs a client certificate for a user and writes a kubeconfig using it
+// KubeconfigRole optionally binds a ClusterRole to the user, in KubeconfigNamespace when it is set
+// KubeconfigOIDC writes a kubeconfig signing users in with the OIDC provider of the node
+// Token groups the commands that manage service account tokens for API access
+// TokenCreate issues a token with an expiry through the TokenRequest API, TokenList and TokenRevoke manage the issued tokens
+// Audit groups the commands that inspect the audit log, AuditVerify checks its hash chain and sealed head
+var (
+	Run                     = Application.Command("run", "Run the kubesolo node. This is the default command.").Default()
+	SecretsEncrypt          = Application.Command("secrets-encrypt", "Manage secrets encryption at rest.")
+	SecretsEncryptStatus    = SecretsEncrypt.Command("status", "Show the active encryption provider and keys.")
+	SecretsEncryptRotate    = SecretsEncrypt.Command("rotate", "Generate a new encryption key and make it the active one. Old keys are kept for decryption.")
+	SecretsEncryptReencrypt = SecretsEncrypt.Command("reencrypt", "Rewrite every secret with the active key and remove the old keys. Run it once the API server has reloaded the rotated key.")
+	Export                  = Application.Command("export", "Export all user-created objects to a YAML bundle that can be imported on another device.")
+	ExportOutput            = Export.Flag("output", "File to write the bundle to, - for stdout. The bundle contains secrets in plaintext.").Short('o').Default("-").String()
+	Import                  = Application.Command("import", "Import a bundle written by export into the cluster.")
+	ImportFile              = Import.Arg("file", "Bundle file to import, - for stdin.").Required().String()
+	Certs                   = Application.Command("certs", "Inspect and rotate the cluster certificates.")
+	CertsCheck              = Certs.Command("check", "List every certificate with its subject, SANs, issuer and expiry.")
+	CertsRotate             = Certs.Command("rotate", "Reissue leaf certificates with the current CA. The running components reload them.")
+	CertsRotateNames        = CertsRotate.Arg("certificate", "Certificates to rotate: kubelet-serving, apiserver, controller-manager, admin, webhook or front-proxy-client. Defaults to all of them.").Strings()
+	CertsRotateCA           = Certs.Command("rotate-ca", "Issue a new CA, keep the previous one in the CA bundle and reissue every leaf certificate. Restart kubesolo afterwards.")
+	CertsRotateSAKey        = Certs.Command("rotate-sa-key", "Generate a new service account signing key, the previous key keeps verifying tokens for 7 days. Restart kubesolo afterwards.")
+	Kubeconfig              = Application.Command("kubeconfig", "Manage user kubeconfigs.")
+	KubeconfigCreate        = Kubeconfig.Command("create", "Sign a client certificate for a user with the cluster CA and write a kubeconfig using it.")
+	KubeconfigUser          = KubeconfigCreate.Flag("user", "User name, the common name of the client certificate.").Required().String()
+	KubeconfigGroups        = KubeconfigCreate.Flag("group", "Group of the user, the organization of the client certificate. Names starting with system: are rejected. Can be repeated.").Strings()
+	KubeconfigTTL           = KubeconfigCreate.Flag("ttl", "How long the client certificate is valid. It cannot be revoked, keep it short.").Default("720h").Duration()
+	KubeconfigServer        = KubeconfigCreate.Flag("server", "API server URL written to the kubeconfig. Defaults to https://<node-ip>:6443.").String()
+	KubeconfigOutput        = KubeconfigCreate.Flag("output", "File to write the kubeconfig to, - for stdout.").Short('o').Default("-").String()
+	KubeconfigRole          = KubeconfigCreate.Flag("role", "ClusterRole to bind to the user, for example view or edit. Defaults to no binding.").String()
+	KubeconfigNamespace     = KubeconfigCreate.Flag("namespace", "Namespace of the RoleBinding created for --role. Defaults to a ClusterRoleBinding.").String()
+	KubeconfigOIDC          = Kubeconfig.Command("oidc", "Write a kubeconfig that signs users in with the OIDC provider set with --oidc-issuer-url. Needs the kubectl oidc-login plugin.")
+	KubeconfigOIDCSecret    = KubeconfigOIDC.Flag("client-secret", "Client secret of the OIDC client, for providers that require one.").String()
+	KubeconfigOIDCScopes    = KubeconfigOIDC.Flag("extra-scope", "Additional scope to request, for example email or groups. Can be repeated.").Strings()
+	KubeconfigOIDCServer    = KubeconfigOIDC.Flag("server", "API server URL written to the kubeconfig. Defaults to https://<node-ip>:6443.").String()
+	KubeconfigOIDCOutput    = KubeconfigOIDC.Flag("output", "File to write the kubeconfig to, - for stdout.").Short('o').Default("-").String()
+	Token                   = Application.Command("token", "Manage API access tokens.")
+	TokenCreate             = Token.Command("create", "Issue a service account token with an expiry. The token is printed to stdout.")
+	TokenCreateName         = TokenCreate.Arg("name", "Token name, the name of the service account backing it.").Required().String()
+	TokenCreateTTL          = TokenCreate.Flag("ttl", "How long the token is valid, at least 10m.").Default("24h").Duration()
+	TokenCreateRole         = TokenCreate.Flag("role", "ClusterRole to bind to the token, for example view or edit. Defaults to no binding.").String()
+	TokenCreateNamespace    = TokenCreate.Flag("namespace", "Namespace of the RoleBinding created for --role. Defaults to a ClusterRoleBinding.").String()
+	TokenCreateKubeconfig   = TokenCreate.Flag("kubeconfig", "Write a kubeconfig using the token to this file instead of printing the token.").String()
+	TokenCreateServer       = TokenCreate.Flag("server", "API server URL written to the kubeconfig. Defaults to https://<node-ip>:6443.").String()
+	TokenList               = Token.Command("list", "List the issued tokens.")
+	TokenRevoke             = Token.Command("revoke", "Revoke every token issued under a name and remove its role bindings.")
+	TokenRevokeName         = TokenRevoke.Arg("name", "Token name.").Required().String()
+	Audit                   = Application.Command("audit", "Inspect the API server audit log.")
+	AuditVerify             = Audit.Command("verify", "Check that no line of the audit log and its rotated logs was edited, removed or reordered since it was written.")
+)
@@ -10,6 +10,21 @@ import "github.com/alecthomas/kingpin/v2"
 // LocalStorage is the flag to enable local storage
 // Debug is the flag to enable debug logging
 // PprofServer is the flag to enable the pprof server
+// DBRecoveryPolicy is what to do when the database fails its integrity check at startup
+// CertRenewalDays is how many days before expiry a leaf certificate is renewed
+// EncryptionProvider is the provider used to encrypt secrets at rest when the encryption config is first generated
+// CACert and CAKey are an operator-supplied CA used instead of a self-generated one
+// KeyAlgorithm is the algorithm of the generated private keys
+// SAKeyRotationDays is the age after which the service account signing key is rotated at startup
+// AuditLogPath is where the API server audit log is written, AuditPolicyFile replaces the built-in audit policy
+// AuditLogMaxSize, AuditLogMaxBackup and AuditLogMaxAge control the rotation of the audit log
+// AdmissionPlugins turns on admission plugins disabled by default, AdmissionConfig holds their configuration
+// PodSecurityEnforce, PodSecurityAudit and PodSecurityWarn are the default Pod Security Admission levels
+// OIDCIssuerURL enables OIDC authentication with the provider, the other OIDC flags configure how its ID tokens are mapped to users
+// MetricsAPI serves the resource metrics API from the kubelet stats
+// FeatureGates are applied to every Kubernetes component, RuntimeConfig is passed to the API server
+// HostAliasesFile lists host aliases added to pods at admission, MutationRulesFile lists rules changing new pods and PVCs
+// Scheduler runs the built-in scheduler instead of binding pods to the node at admission
 var (
 	Application        = kingpin.New("kubesolo", "Ultra-lightweight, OCI-compliant, single-node Kubernetes built for constrained environments such as IoT or IIoT devices running in embedded environments.")
 	Path               = Application.Flag("path", "Path to the directory containing the kubesolo configuration files. Defaults to /var/lib/kubesolo.").Envar("KUBESOLO_PATH").Default("/var/lib/kubesolo").String()
@@ -19,4 +34,34 @@ var (
 	LocalStorage       = Application.Flag("local-storage", "Enable local storage. Defaults to true.").Envar("KUBESOLO_LOCAL_STORAGE").Default("true").Bool()
 	Debug              = Application.Flag("debug", "Enable debug logging. Defaults to false.").Envar("KUBESOLO_DEBUG").Default("false").Bool()
 	PprofServer        = Application.Flag("pprof-server", "Enable pprof server. Defaults to false.").Envar("KUBESOLO_PPROF_SERVER").Default("false").Bool()
+	DBRecoveryPolicy   = Application.Flag("db-recovery-policy", "What to do when the database is corrupt at startup: restore the newest good snapshot, start fresh, or fail. Defaults to restore.").Envar("KUBESOLO_DB_RECOVERY_POLICY").Default("restore").Enum("restore", "fresh", "fail")
+	CertRenewalDays    = Application.Flag("cert-renewal-days", "Renew leaf certificates this many days before they expire. Defaults to 30.").Envar("KUBESOLO_CERT_RENEWAL_DAYS").Default("30").Int()
+	EncryptionProvider = Application.Flag("secrets-encryption-provider", "Provider used to encrypt secrets at rest, aescbc or secretbox. Only used when the encryption config is first generated. Defaults to aescbc.").Envar("KUBESOLO_SECRETS_ENCRYPTION_PROVIDER").Default("aescbc").Enum("aescbc", "secretbox")
+	CACert             = Application.Flag("ca-cert", "Path to a PEM file with the CA certificate used to sign the cluster certificates, optionally followed by its chain up to the root. Defaults to a self-generated CA.").Envar("KUBESOLO_CA_CERT").Default("").String()
+	CAKey              = Application.Flag("ca-key", "Path to the PEM private key of --ca-cert. Defaults to empty string.").Envar("KUBESOLO_CA_KEY").Default("").String()
+	KeyAlgorithm       = Application.Flag("key-algorithm", "Algorithm of the generated private keys: rsa, ecdsa-p256, ecdsa-p384 or ed25519. ECDSA and Ed25519 keys are much faster to generate on low-end devices. Defaults to rsa.").Envar("KUBESOLO_KEY_ALGORITHM").Default("rsa").Enum("rsa", "ecdsa-p256", "ecdsa-p384", "ed25519")
+	SAKeyRotationDays  = Application.Flag("sa-key-rotation-days", "Rotate the service account signing key at startup once it is this many days old. The previous key keeps verifying tokens for 7 days. Defaults to 0, never.").Envar("KUBESOLO_SA_KEY_ROTATION_DAYS").Default("0").Int()
+	AuditLogPath       = Application.Flag("audit-log-path", "File the API server audit events are written to with a hash chain, - for stdout, none to disable audit logging. Defaults to <path>/audit/audit.log.").Envar("KUBESOLO_AUDIT_LOG_PATH").Default("").String()
+	AuditPolicyFile    = Application.Flag("audit-policy-file", "Path to an audit policy replacing the built-in one. Defaults to empty string, the built-in policy.").Envar("KUBESOLO_AUDIT_POLICY_FILE").Default("").String()
+	AuditLogMaxSize    = Application.Flag("audit-log-maxsize", "Size in megabytes at which the audit log is rotated. Defaults to 10.").Envar("KUBESOLO_AUDIT_LOG_MAXSIZE").Default("10").Int()
+	AuditLogMaxBackup  = Application.Flag("audit-log-maxbackup", "Number of rotated audit logs to keep. Defaults to 5.").Envar("KUBESOLO_AUDIT_LOG_MAXBACKUP").Default("5").Int()
+	AuditLogMaxAge     = Application.Flag("audit-log-maxage", "Days to keep rotated audit logs. Defaults to 30.").Envar("KUBESOLO_AUDIT_LOG_MAXAGE").Default("30").Int()
+	AdmissionPlugins   = Application.Flag("enable-admission-plugins", "Comma separated admission plugins to enable in addition to the defaults, for example ResourceQuota,LimitRanger. Defaults to empty string.").Envar("KUBESOLO_ENABLE_ADMISSION_PLUGINS").Default("").String()
+	AdmissionConfig    = Application.Flag("admission-control-config-file", "Path to an AdmissionConfiguration file with the configuration of the admission plugins. Defaults to empty string.").Envar("KUBESOLO_ADMISSION_CONTROL_CONFIG_FILE").Default("").String()
+	PodSecurityEnforce = Application.Flag("pod-security-enforce", "Pod security level enforced in namespaces without their own pod security labels: privileged, baseline or restricted. Defaults to baseline.").Envar("KUBESOLO_POD_SECURITY_ENFORCE").Default("baseline").Enum("privileged", "baseline", "restricted")
+	PodSecurityAudit   = Application.Flag("pod-security-audit", "Pod security level whose violations are recorded in the audit log: privileged, baseline or restricted. Defaults to restricted.").Envar("KUBESOLO_POD_SECURITY_AUDIT").Default("restricted").Enum("privileged", "baseline", "restricted")
+	PodSecurityWarn    = Application.Flag("pod-security-warn", "Pod security level whose violations are returned as warnings to the client: privileged, baseline or restricted. Defaults to restricted.").Envar("KUBESOLO_POD_SECURITY_WARN").Default("restricted").Enum("privileged", "baseline", "restricted")
+	OIDCIssuerURL      = Application.Flag("oidc-issuer-url", "HTTPS URL of the OpenID Connect provider users sign in with. Defaults to empty string, OIDC disabled.").Envar("KUBESOLO_OIDC_ISSUER_URL").Default("").String()
+	OIDCClientID       = Application.Flag("oidc-client-id", "Client ID the ID tokens must be issued for. Required with --oidc-issuer-url.").Envar("KUBESOLO_OIDC_CLIENT_ID").Default("").String()
+	OIDCUsernameClaim  = Application.Flag("oidc-username-claim", "ID token claim used as the username. Defaults to sub.").Envar("KUBESOLO_OIDC_USERNAME_CLAIM").Default("sub").String()
+	OIDCUsernamePrefix = Application.Flag("oidc-username-prefix", "Prefix added to usernames, - for none. Defaults to the issuer URL for claims other than email.").Envar("KUBESOLO_OIDC_USERNAME_PREFIX").Default("").String()
+	OIDCGroupsClaim    = Application.Flag("oidc-groups-claim", "ID token claim holding the groups of the user. Defaults to empty string, no groups.").Envar("KUBESOLO_OIDC_GROUPS_CLAIM").Default("").String()
+	OIDCGroupsPrefix   = Application.Flag("oidc-groups-prefix", "Prefix added to group names. Defaults to empty string.").Envar("KUBESOLO_OIDC_GROUPS_PREFIX").Default("").String()
+	OIDCCAFile         = Application.Flag("oidc-ca-file", "Path to the CA certificate of the OpenID Connect provider. Defaults to the system trust store.").Envar("KUBESOLO_OIDC_CA_FILE").Default("").String()
+	FeatureGates       = Application.Flag("feature-gates", "Comma separated Name=true|false feature gates applied to the API server, controller manager, kubelet and kube-proxy, for example SidecarContainers=true,InPlacePodVerticalScaling=true. Defaults to empty string.").Envar("KUBESOLO_FEATURE_GATES").Default("").String()
+	RuntimeConfig      = Application.Flag("runtime-config", "Comma separated API groups and versions to enable or disable in the API server, for example api/alpha=true or resource.k8s.io/v1beta1=true. Defaults to empty string.").Envar("KUBESOLO_RUNTIME_CONFIG").Default("").String()
+	HostAliasesFile    = Application.Flag("host-aliases-file", "Path to a YAML file with host aliases added to the /etc/hosts of pods, optionally limited to namespaces or a label selector. The file and the kube-system/kubesolo-host-aliases ConfigMap, used instead of a CRD, are watched for changes. Anyone who can write ConfigMaps in kube-system can change the hosts of every pod. Defaults to empty string.").Envar("KUBESOLO_HOST_ALIASES_FILE").Default("").String()
+	MutationRulesFile  = Application.Flag("mutation-rules-file", "Path to a YAML file with rules adding labels, annotations, env vars, tolerations, security context defaults or JSON patches to new pods and PVCs. The file and the kube-system/kubesolo-mutation-rules ConfigMap, used instead of a CRD, are watched for changes. Anyone who can write ConfigMaps in kube-system can inject JSON patches into every pod. Defaults to empty string.").Envar("KUBESOLO_MUTATION_RULES_FILE").Default("").String()
+	Scheduler          = Application.Flag("scheduler", "Bind pods with the built-in scheduler, which leaves pods that do not fit pending and preempts lower priority pods, instead of binding them to the node at admission. Defaults to false.").Envar("KUBESOLO_SCHEDULER").Default("false").Bool()
+	MetricsAPI         = Application.Flag("metrics-api", "Serve the metrics.k8s.io resource metrics API used by kubectl top and the HorizontalPodAutoscaler, the HorizontalPodAutoscaler controller only runs when it is served. Defaults to true.").Envar("KUBESOLO_METRICS_API").Default("true").Bool()
 )
@@ -0,0 +1,424 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/portainer/kubesolo/internal/runtime/filesystem"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// headSuffix is appended to the log path for the file holding the sealed head of the chain
+	headSuffix = ".head"
+	// sealKeySize is the size of the key the head is sealed with
+	sealKeySize = 32
+	// backupTimeFormat is the time format in the names of rotated logs, it sorts in time order
+	backupTimeFormat = "2006-01-02T15-04-05.000000000"
+	// maxRecordSize is the largest line read back, request and response bodies of big objects can make long lines
+	maxRecordSize = 16 * 1024 * 1024
+)
+
+// record is one line of the audit log
+// the hash covers the sequence number, the hash of the line before and the event, so a line cannot be edited,
+// removed or moved without breaking the chain of every line after it
+type record struct {
+	Seq   uint64          `json:"seq"`
+	Prev  string          `json:"prev"`
+	Hash  string          `json:"hash"`
+	Event json.RawMessage `json:"event"`
+}
+
+// head is the last link of the chain, sealed with a key only kubesolo reads so the end of the log cannot be cut off unnoticed
+type head struct {
+	Seq  uint64 `json:"seq"`
+	Hash string `json:"hash"`
+	MAC  string `json:"mac"`
+}
+
+// Options configures where the audit log is written and how it is rotated
+// Path is the log file, - writes the chained lines to stdout without rotation or sealed head
+// SealKeyFile holds the key the head is sealed with, it is generated when missing
+// MaxSize is the size in megabytes at which the log is rotated, MaxBackups and MaxAge in days limit the rotated logs kept
+type Options struct {
+	Path        string
+	SealKeyFile string
+	MaxSize     int
+	MaxBackups  int
+	MaxAge      int
+}
+
+// Log is an append-only audit log where every line is chained to the one before it
+type Log struct {
+	mu      sync.Mutex
+	options Options
+	key     []byte
+	out     io.Writer
+	file    *os.File
+	size    int64
+	seq     uint64
+	last    string
+}
+
+// Open opens the audit log and continues the chain from its last line
+// a log that cannot be read is moved aside and a new one started, and a last line that does not match the sealed head
+// is reported, the chain then continues from the head so the difference stays visible to Verify
+func Open(options Options) (*Log, error) {
+	l := &Log{options: options}
+	if options.Path == "-" {
+		l.out = os.Stdout
+		return l, nil
+	}
+
+	key, err := loadSealKey(options.SealKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	l.key = key
+
+	if err := filesystem.EnsureDirectoryExists(filepath.Dir(options.Path)); err != nil {
+		return nil, fmt.Errorf("failed to create audit log directory: %v", err)
+	}
+
+	last, err := lastRecord(options.Path)
+	if err != nil {
+		damaged := fmt.Sprintf("%s.damaged-%s", options.Path, time.Now().UTC().Format(backupTimeFormat))
+		if renameErr := os.Rename(options.Path, damaged); renameErr != nil {
+			return nil, fmt.Errorf("failed to move the unreadable audit log aside: %v", renameErr)
+		}
+		log.Error().Str("component", "audit").Msgf("%v, it was moved to %s and a new audit log started", err, damaged)
+		last = nil
+	}
+	if last != nil {
+		l.seq, l.last = last.Seq, last.Hash
+	}
+
+	sealed, err := readHead(options.Path, key)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		if last != nil {
+			log.Warn().Str("component", "audit").Msgf("audit log %s has no sealed head, lines removed from its end cannot be detected", options.Path)
+		}
+	case err != nil:
+		log.Error().Str("component", "audit").Msgf("%v, the audit log head was modified outside kubesolo", err)
+	case last == nil || sealed.Seq != last.Seq || sealed.Hash != last.Hash:
+		log.Error().Str("component", "audit").Msgf("audit log %s does not end at its sealed head (line %d), it was modified outside kubesolo", options.Path, sealed.Seq)
+		l.seq, l.last = sealed.Seq, sealed.Hash
+	}
+
+	return l, l.openFile()
+}
+
+// openFile opens the log file for appending
+func (l *Log) openFile() error {
+	file, err := os.OpenFile(l.options.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %v", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to read audit log: %v", err)
+	}
+	l.file, l.out, l.size = file, file, info.Size()
+	return nil
+}
+
+// Append chains the events to the log and seals the new head, the events are JSON objects
+// the lines written before a failure are sealed too, so they do not look cut off at the next start
+func (l *Log) Append(events []json.RawMessage) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, event := range events {
+		if err := l.append(event); err != nil {
+			return errors.Join(err, l.seal())
+		}
+	}
+	return l.seal()
+}
+
+// append writes one event, rotating the log first when the line would take it over the maximum size
+func (l *Log) append(event json.RawMessage) error {
+	r, line, err := l.nextRecord(event)
+	if err != nil {
+		return err
+	}
+	if l.file != nil && l.options.MaxSize > 0 && l.size > 0 && l.size+int64(len(line)) > int64(l.options.MaxSize)*1024*1024 {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	if _, err := l.out.Write(line); err != nil {
+		return fmt.Errorf("failed to write audit log: %v", err)
+	}
+	l.size += int64(len(line))
+	l.seq, l.last = r.Seq, r.Hash
+	return nil
+}
+
+// seal syncs the log and writes its sealed head, the stdout log has no head
+func (l *Log) seal() error {
+	if l.file == nil {
+		return nil
+	}
+	if err := l.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync audit log: %v", err)
+	}
+	return writeHead(l.options.Path, l.key, l.seq, l.last)
+}
+
+// nextRecord chains an event to the last line and returns the record with the line to write
+func (l *Log) nextRecord(event json.RawMessage) (record, []byte, error) {
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, event); err != nil {
+		return record{}, nil, fmt.Errorf("invalid audit event: %v", err)
+	}
+
+	r := record{Seq: l.seq + 1, Prev: l.last, Event: compact.Bytes()}
+	r.Hash = recordHash(r)
+
+	var line bytes.Buffer
+	encoder := json.NewEncoder(&line)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(r); err != nil {
+		return record{}, nil, fmt.Errorf("failed to encode audit record: %v", err)
+	}
+	return r, line.Bytes(), nil
+}
+
+// Close closes the log file
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// rotate compresses the current log next to it under a timestamped name, opens a new one and prunes old logs
+// the chain carries on in the new log, its first line links to the last line of the rotated one
+func (l *Log) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return fmt.Errorf("failed to close audit log: %v", err)
+	}
+	l.file = nil
+
+	ext := filepath.Ext(l.options.Path)
+	backup := fmt.Sprintf("%s-%s%s.gz", strings.TrimSuffix(l.options.Path, ext), time.Now().UTC().Format(backupTimeFormat), ext)
+	if err := compressFile(l.options.Path, backup); err != nil {
+		// the log keeps growing rather than losing events
+		return errors.Join(err, l.openFile())
+	}
+	if err := os.Remove(l.options.Path); err != nil {
+		return errors.Join(fmt.Errorf("failed to remove rotated audit log: %v", err), l.openFile())
+	}
+	if err := l.openFile(); err != nil {
+		return err
+	}
+	return pruneBackups(l.options, time.Now())
+}
+
+// Backups returns the rotated logs of path, oldest first
+func Backups(path string) ([]string, error) {
+	ext := filepath.Ext(path)
+	matches, err := filepath.Glob(strings.TrimSuffix(path, ext) + "-*" + ext + ".gz")
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(matches)
+	return matches, nil
+}
+
+// pruneBackups removes the rotated logs beyond the number to keep and those older than the maximum age
+func pruneBackups(options Options, now time.Time) error {
+	backups, err := Backups(options.Path)
+	if err != nil {
+		return fmt.Errorf("failed to list rotated audit logs: %v", err)
+	}
+
+	for i, backup := range backups {
+		tooMany := options.MaxBackups > 0 && i < len(backups)-options.MaxBackups
+		tooOld := false
+		if options.MaxAge > 0 {
+			if info, err := os.Stat(backup); err == nil {
+				tooOld = now.Sub(info.ModTime()) > time.Duration(options.MaxAge)*24*time.Hour
+			}
+		}
+		if tooMany || tooOld {
+			if err := os.Remove(backup); err != nil {
+				return fmt.Errorf("failed to remove rotated audit log: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// compressFile writes a gzip copy of src to dst
+func compressFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %v", err)
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create rotated audit log: %v", err)
+	}
+	defer out.Close()
+
+	zw := gzip.NewWriter(out)
+	if _, err := io.Copy(zw, in); err != nil {
+		return fmt.Errorf("failed to compress audit log: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to compress audit log: %v", err)
+	}
+	return out.Sync()
+}
+
+// recordHash returns the hash of a record over its sequence number, the previous hash and the event
+func recordHash(r record) string {
+	h := sha256.New()
+	h.Write([]byte(strconv.FormatUint(r.Seq, 10)))
+	h.Write([]byte{'\n'})
+	h.Write([]byte(r.Prev))
+	h.Write([]byte{'\n'})
+	h.Write(r.Event)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// headMAC returns the seal of the head of the chain
+func headMAC(key []byte, seq uint64, hash string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(strconv.FormatUint(seq, 10)))
+	mac.Write([]byte{'\n'})
+	mac.Write([]byte(hash))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// writeHead seals the head of the chain next to the log, the file is replaced atomically
+func writeHead(path string, key []byte, seq uint64, hash string) error {
+	data, err := json.Marshal(head{Seq: seq, Hash: hash, MAC: headMAC(key, seq, hash)})
+	if err != nil {
+		return fmt.Errorf("failed to encode audit log head: %v", err)
+	}
+	tmp := path + headSuffix + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write audit log head: %v", err)
+	}
+	if err := os.Rename(tmp, path+headSuffix); err != nil {
+		return fmt.Errorf("failed to write audit log head: %v", err)
+	}
+	return nil
+}
+
+// readHead reads the sealed head of the log and checks its seal
+func readHead(path string, key []byte) (*head, error) {
+	data, err := os.ReadFile(path + headSuffix)
+	if err != nil {
+		return nil, err
+	}
+	var h head
+	if err := json.Unmarshal(data, &h); err != nil {
+		return nil, fmt.Errorf("failed to parse audit log head: %v", err)
+	}
+	if !hmac.Equal([]byte(h.MAC), []byte(headMAC(key, h.Seq, h.Hash))) {
+		return nil, fmt.Errorf("the seal of the audit log head %s is invalid", path+headSuffix)
+	}
+	return &h, nil
+}
+
+// readSealKey reads the key the head is sealed with
+func readSealKey(path string) ([]byte, error) {
+	key, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != sealKeySize {
+		return nil, fmt.Errorf("audit seal key %s has %d bytes, expected %d", path, len(key), sealKeySize)
+	}
+	return key, nil
+}
+
+// loadSealKey reads the key the head is sealed with, generating it on first use
+func loadSealKey(path string) ([]byte, error) {
+	key, err := readSealKey(path)
+	if !errors.Is(err, os.ErrNotExist) {
+		if err != nil {
+			return nil, fmt.Errorf("failed to read audit seal key: %v", err)
+		}
+		return key, nil
+	}
+
+	key = make([]byte, sealKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate audit seal key: %v", err)
+	}
+	if err := filesystem.EnsureDirectoryExists(filepath.Dir(path)); err != nil {
+		return nil, fmt.Errorf("failed to create audit seal key directory: %v", err)
+	}
+	if err := os.WriteFile(path, key, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write audit seal key: %v", err)
+	}
+	return key, nil
+}
+
+// lastRecord returns the last line of the log, or nil when the log is missing or empty
+func lastRecord(path string) (*record, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %v", err)
+	}
+	defer file.Close()
+
+	var last *record
+	err = scanRecords(file, func(r *record) error {
+		last = r
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit log %s: %v", path, err)
+	}
+	return last, nil
+}
+
+// scanRecords calls fn with every line of the log in order
+func scanRecords(r io.Reader, fn func(*record) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxRecordSize)
+	for line := 1; scanner.Scan(); line++ {
+		var rec record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return fmt.Errorf("line %d is not an audit record: %v", line, err)
+		}
+		if err := fn(&rec); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,220 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testOptions returns options for a log in a temporary directory
+func testOptions(t *testing.T) Options {
+	t.Helper()
+	dir := t.TempDir()
+	return Options{
+		Path:        filepath.Join(dir, "audit", "audit.log"),
+		SealKeyFile: filepath.Join(dir, "pki", "audit", "seal.key"),
+	}
+}
+
+// writeEvents appends count events to the log at options and closes it
+func writeEvents(t *testing.T, options Options, count int) {
+	t.Helper()
+	l, err := Open(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	for i := range count {
+		event := json.RawMessage(fmt.Sprintf(`{"kind": "Event", "auditID": "%d", "user": {"username": "admin<&>"}}`, i))
+		if err := l.Append([]json.RawMessage{event}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// editLines rewrites the lines of the log with fn
+func editLines(t *testing.T, path string, fn func([]string) []string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := fn(strings.Split(strings.TrimSuffix(string(data), "\n"), "\n"))
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name    string
+		tamper  func(t *testing.T, options Options)
+		wantErr string
+	}{
+		{
+			name:   "untouched",
+			tamper: func(t *testing.T, options Options) {},
+		},
+		{
+			name: "edited line",
+			tamper: func(t *testing.T, options Options) {
+				editLines(t, options.Path, func(lines []string) []string {
+					lines[1] = strings.Replace(lines[1], "admin", "nobody", 1)
+					return lines
+				})
+			},
+			wantErr: "line 2 was modified",
+		},
+		{
+			name: "removed line",
+			tamper: func(t *testing.T, options Options) {
+				editLines(t, options.Path, func(lines []string) []string {
+					return append(lines[:1], lines[2:]...)
+				})
+			},
+			wantErr: "line 3 does not follow line 1",
+		},
+		{
+			name: "removed last line",
+			tamper: func(t *testing.T, options Options) {
+				editLines(t, options.Path, func(lines []string) []string {
+					return lines[:len(lines)-1]
+				})
+			},
+			wantErr: "sealed head is at line 3",
+		},
+		{
+			name: "forged head",
+			tamper: func(t *testing.T, options Options) {
+				editLines(t, options.Path, func(lines []string) []string {
+					return lines[:len(lines)-1]
+				})
+				if err := writeHead(options.Path, make([]byte, sealKeySize), 2, "forged"); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: "seal of the audit log head",
+		},
+		{
+			name: "removed head",
+			tamper: func(t *testing.T, options Options) {
+				if err := os.Remove(options.Path + headSuffix); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: "no sealed head",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := testOptions(t)
+			writeEvents(t, options, 3)
+			tt.tamper(t, options)
+
+			result, err := Verify(options.Path, options.SealKeyFile)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if result.Records != 3 || result.FirstSeq != 1 || result.LastSeq != 3 {
+					t.Errorf("Verify() = %+v, expected lines 1 to 3", result)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Verify() error = %v, expected %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOpenContinuesChain(t *testing.T) {
+	options := testOptions(t)
+	writeEvents(t, options, 2)
+	writeEvents(t, options, 2)
+
+	result, err := Verify(options.Path, options.SealKeyFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Records != 4 || result.LastSeq != 4 {
+		t.Errorf("Verify() = %+v, expected 4 lines", result)
+	}
+}
+
+func TestOpenKeepsTamperingVisible(t *testing.T) {
+	options := testOptions(t)
+	writeEvents(t, options, 3)
+	editLines(t, options.Path, func(lines []string) []string {
+		return lines[:len(lines)-1]
+	})
+
+	// the next start carries on from the sealed head, the removed line still shows as a gap
+	writeEvents(t, options, 1)
+	if _, err := Verify(options.Path, options.SealKeyFile); err == nil || !strings.Contains(err.Error(), "line 4 does not follow line 2") {
+		t.Errorf("Verify() error = %v, expected the removed line to show", err)
+	}
+}
+
+func TestOpenMovesUnreadableLogAside(t *testing.T) {
+	options := testOptions(t)
+	if err := os.MkdirAll(filepath.Dir(options.Path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(options.Path, []byte("not an audit record\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	writeEvents(t, options, 1)
+
+	damaged, err := filepath.Glob(options.Path + ".damaged-*")
+	if err != nil || len(damaged) != 1 {
+		t.Fatalf("expected the unreadable log to be moved aside, found %v", damaged)
+	}
+	if _, err := Verify(options.Path, options.SealKeyFile); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestRotation(t *testing.T) {
+	options := testOptions(t)
+	options.MaxSize = 1
+	options.MaxBackups = 2
+
+	l, err := Open(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every event is about 300KiB, so the log rotates every few events
+	event := json.RawMessage(fmt.Sprintf(`{"kind": "Event", "requestObject": %q}`, strings.Repeat("x", 300*1024)))
+	for range 12 {
+		if err := l.Append([]json.RawMessage{event}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	backups, err := Backups(options.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != options.MaxBackups {
+		t.Errorf("found %d rotated logs, expected %d", len(backups), options.MaxBackups)
+	}
+
+	// the oldest lines were pruned, the chain through the kept logs is still complete
+	result, err := Verify(options.Path, options.SealKeyFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.LastSeq != 12 || result.FirstSeq == 1 || len(result.Files) != options.MaxBackups+1 {
+		t.Errorf("Verify() = %+v, expected the kept logs up to line 12", result)
+	}
+}
@@ -0,0 +1,101 @@
+package audit
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Result describes a verified audit log
+// Files are the logs checked, oldest first, FirstSeq and LastSeq the sequence numbers of the first and last lines found
+type Result struct {
+	Files    []string
+	Records  int
+	FirstSeq uint64
+	LastSeq  uint64
+}
+
+// Verify checks the chain through the rotated logs and the log at path, then checks the last line against the sealed head
+// the first line may link to a rotated log that was already pruned, every other line must link to the line before it
+func Verify(path, sealKeyFile string) (*Result, error) {
+	key, err := readSealKey(sealKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit seal key: %v", err)
+	}
+
+	files, err := Backups(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rotated audit logs: %v", err)
+	}
+	if _, err := os.Stat(path); err == nil {
+		files = append(files, path)
+	}
+
+	result := &Result{Files: files}
+	var last *record
+	for _, file := range files {
+		if err := verifyFile(file, result, &last); err != nil {
+			return result, err
+		}
+	}
+
+	sealed, err := readHead(path, key)
+	if errors.Is(err, os.ErrNotExist) {
+		return result, fmt.Errorf("audit log %s has no sealed head", path)
+	}
+	if err != nil {
+		return result, err
+	}
+	if last == nil {
+		if sealed.Seq != 0 {
+			return result, fmt.Errorf("the audit log is empty but its sealed head is at line %d", sealed.Seq)
+		}
+		return result, nil
+	}
+	if sealed.Seq != last.Seq || sealed.Hash != last.Hash {
+		return result, fmt.Errorf("the audit log ends at line %d but its sealed head is at line %d, lines were removed or added", last.Seq, sealed.Seq)
+	}
+	return result, nil
+}
+
+// verifyFile checks the lines of one log, last is the line read before it and is updated as lines are read
+func verifyFile(path string, result *Result, last **record) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %v", err)
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		zr, err := gzip.NewReader(file)
+		if err != nil {
+			return fmt.Errorf("failed to decompress %s: %v", path, err)
+		}
+		defer zr.Close()
+		reader = zr
+	}
+
+	err = scanRecords(reader, func(r *record) error {
+		if recordHash(*r) != r.Hash {
+			return fmt.Errorf("line %d was modified", r.Seq)
+		}
+		if *last != nil && (r.Seq != (*last).Seq+1 || r.Prev != (*last).Hash) {
+			return fmt.Errorf("line %d does not follow line %d, lines were removed, added or reordered", r.Seq, (*last).Seq)
+		}
+		if result.Records == 0 {
+			result.FirstSeq = r.Seq
+		}
+		result.Records++
+		result.LastSeq = r.Seq
+		*last = r
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return nil
+}
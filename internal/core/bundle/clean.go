@@ -0,0 +1,67 @@
+package bundle
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// serverAnnotations are annotations written by the API server or controllers that must not be re-applied
+var serverAnnotations = []string{
+	"kubectl.kubernetes.io/last-applied-configuration",
+	"deployment.kubernetes.io/revision",
+	"pv.kubernetes.io/bind-completed",
+	"pv.kubernetes.io/bound-by-controller",
+	"volume.kubernetes.io/selected-node",
+	"volume.kubernetes.io/storage-provisioner",
+	"volume.beta.kubernetes.io/storage-provisioner",
+}
+
+// jobControllerLabels are labels the job controller adds to the pod template together with a generated selector
+var jobControllerLabels = []string{
+	"controller-uid",
+	"job-name",
+	"batch.kubernetes.io/controller-uid",
+	"batch.kubernetes.io/job-name",
+}
+
+// cleanObject strips the server-generated fields so the object can be applied on another cluster
+func cleanObject(obj *unstructured.Unstructured) {
+	for _, field := range []string{"uid", "resourceVersion", "generation", "creationTimestamp", "deletionTimestamp", "deletionGracePeriodSeconds", "managedFields", "selfLink", "ownerReferences"} {
+		unstructured.RemoveNestedField(obj.Object, "metadata", field)
+	}
+	unstructured.RemoveNestedField(obj.Object, "status")
+
+	annotations := obj.GetAnnotations()
+	for _, annotation := range serverAnnotations {
+		delete(annotations, annotation)
+	}
+	if len(annotations) == 0 {
+		annotations = nil
+	}
+	obj.SetAnnotations(annotations)
+
+	switch obj.GetKind() {
+	case "Service":
+		// cluster IPs are allocated again, headless services keep "None"
+		if clusterIP, _, _ := unstructured.NestedString(obj.Object, "spec", "clusterIP"); clusterIP != "None" {
+			unstructured.RemoveNestedField(obj.Object, "spec", "clusterIP")
+			unstructured.RemoveNestedField(obj.Object, "spec", "clusterIPs")
+		}
+		unstructured.RemoveNestedField(obj.Object, "spec", "healthCheckNodePort")
+
+	case "PersistentVolumeClaim":
+		unstructured.RemoveNestedField(obj.Object, "spec", "volumeName")
+
+	case "PersistentVolume":
+		unstructured.RemoveNestedField(obj.Object, "spec", "claimRef")
+
+	case "Pod":
+		unstructured.RemoveNestedField(obj.Object, "spec", "nodeName")
+
+	case "Job":
+		unstructured.RemoveNestedField(obj.Object, "spec", "selector")
+		for _, label := range jobControllerLabels {
+			unstructured.RemoveNestedField(obj.Object, "spec", "template", "metadata", "labels", label)
+			unstructured.RemoveNestedField(obj.Object, "metadata", "labels", label)
+		}
+	}
+}
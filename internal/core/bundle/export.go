@@ -0,0 +1,121 @@
+package bundle
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"sigs.k8s.io/yaml"
+)
+
+// kindOrder is the order kinds are written in, so dependencies exist before the objects that use them on import
+// kinds that are not listed are written afterwards in alphabetical order
+var kindOrder = []string{
+	"Namespace",
+	"CustomResourceDefinition",
+	"PriorityClass",
+	"StorageClass",
+	"ClusterRole",
+	"ClusterRoleBinding",
+	"ServiceAccount",
+	"Role",
+	"RoleBinding",
+	"Secret",
+	"ConfigMap",
+	"PersistentVolume",
+	"PersistentVolumeClaim",
+	"Service",
+}
+
+// Export writes every user-created object in the cluster to the writer as a multi-document YAML bundle
+// objects managed by kubernetes or kubesolo are skipped and server-generated fields are stripped
+// it returns the number of objects written
+func Export(ctx context.Context, discoveryClient discovery.DiscoveryInterface, dynamicClient dynamic.Interface, out io.Writer) (int, error) {
+	resourceLists, err := discoveryClient.ServerPreferredResources()
+	if err != nil {
+		if len(resourceLists) == 0 {
+			return 0, fmt.Errorf("failed to discover API resources: %v", err)
+		}
+		log.Warn().Str("component", "bundle").Msgf("some API groups could not be discovered and are not exported: %v", err)
+	}
+
+	objects := []unstructured.Unstructured{}
+	for _, resourceList := range resourceLists {
+		groupVersion, err := schema.ParseGroupVersion(resourceList.GroupVersion)
+		if err != nil {
+			continue
+		}
+
+		for _, resource := range resourceList.APIResources {
+			if strings.Contains(resource.Name, "/") || isSkippedResource(groupVersion.Group, resource.Name) {
+				continue
+			}
+			if !slices.Contains(resource.Verbs, "list") || !slices.Contains(resource.Verbs, "create") {
+				continue
+			}
+
+			list, err := dynamicClient.Resource(groupVersion.WithResource(resource.Name)).List(ctx, metav1.ListOptions{})
+			if err != nil {
+				return 0, fmt.Errorf("failed to list %s: %v", resource.Name, err)
+			}
+
+			for i := range list.Items {
+				obj := &list.Items[i]
+				if isManagedObject(obj) {
+					continue
+				}
+				cleanObject(obj)
+				objects = append(objects, *obj)
+			}
+		}
+	}
+
+	sortObjects(objects)
+
+	if _, err := fmt.Fprintf(out, "# kubesolo cluster export, %s\n", time.Now().UTC().Format(time.RFC3339)); err != nil {
+		return 0, fmt.Errorf("failed to write bundle: %v", err)
+	}
+	for _, obj := range objects {
+		data, err := yaml.Marshal(obj.Object)
+		if err != nil {
+			return 0, fmt.Errorf("failed to marshal %s %s: %v", obj.GetKind(), obj.GetName(), err)
+		}
+		if _, err := fmt.Fprintf(out, "---\n%s", data); err != nil {
+			return 0, fmt.Errorf("failed to write bundle: %v", err)
+		}
+	}
+
+	return len(objects), nil
+}
+
+// sortObjects sorts the objects by kind order, then namespace and name
+func sortObjects(objects []unstructured.Unstructured) {
+	rank := func(kind string) int {
+		if index := slices.Index(kindOrder, kind); index >= 0 {
+			return index
+		}
+		return len(kindOrder)
+	}
+
+	slices.SortStableFunc(objects, func(a, b unstructured.Unstructured) int {
+		if diff := rank(a.GetKind()) - rank(b.GetKind()); diff != 0 {
+			return diff
+		}
+		if diff := strings.Compare(a.GetKind(), b.GetKind()); diff != 0 {
+			return diff
+		}
+		if diff := strings.Compare(a.GetNamespace(), b.GetNamespace()); diff != 0 {
+			return diff
+		}
+		return strings.Compare(a.GetName(), b.GetName())
+	})
+}
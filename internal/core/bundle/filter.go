@@ -0,0 +1,103 @@
+package bundle
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/portainer/kubesolo/types"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// skippedGroups are API groups whose objects are runtime state or defaults recreated by the API server
+var skippedGroups = []string{
+	"apiregistration.k8s.io",
+	"authentication.k8s.io",
+	"authorization.k8s.io",
+	"certificates.k8s.io",
+	"coordination.k8s.io",
+	"discovery.k8s.io",
+	"events.k8s.io",
+	"flowcontrol.apiserver.k8s.io",
+	"metrics.k8s.io",
+}
+
+// skippedResources are resources that only make sense on the node that created them
+var skippedResources = []string{
+	"bindings",
+	"componentstatuses",
+	"controllerrevisions",
+	"csinodes",
+	"csistoragecapacities",
+	"endpoints",
+	"events",
+	"nodes",
+	"volumeattachments",
+}
+
+// managedNamespaces are the namespaces created and reconciled by kubernetes or kubesolo
+var managedNamespaces = []string{
+	"default",
+	"kube-node-lease",
+	"kube-public",
+	"kube-system",
+	"local-path-storage",
+	"portainer",
+}
+
+// managedClusterObjects are the cluster-scoped objects deployed by kubesolo, keyed by kind
+var managedClusterObjects = map[string][]string{
+	"ClusterRole":                    {"local-path-provisioner-role"},
+	"ClusterRoleBinding":             {"local-path-provisioner-bind", "portainer-crb-clusteradmin", "kubernetes-admin-cluster-admin"},
+	"StorageClass":                   {"local-path"},
+	"MutatingWebhookConfiguration":   {types.DefaultWebhookName},
+	"ValidatingWebhookConfiguration": {types.DefaultValidatingWebhookName},
+}
+
+// isSkippedResource returns true if no object of the resource should be exported
+func isSkippedResource(group, resource string) bool {
+	return slices.Contains(skippedGroups, group) || slices.Contains(skippedResources, resource)
+}
+
+// isManagedObject returns true if the object is created by kubernetes, a controller or kubesolo itself
+// and will be recreated on a fresh device without being part of the bundle
+func isManagedObject(obj *unstructured.Unstructured) bool {
+	name := obj.GetName()
+	kind := obj.GetKind()
+
+	if len(obj.GetOwnerReferences()) > 0 {
+		return true
+	}
+	if obj.GetLabels()["kubernetes.io/bootstrapping"] == "rbac-defaults" {
+		return true
+	}
+	if strings.HasPrefix(name, "system:") || strings.HasPrefix(name, "system-") {
+		return true
+	}
+
+	if kind == "Namespace" {
+		return slices.Contains(managedNamespaces, name)
+	}
+	if namespace := obj.GetNamespace(); namespace != "" && namespace != "default" && slices.Contains(managedNamespaces, namespace) {
+		return true
+	}
+	if slices.Contains(managedClusterObjects[kind], name) {
+		return true
+	}
+
+	switch kind {
+	case "Service":
+		return obj.GetNamespace() == "default" && name == "kubernetes"
+	case "ServiceAccount":
+		return name == "default"
+	case "ConfigMap":
+		return name == "kube-root-ca.crt"
+	case "Secret":
+		secretType, _, _ := unstructured.NestedString(obj.Object, "type")
+		return secretType == "kubernetes.io/service-account-token"
+	case "PersistentVolume":
+		// dynamically provisioned volumes are recreated by their claims
+		_, provisioned := obj.GetAnnotations()["pv.kubernetes.io/provisioned-by"]
+		return provisioned
+	}
+	return false
+}
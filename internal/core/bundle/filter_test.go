@@ -0,0 +1,194 @@
+package bundle
+
+import (
+	"testing"
+
+	"github.com/portainer/kubesolo/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// object returns an unstructured object of the kind with the name and namespace
+func object(kind, namespace, name string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetKind(kind)
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	return obj
+}
+
+func TestIsManagedObject(t *testing.T) {
+	tests := []struct {
+		name   string
+		obj    func() *unstructured.Unstructured
+		expect bool
+	}{
+		{
+			name:   "user deployment in the default namespace",
+			obj:    func() *unstructured.Unstructured { return object("Deployment", "default", "web") },
+			expect: false,
+		},
+		{
+			name:   "user deployment in its own namespace",
+			obj:    func() *unstructured.Unstructured { return object("Deployment", "apps", "web") },
+			expect: false,
+		},
+		{
+			name:   "object in a managed namespace",
+			obj:    func() *unstructured.Unstructured { return object("Deployment", "kube-system", "coredns") },
+			expect: true,
+		},
+		{
+			name: "object owned by another object",
+			obj: func() *unstructured.Unstructured {
+				obj := object("ReplicaSet", "apps", "web-5d8f")
+				obj.SetOwnerReferences([]metav1.OwnerReference{{Kind: "Deployment", Name: "web"}})
+				return obj
+			},
+			expect: true,
+		},
+		{
+			name: "default rbac object",
+			obj: func() *unstructured.Unstructured {
+				obj := object("ClusterRole", "", "admin")
+				obj.SetLabels(map[string]string{"kubernetes.io/bootstrapping": "rbac-defaults"})
+				return obj
+			},
+			expect: true,
+		},
+		{
+			name:   "system prefixed object",
+			obj:    func() *unstructured.Unstructured { return object("ClusterRoleBinding", "", "system:node") },
+			expect: true,
+		},
+		{
+			name:   "system dashed priority class",
+			obj:    func() *unstructured.Unstructured { return object("PriorityClass", "", "system-node-critical") },
+			expect: true,
+		},
+		{
+			name:   "managed namespace",
+			obj:    func() *unstructured.Unstructured { return object("Namespace", "", "kube-system") },
+			expect: true,
+		},
+		{
+			name:   "user namespace",
+			obj:    func() *unstructured.Unstructured { return object("Namespace", "", "apps") },
+			expect: false,
+		},
+		{
+			name:   "cluster object deployed by kubesolo",
+			obj:    func() *unstructured.Unstructured { return object("StorageClass", "", "local-path") },
+			expect: true,
+		},
+		{
+			name: "mutating webhook deployed by kubesolo",
+			obj: func() *unstructured.Unstructured {
+				return object("MutatingWebhookConfiguration", "", types.DefaultWebhookName)
+			},
+			expect: true,
+		},
+		{
+			name: "validating webhook deployed by kubesolo",
+			obj: func() *unstructured.Unstructured {
+				return object("ValidatingWebhookConfiguration", "", types.DefaultValidatingWebhookName)
+			},
+			expect: true,
+		},
+		{
+			name: "user validating webhook",
+			obj: func() *unstructured.Unstructured {
+				return object("ValidatingWebhookConfiguration", "", "policy.example.com")
+			},
+			expect: false,
+		},
+		{
+			name:   "user storage class",
+			obj:    func() *unstructured.Unstructured { return object("StorageClass", "", "fast") },
+			expect: false,
+		},
+		{
+			name:   "kubernetes service",
+			obj:    func() *unstructured.Unstructured { return object("Service", "default", "kubernetes") },
+			expect: true,
+		},
+		{
+			name:   "user service named kubernetes in another namespace",
+			obj:    func() *unstructured.Unstructured { return object("Service", "apps", "kubernetes") },
+			expect: false,
+		},
+		{
+			name:   "default service account",
+			obj:    func() *unstructured.Unstructured { return object("ServiceAccount", "apps", "default") },
+			expect: true,
+		},
+		{
+			name:   "root CA config map",
+			obj:    func() *unstructured.Unstructured { return object("ConfigMap", "apps", "kube-root-ca.crt") },
+			expect: true,
+		},
+		{
+			name: "service account token secret",
+			obj: func() *unstructured.Unstructured {
+				obj := object("Secret", "apps", "builder-token")
+				obj.Object["type"] = "kubernetes.io/service-account-token"
+				return obj
+			},
+			expect: true,
+		},
+		{
+			name: "opaque secret",
+			obj: func() *unstructured.Unstructured {
+				obj := object("Secret", "apps", "credentials")
+				obj.Object["type"] = "Opaque"
+				return obj
+			},
+			expect: false,
+		},
+		{
+			name: "dynamically provisioned volume",
+			obj: func() *unstructured.Unstructured {
+				obj := object("PersistentVolume", "", "pvc-1234")
+				obj.SetAnnotations(map[string]string{"pv.kubernetes.io/provisioned-by": "rancher.io/local-path"})
+				return obj
+			},
+			expect: true,
+		},
+		{
+			name:   "statically provisioned volume",
+			obj:    func() *unstructured.Unstructured { return object("PersistentVolume", "", "data") },
+			expect: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isManagedObject(tt.obj()); got != tt.expect {
+				t.Errorf("isManagedObject() = %v, expected %v", got, tt.expect)
+			}
+		})
+	}
+}
+
+func TestIsSkippedResource(t *testing.T) {
+	tests := []struct {
+		group    string
+		resource string
+		expect   bool
+	}{
+		{group: "", resource: "events", expect: true},
+		{group: "", resource: "nodes", expect: true},
+		{group: "coordination.k8s.io", resource: "leases", expect: true},
+		{group: "metrics.k8s.io", resource: "pods", expect: true},
+		{group: "", resource: "configmaps", expect: false},
+		{group: "apps", resource: "deployments", expect: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.group+"/"+tt.resource, func(t *testing.T) {
+			if got := isSkippedResource(tt.group, tt.resource); got != tt.expect {
+				t.Errorf("isSkippedResource() = %v, expected %v", got, tt.expect)
+			}
+		})
+	}
+}
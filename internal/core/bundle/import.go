@@ -0,0 +1,108 @@
+package bundle
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/portainer/kubesolo/types"
+	"github.com/rs/zerolog/log"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/restmapper"
+)
+
+const fieldManager = "kubesolo-import"
+
+// Import applies every object of a bundle written by Export to the cluster with server-side apply
+// objects are applied in bundle order, custom resources wait for their definitions to be established
+// it returns the number of objects applied and an error if any object failed
+func Import(ctx context.Context, discoveryClient discovery.DiscoveryInterface, dynamicClient dynamic.Interface, in io.Reader) (int, error) {
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(discoveryClient))
+	decoder := utilyaml.NewYAMLOrJSONDecoder(in, 4096)
+
+	applied := 0
+	failed := 0
+	for {
+		obj := &unstructured.Unstructured{}
+		if err := decoder.Decode(&obj.Object); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return applied, fmt.Errorf("failed to decode bundle: %v", err)
+		}
+		if len(obj.Object) == 0 {
+			continue
+		}
+
+		if err := applyObject(ctx, mapper, dynamicClient, obj); err != nil {
+			log.Error().Str("component", "bundle").Msgf("failed to apply %s %s: %v", obj.GetKind(), objectName(obj), err)
+			failed++
+			continue
+		}
+		log.Debug().Str("component", "bundle").Msgf("applied %s %s", obj.GetKind(), objectName(obj))
+		applied++
+	}
+
+	if failed > 0 {
+		return applied, fmt.Errorf("failed to apply %d of %d objects", failed, applied+failed)
+	}
+	return applied, nil
+}
+
+// applyObject applies a single object, retrying the kind lookup while a custom resource definition is being established
+func applyObject(ctx context.Context, mapper *restmapper.DeferredDiscoveryRESTMapper, dynamicClient dynamic.Interface, obj *unstructured.Unstructured) error {
+	gvk := obj.GroupVersionKind()
+
+	var mapping *meta.RESTMapping
+	var err error
+	for range types.DefaultRetryCount {
+		mapping, err = mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err == nil || !meta.IsNoMatchError(err) {
+			break
+		}
+		mapper.Reset()
+		time.Sleep(types.DefaultComponentSleep)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to find resource for %s: %v", gvk, err)
+	}
+
+	resource := dynamicClient.Resource(mapping.Resource)
+	var client dynamic.ResourceInterface = resource
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		if obj.GetNamespace() == "" {
+			obj.SetNamespace(metav1.NamespaceDefault)
+		}
+		client = resource.Namespace(obj.GetNamespace())
+	}
+
+	data, err := json.Marshal(obj.Object)
+	if err != nil {
+		return fmt.Errorf("failed to marshal object: %v", err)
+	}
+
+	force := true
+	_, err = client.Patch(ctx, obj.GetName(), k8stypes.ApplyPatchType, data, metav1.PatchOptions{
+		FieldManager: fieldManager,
+		Force:        &force,
+	})
+	return err
+}
+
+// objectName returns the namespaced name of the object for logging
+func objectName(obj *unstructured.Unstructured) string {
+	if obj.GetNamespace() == "" {
+		return obj.GetName()
+	}
+	return obj.GetNamespace() + "/" + obj.GetName()
+}
@@ -0,0 +1,237 @@
+package encryption
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/portainer/kubesolo/internal/runtime/filesystem"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// ProviderAESCBC encrypts secrets with AES-CBC and PKCS#7 padding
+	ProviderAESCBC = "aescbc"
+	// ProviderSecretbox encrypts secrets with XSalsa20 and Poly1305
+	ProviderSecretbox = "secretbox"
+
+	keySize = 32
+)
+
+// encryptionConfiguration mirrors the apiserver.config.k8s.io/v1 EncryptionConfiguration
+type encryptionConfiguration struct {
+	Kind       string                  `yaml:"kind"`
+	APIVersion string                  `yaml:"apiVersion"`
+	Resources  []resourceConfiguration `yaml:"resources"`
+}
+
+// resourceConfiguration lists the resources to encrypt and the providers to use, the first provider encrypts
+type resourceConfiguration struct {
+	Resources []string                `yaml:"resources"`
+	Providers []providerConfiguration `yaml:"providers"`
+}
+
+// providerConfiguration holds exactly one of the supported providers
+type providerConfiguration struct {
+	AESCBC    *keysConfiguration `yaml:"aescbc,omitempty"`
+	Secretbox *keysConfiguration `yaml:"secretbox,omitempty"`
+	Identity  *struct{}          `yaml:"identity,omitempty"`
+}
+
+// keysConfiguration holds the keys of a provider, the first key encrypts and all keys decrypt
+type keysConfiguration struct {
+	Keys []key `yaml:"keys"`
+}
+
+// key is a named base64 encoded encryption key
+type key struct {
+	Name   string `yaml:"name"`
+	Secret string `yaml:"secret"`
+}
+
+// Status describes the encryption configuration on disk
+type Status struct {
+	Provider  string
+	ActiveKey string
+	OldKeys   []string
+}
+
+// EnsureEncryptionConfig generates the encryption configuration with a new key if it does not exist yet
+// the identity provider is always kept last so secrets written before encryption was enabled can still be read
+func EnsureEncryptionConfig(configFile, provider string) error {
+	if filesystem.FileExists(configFile) {
+		return nil
+	}
+
+	newKey, err := generateKey()
+	if err != nil {
+		return err
+	}
+
+	providerConfig, err := newProviderConfiguration(provider, []key{newKey})
+	if err != nil {
+		return err
+	}
+
+	config := &encryptionConfiguration{
+		Kind:       "EncryptionConfiguration",
+		APIVersion: "apiserver.config.k8s.io/v1",
+		Resources: []resourceConfiguration{
+			{
+				Resources: []string{"secrets"},
+				Providers: []providerConfiguration{providerConfig, {Identity: &struct{}{}}},
+			},
+		},
+	}
+
+	if err := filesystem.EnsureDirectoryExists(filepath.Dir(configFile)); err != nil {
+		return fmt.Errorf("failed to create encryption config directory: %v", err)
+	}
+	return writeConfig(configFile, config)
+}
+
+// GetStatus returns the active provider and keys from the encryption configuration
+func GetStatus(configFile string) (*Status, error) {
+	config, err := readConfig(configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	provider, keys, err := activeProvider(config)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &Status{
+		Provider:  provider,
+		ActiveKey: keys.Keys[0].Name,
+	}
+	for _, k := range keys.Keys[1:] {
+		status.OldKeys = append(status.OldKeys, k.Name)
+	}
+	return status, nil
+}
+
+// RotateKey adds a new key in front of the active provider keys so it is used for encryption
+// the previous keys are kept so existing secrets can still be decrypted
+// it returns the name of the new key
+func RotateKey(configFile string) (string, error) {
+	config, err := readConfig(configFile)
+	if err != nil {
+		return "", err
+	}
+
+	_, keys, err := activeProvider(config)
+	if err != nil {
+		return "", err
+	}
+
+	newKey, err := generateKey()
+	if err != nil {
+		return "", err
+	}
+	keys.Keys = append([]key{newKey}, keys.Keys...)
+
+	if err := writeConfig(configFile, config); err != nil {
+		return "", err
+	}
+	return newKey.Name, nil
+}
+
+// PruneKeys removes every key except the active one, the identity provider is kept for reads
+// it must only be called once every secret has been rewritten with the active key
+func PruneKeys(configFile string) error {
+	config, err := readConfig(configFile)
+	if err != nil {
+		return err
+	}
+
+	_, keys, err := activeProvider(config)
+	if err != nil {
+		return err
+	}
+	keys.Keys = keys.Keys[:1]
+	config.Resources[0].Providers = []providerConfiguration{config.Resources[0].Providers[0], {Identity: &struct{}{}}}
+
+	return writeConfig(configFile, config)
+}
+
+// activeProvider returns the name and keys of the provider that encrypts new writes
+func activeProvider(config *encryptionConfiguration) (string, *keysConfiguration, error) {
+	if len(config.Resources) == 0 || len(config.Resources[0].Providers) == 0 {
+		return "", nil, fmt.Errorf("encryption config has no providers")
+	}
+
+	first := config.Resources[0].Providers[0]
+	switch {
+	case first.AESCBC != nil && len(first.AESCBC.Keys) > 0:
+		return ProviderAESCBC, first.AESCBC, nil
+	case first.Secretbox != nil && len(first.Secretbox.Keys) > 0:
+		return ProviderSecretbox, first.Secretbox, nil
+	}
+	return "", nil, fmt.Errorf("the first encryption provider is not aescbc or secretbox with at least one key")
+}
+
+// newProviderConfiguration returns the provider configuration for the named provider
+func newProviderConfiguration(provider string, keys []key) (providerConfiguration, error) {
+	switch provider {
+	case ProviderAESCBC:
+		return providerConfiguration{AESCBC: &keysConfiguration{Keys: keys}}, nil
+	case ProviderSecretbox:
+		return providerConfiguration{Secretbox: &keysConfiguration{Keys: keys}}, nil
+	}
+	return providerConfiguration{}, fmt.Errorf("unsupported encryption provider: %s", provider)
+}
+
+// generateKey creates a random 32 byte key named after the current time
+// a random suffix keeps the names of keys rotated within the same second apart
+func generateKey() (key, error) {
+	secret := make([]byte, keySize)
+	if _, err := rand.Read(secret); err != nil {
+		return key{}, fmt.Errorf("failed to generate encryption key: %v", err)
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return key{}, fmt.Errorf("failed to generate encryption key name: %v", err)
+	}
+
+	return key{
+		Name:   fmt.Sprintf("key-%d-%s", time.Now().Unix(), hex.EncodeToString(suffix)),
+		Secret: base64.StdEncoding.EncodeToString(secret),
+	}, nil
+}
+
+// readConfig reads the encryption configuration from disk
+func readConfig(configFile string) (*encryptionConfiguration, error) {
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read encryption config: %v", err)
+	}
+
+	config := &encryptionConfiguration{}
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("failed to parse encryption config: %v", err)
+	}
+	return config, nil
+}
+
+// writeConfig atomically writes the encryption configuration so the API server never reloads a partial file
+func writeConfig(configFile string, config *encryptionConfiguration) error {
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("failed to marshal encryption config: %v", err)
+	}
+
+	tmpFile := configFile + ".tmp"
+	if err := os.WriteFile(tmpFile, data, 0600); err != nil {
+		return fmt.Errorf("failed to write encryption config: %v", err)
+	}
+	if err := os.Rename(tmpFile, configFile); err != nil {
+		return fmt.Errorf("failed to replace encryption config: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package encryption
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/rs/zerolog/log"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// secretsKeyPrefix is the storage key prefix of secrets with the default etcd prefix of the API server
+const secretsKeyPrefix = "/registry/secrets/"
+
+// ReencryptSecrets rewrites every secret in the cluster so the API server stores it with the active key
+// it returns the number of secrets rewritten and an error if any secret could not be rewritten
+func ReencryptSecrets(ctx context.Context, clientset *kubernetes.Clientset) (int, error) {
+	secrets, err := clientset.CoreV1().Secrets(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return 0, fmt.Errorf("failed to list secrets: %v", err)
+	}
+
+	rewritten := 0
+	failed := 0
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+		_, err := clientset.CoreV1().Secrets(secret.Namespace).Update(ctx, secret, metav1.UpdateOptions{})
+		if err != nil && !k8serrors.IsNotFound(err) && !k8serrors.IsConflict(err) {
+			log.Error().Str("component", "encryption").Msgf("failed to rewrite secret %s/%s: %v", secret.Namespace, secret.Name, err)
+			failed++
+			continue
+		}
+
+		// a conflict means the secret was written by someone else after the list, which already used the active key
+		rewritten++
+	}
+
+	if failed > 0 {
+		return rewritten, fmt.Errorf("failed to rewrite %d of %d secrets", failed, len(secrets.Items))
+	}
+	return rewritten, nil
+}
+
+// VerifyActiveKey reads every secret back from the kine database and checks it is stored with the active key
+// the API server only uses a rotated key once it has reloaded the encryption configuration,
+// so secrets rewritten before the reload are still encrypted with an old key that must not be removed
+func VerifyActiveKey(databasePath, configFile string) error {
+	status, err := GetStatus(configFile)
+	if err != nil {
+		return err
+	}
+	prefix := []byte(fmt.Sprintf("k8s:enc:%s:v1:%s:", status.Provider, status.ActiveKey))
+
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?mode=ro&_busy_timeout=30000", databasePath))
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	// kine keeps every revision of a key, only the latest one of each live secret matters
+	rows, err := db.Query(`SELECT name, value FROM kine WHERE id IN (
+		SELECT MAX(id) FROM kine WHERE name LIKE ? GROUP BY name
+	) AND deleted = 0`, secretsKeyPrefix+"%")
+	if err != nil {
+		return fmt.Errorf("failed to read secrets from the database: %v", err)
+	}
+	defer rows.Close()
+
+	stale := []string{}
+	for rows.Next() {
+		var name string
+		var value []byte
+		if err := rows.Scan(&name, &value); err != nil {
+			return fmt.Errorf("failed to read secret from the database: %v", err)
+		}
+		if !bytes.HasPrefix(value, prefix) {
+			stale = append(stale, strings.TrimPrefix(name, secretsKeyPrefix))
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read secrets from the database: %v", err)
+	}
+
+	if len(stale) > 0 {
+		return fmt.Errorf("%d secret(s) are not stored with the active key %s, the API server may not have reloaded the encryption config yet: %s",
+			len(stale), status.ActiveKey, strings.Join(stale, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package encryption
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVerifyActiveKey(t *testing.T) {
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "encryption-config.yaml")
+	if err := EnsureEncryptionConfig(configFile, ProviderAESCBC); err != nil {
+		t.Fatal(err)
+	}
+	oldStatus, err := GetStatus(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	activeKey, err := RotateKey(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldValue := "k8s:enc:aescbc:v1:" + oldStatus.ActiveKey + ":data"
+	newValue := "k8s:enc:aescbc:v1:" + activeKey + ":data"
+
+	tests := []struct {
+		name    string
+		rows    [][3]any // name, value, deleted
+		wantErr string
+	}{
+		{
+			name: "all secrets use the active key",
+			rows: [][3]any{
+				{"/registry/secrets/default/a", newValue, 0},
+				{"/registry/secrets/default/b", newValue, 0},
+			},
+		},
+		{
+			name: "an older revision with the old key is ignored",
+			rows: [][3]any{
+				{"/registry/secrets/default/a", oldValue, 0},
+				{"/registry/secrets/default/a", newValue, 0},
+			},
+		},
+		{
+			name: "a deleted secret is ignored",
+			rows: [][3]any{
+				{"/registry/secrets/default/a", oldValue, 0},
+				{"/registry/secrets/default/a", oldValue, 1},
+			},
+		},
+		{
+			name: "other resources are ignored",
+			rows: [][3]any{
+				{"/registry/configmaps/default/a", "plain", 0},
+			},
+		},
+		{
+			name: "a secret still stored with the old key fails",
+			rows: [][3]any{
+				{"/registry/secrets/default/a", newValue, 0},
+				{"/registry/secrets/kube-system/b", oldValue, 0},
+			},
+			wantErr: "kube-system/b",
+		},
+		{
+			name: "a key name sharing the active key prefix fails",
+			rows: [][3]any{
+				{"/registry/secrets/default/a", "k8s:enc:aescbc:v1:" + activeKey + "0:data", 0},
+			},
+			wantErr: "default/a",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			databasePath := filepath.Join(t.TempDir(), "state.db")
+			db, err := sql.Open("sqlite3", databasePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := db.Exec("CREATE TABLE kine (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT, deleted INTEGER, value BLOB)"); err != nil {
+				t.Fatal(err)
+			}
+			for _, row := range tt.rows {
+				if _, err := db.Exec("INSERT INTO kine (name, value, deleted) VALUES (?, ?, ?)", row[0], []byte(row[1].(string)), row[2]); err != nil {
+					t.Fatal(err)
+				}
+			}
+			db.Close()
+
+			err = VerifyActiveKey(databasePath, configFile)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("expected an error mentioning %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestGenerateKeyNamesAreUnique(t *testing.T) {
+	names := map[string]bool{}
+	for range 100 {
+		k, err := generateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if names[k.Name] {
+			t.Fatalf("duplicate key name %s", k.Name)
+		}
+		names[k.Name] = true
+	}
+}
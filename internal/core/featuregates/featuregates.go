@@ -0,0 +1,95 @@
+package featuregates
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"k8s.io/apiserver/pkg/server/resourceconfig"
+	serverstore "k8s.io/apiserver/pkg/server/storage"
+	utilfeature "k8s.io/apiserver/pkg/util/feature"
+	cliflag "k8s.io/component-base/cli/flag"
+	"k8s.io/kubernetes/pkg/api/legacyscheme"
+
+	// registers the feature gates of the embedded Kubernetes components with the default feature gate
+	_ "k8s.io/kubernetes/pkg/features"
+)
+
+// Gates maps feature gate names to whether they are enabled
+// the components run in a single process and share one feature gate, so they must all be given the same gates
+type Gates map[string]bool
+
+// Parse parses a comma separated list of Name=true|false feature gates
+// it fails on gates the embedded Kubernetes version does not know and on GA or deprecated gates locked to their default
+func Parse(list string) (Gates, error) {
+	gates := Gates{}
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		name, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("feature gate %q must be set as Name=true or Name=false", entry)
+		}
+		enabled, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for feature gate %q: %v", name, err)
+		}
+		gates[strings.TrimSpace(name)] = enabled
+	}
+
+	// the gates are checked on a copy, the components set the shared feature gate themselves when they start
+	if err := utilfeature.DefaultMutableFeatureGate.DeepCopy().SetFromMap(gates); err != nil {
+		return nil, fmt.Errorf("invalid feature gates: %v", err)
+	}
+	return gates, nil
+}
+
+// With returns the gates with the defaults of a component added, the gates set by the user take precedence
+func (g Gates) With(defaults map[string]bool) Gates {
+	merged := maps.Clone(defaults)
+	if merged == nil {
+		merged = Gates{}
+	}
+	maps.Copy(merged, g)
+	return merged
+}
+
+// String returns the gates in the Name=true|false format of the --feature-gates flag, sorted by name
+func (g Gates) String() string {
+	entries := make([]string, 0, len(g))
+	for _, name := range slices.Sorted(maps.Keys(g)) {
+		entries = append(entries, name+"="+strconv.FormatBool(g[name]))
+	}
+	return strings.Join(entries, ",")
+}
+
+// ParseRuntimeConfig validates a comma separated list of API server runtime-config entries such as
+// api/alpha=true or resource.k8s.io/v1beta1=true and returns it in the format of the --runtime-config flag
+// the entries are checked against the API groups registered by the embedded API server
+func ParseRuntimeConfig(list string) (string, error) {
+	runtimeConfig := cliflag.ConfigurationMap{}
+	entries := []string{}
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if err := runtimeConfig.Set(entry); err != nil {
+			return "", fmt.Errorf("invalid runtime config %q: %v", entry, err)
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) == 0 {
+		return "", nil
+	}
+
+	if _, err := resourceconfig.MergeAPIResourceConfigs(serverstore.NewResourceConfig(), runtimeConfig, legacyscheme.Scheme); err != nil {
+		return "", fmt.Errorf("invalid runtime config: %v", err)
+	}
+	return strings.Join(entries, ","), nil
+}
@@ -0,0 +1,116 @@
+package featuregates
+
+import (
+	"maps"
+	"testing"
+
+	// registers the batch API group so runtime config entries are checked against its versions
+	_ "k8s.io/kubernetes/pkg/apis/batch/install"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		list    string
+		expect  Gates
+		wantErr bool
+	}{
+		{name: "empty", list: "", expect: Gates{}},
+		{name: "single gate", list: "InPlacePodVerticalScaling=true", expect: Gates{"InPlacePodVerticalScaling": true}},
+		{
+			name:   "spaces and empty entries",
+			list:   " InPlacePodVerticalScaling = true ,, SidecarContainers=false,",
+			expect: Gates{"InPlacePodVerticalScaling": true, "SidecarContainers": false},
+		},
+		{name: "missing value", list: "InPlacePodVerticalScaling", wantErr: true},
+		{name: "invalid value", list: "InPlacePodVerticalScaling=maybe", wantErr: true},
+		{name: "unknown gate", list: "NotAGate=true", wantErr: true},
+		{name: "gate locked to its default", list: "DisableKubeletCloudCredentialProviders=false", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gates, err := Parse(tt.list)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !maps.Equal(gates, tt.expect) {
+				t.Errorf("Parse() = %v, expected %v", gates, tt.expect)
+			}
+		})
+	}
+}
+
+func TestGatesWith(t *testing.T) {
+	tests := []struct {
+		name     string
+		gates    Gates
+		defaults map[string]bool
+		expect   Gates
+	}{
+		{name: "no defaults", gates: Gates{"A": true}, expect: Gates{"A": true}},
+		{name: "no gates", defaults: map[string]bool{"B": false}, expect: Gates{"B": false}},
+		{name: "user gates take precedence", gates: Gates{"A": true}, defaults: map[string]bool{"A": false, "B": true}, expect: Gates{"A": true, "B": true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defaults := maps.Clone(tt.defaults)
+			if got := tt.gates.With(tt.defaults); !maps.Equal(got, tt.expect) {
+				t.Errorf("With() = %v, expected %v", got, tt.expect)
+			}
+			if !maps.Equal(tt.defaults, defaults) {
+				t.Errorf("With() changed the defaults to %v", tt.defaults)
+			}
+		})
+	}
+}
+
+func TestGatesString(t *testing.T) {
+	tests := []struct {
+		name   string
+		gates  Gates
+		expect string
+	}{
+		{name: "empty", gates: Gates{}, expect: ""},
+		{name: "sorted by name", gates: Gates{"B": false, "A": true}, expect: "A=true,B=false"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.gates.String(); got != tt.expect {
+				t.Errorf("String() = %q, expected %q", got, tt.expect)
+			}
+		})
+	}
+}
+
+func TestParseRuntimeConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		list    string
+		expect  string
+		wantErr bool
+	}{
+		{name: "empty", list: " , ", expect: ""},
+		{name: "all alpha APIs", list: "api/alpha=true", expect: "api/alpha=true"},
+		{name: "group version", list: " batch/v1=false , api/beta=true ", expect: "batch/v1=false,api/beta=true"},
+		{name: "resource", list: "batch/v1/cronjobs=false", expect: "batch/v1/cronjobs=false"},
+		{name: "group served by an aggregated API", list: "metrics.k8s.io/v1beta1=true", expect: "metrics.k8s.io/v1beta1=true"},
+		{name: "invalid value", list: "api/alpha=maybe", wantErr: true},
+		{name: "unknown version of a registered group", list: "batch/v9=true", wantErr: true},
+		{name: "resource that is not lowercase", list: "batch/v1/CronJobs=false", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRuntimeConfig(tt.list)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRuntimeConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.expect {
+				t.Errorf("ParseRuntimeConfig() = %q, expected %q", got, tt.expect)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package kubeconfig
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/portainer/kubesolo/types"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+const (
+	clusterName = "kubesolo"
+	userName    = "kubernetes-admin"
+	contextName = "kubernetes-admin@" + clusterName
+)
+
+// certificateData holds the contents of certificate files
+type certificateData struct {
+	adminCert []byte
+	adminKey  []byte
+	ca        []byte
+}
+
+// GenerateAdminKubeconfig creates the admin kubeconfig with the certificates embedded, so it can be copied off the device
+// it also creates the component kubeconfig used by the in-process components
+func GenerateAdminKubeconfig(embedded types.Embedded) error {
+	if err := verifyCertificateFiles(embedded.AdminCerts.Cert, embedded.AdminCerts.Key, embedded.CACerts.Bundle); err != nil {
+		return err
+	}
+
+	certData, err := readCertificateFiles(embedded)
+	if err != nil {
+		return err
+	}
+
+	if err := writeKubeConfig(createAdminKubeConfig(certData), embedded.AdminKubeconfigFile); err != nil {
+		return err
+	}
+
+	return writeKubeConfig(createComponentKubeConfig(embedded), embedded.ComponentKubeconfigFile)
+}
+
+// verifyCertificateFiles checks if all required certificate files exist
+func verifyCertificateFiles(paths ...string) error {
+	for _, path := range paths {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return fmt.Errorf("required certificate file not found: %s", path)
+		}
+	}
+	return nil
+}
+
+// readCertificateFiles reads all required certificate files
+func readCertificateFiles(embedded types.Embedded) (*certificateData, error) {
+	adminCert, err := os.ReadFile(embedded.AdminCerts.Cert)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read admin certificate: %v", err)
+	}
+
+	adminKey, err := os.ReadFile(embedded.AdminCerts.Key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read admin key: %v", err)
+	}
+
+	ca, err := os.ReadFile(embedded.CACerts.Bundle)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA certificate: %v", err)
+	}
+
+	return &certificateData{
+		adminCert: adminCert,
+		adminKey:  adminKey,
+		ca:        ca,
+	}, nil
+}
+
+// createAdminKubeConfig creates a new kubeconfig with the provided certificate data
+// tokens for other clients are issued with the token command
+func createAdminKubeConfig(certData *certificateData) *api.Config {
+	kubeConfig := api.NewConfig()
+	kubeConfig.Clusters[clusterName] = &api.Cluster{
+		Server:                   types.DefaultAPIServerAddress,
+		CertificateAuthorityData: certData.ca,
+	}
+	kubeConfig.AuthInfos[userName] = &api.AuthInfo{
+		ClientCertificateData: certData.adminCert,
+		ClientKeyData:         certData.adminKey,
+	}
+	kubeConfig.Contexts[contextName] = &api.Context{
+		Cluster:  clusterName,
+		AuthInfo: userName,
+	}
+	kubeConfig.CurrentContext = contextName
+
+	return kubeConfig
+}
+
+// createComponentKubeConfig creates a kubeconfig for the in-process components that references the admin certificate files
+// clients built from file references reload the certificate when it is renewed, embedded data would be loaded only once
+func createComponentKubeConfig(embedded types.Embedded) *api.Config {
+	kubeConfig := api.NewConfig()
+	kubeConfig.Clusters[clusterName] = &api.Cluster{
+		Server:               types.DefaultAPIServerAddress,
+		CertificateAuthority: embedded.CACerts.Bundle,
+	}
+	kubeConfig.AuthInfos[userName] = &api.AuthInfo{
+		ClientCertificate: embedded.AdminCerts.Cert,
+		ClientKey:         embedded.AdminCerts.Key,
+	}
+	kubeConfig.Contexts[contextName] = &api.Context{
+		Cluster:  clusterName,
+		AuthInfo: userName,
+	}
+	kubeConfig.CurrentContext = contextName
+
+	return kubeConfig
+}
+
+// writeKubeConfig writes the kubeconfig to the specified file
+func writeKubeConfig(config *api.Config, path string) error {
+	if err := clientcmd.WriteToFile(*config, path); err != nil {
+		return fmt.Errorf("failed to write kubeconfig file: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package kubeconfig
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/portainer/kubesolo/types"
+	"gopkg.in/yaml.v2"
+)
+
+// GenerateKubeletKubeconfig creates the kubelet kubeconfig, it references the kubelet certificate files
+func GenerateKubeletKubeconfig(embedded types.Embedded, nodeName string) error {
+	kubeconfigMap := map[string]any{
+		"apiVersion": "v1",
+		"kind":       "Config",
+		"clusters": []map[string]any{
+			{
+				"name": "kubernetes",
+				"cluster": map[string]any{
+					"certificate-authority": embedded.CACerts.Bundle,
+					"server":                types.DefaultAPIServerAddress,
+				},
+			},
+		},
+		"users": []map[string]any{
+			{
+				"name": fmt.Sprintf("system:node:%s", nodeName),
+				"user": map[string]any{
+					"client-certificate": embedded.KubeletCerts.Cert,
+					"client-key":         embedded.KubeletCerts.Key,
+				},
+			},
+		},
+		"contexts": []map[string]any{
+			{
+				"name": fmt.Sprintf("system:node:%s@kubernetes", nodeName),
+				"context": map[string]any{
+					"cluster": "kubernetes",
+					"user":    fmt.Sprintf("system:node:%s", nodeName),
+				},
+			},
+		},
+		"current-context": fmt.Sprintf("system:node:%s@kubernetes", nodeName),
+	}
+
+	yamlData, err := yaml.Marshal(kubeconfigMap)
+	if err != nil {
+		return fmt.Errorf("failed to marshal kubelet kubeconfig: %v", err)
+	}
+
+	if err := os.WriteFile(embedded.KubeletKubeConfigFile, yamlData, 0600); err != nil {
+		return fmt.Errorf("failed to write kubelet kubeconfig: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package kubeconfig
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+
+	"github.com/portainer/kubesolo/types"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// BuildUserKubeconfig returns a kubeconfig for a user authenticating with the given client certificate and key
+// the server is the URL the user reaches the API server on, the CA bundle is embedded so the kubeconfig is self-contained
+func BuildUserKubeconfig(embedded types.Embedded, server, user string, certPEM, keyPEM []byte) ([]byte, error) {
+	return buildKubeconfig(embedded, server, user, &api.AuthInfo{
+		ClientCertificateData: certPEM,
+		ClientKeyData:         keyPEM,
+	})
+}
+
+// BuildTokenKubeconfig returns a kubeconfig for a user authenticating with the given bearer token
+func BuildTokenKubeconfig(embedded types.Embedded, server, user, token string) ([]byte, error) {
+	return buildKubeconfig(embedded, server, user, &api.AuthInfo{
+		Token: token,
+	})
+}
+
+// BuildOIDCKubeconfig returns a kubeconfig that signs the user in with the OIDC provider through the kubectl oidc-login plugin
+// the CA of the provider is embedded when it is set, so the kubeconfig works on machines that do not trust it
+func BuildOIDCKubeconfig(embedded types.Embedded, server, issuerURL, clientID, clientSecret string, extraScopes []string, issuerCA []byte) ([]byte, error) {
+	args := []string{
+		"oidc-login",
+		"get-token",
+		"--oidc-issuer-url=" + issuerURL,
+		"--oidc-client-id=" + clientID,
+	}
+	if clientSecret != "" {
+		args = append(args, "--oidc-client-secret="+clientSecret)
+	}
+	for _, scope := range extraScopes {
+		args = append(args, "--oidc-extra-scope="+scope)
+	}
+	if len(issuerCA) > 0 {
+		args = append(args, "--certificate-authority-data="+base64.StdEncoding.EncodeToString(issuerCA))
+	}
+
+	return buildKubeconfig(embedded, server, "oidc", &api.AuthInfo{
+		Exec: &api.ExecConfig{
+			APIVersion:      "client.authentication.k8s.io/v1beta1",
+			Command:         "kubectl",
+			Args:            args,
+			InteractiveMode: api.IfAvailableExecInteractiveMode,
+			InstallHint:     "install the kubectl oidc-login plugin: https://github.com/int128/kubelogin",
+		},
+	})
+}
+
+// buildKubeconfig returns a serialized kubeconfig with a single context for the user and the kubesolo cluster
+func buildKubeconfig(embedded types.Embedded, server, user string, authInfo *api.AuthInfo) ([]byte, error) {
+	ca, err := os.ReadFile(embedded.CACerts.Bundle)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA bundle: %v", err)
+	}
+
+	userContext := user + "@" + clusterName
+
+	kubeConfig := api.NewConfig()
+	kubeConfig.Clusters[clusterName] = &api.Cluster{
+		Server:                   server,
+		CertificateAuthorityData: ca,
+	}
+	kubeConfig.AuthInfos[user] = authInfo
+	kubeConfig.Contexts[userContext] = &api.Context{
+		Cluster:  clusterName,
+		AuthInfo: user,
+	}
+	kubeConfig.CurrentContext = userContext
+
+	data, err := clientcmd.Write(*kubeConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize kubeconfig: %v", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,168 @@
+package kubeconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/portainer/kubesolo/types"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// newTestIssuer starts an OIDC issuer serving its discovery document and returns it with its CA certificate
+func newTestIssuer(t *testing.T) (*httptest.Server, []byte) {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	issuer := httptest.NewTLSServer(mux)
+	t.Cleanup(issuer.Close)
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"issuer":   issuer.URL,
+			"jwks_uri": issuer.URL + "/keys",
+		})
+	})
+	return issuer, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: issuer.Certificate().Raw})
+}
+
+// testEmbedded returns the embedded paths with a cluster CA bundle written to a temporary directory
+func testEmbedded(t *testing.T) types.Embedded {
+	t.Helper()
+
+	bundle := filepath.Join(t.TempDir(), "ca-bundle.crt")
+	if err := os.WriteFile(bundle, []byte("cluster-ca"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	embedded := types.Embedded{}
+	embedded.CACerts.Bundle = bundle
+	return embedded
+}
+
+// execArg returns the value of the --name= argument of the exec plugin, and whether it is set
+func execArg(args []string, name string) (string, bool) {
+	for _, arg := range args {
+		if value, ok := strings.CutPrefix(arg, "--"+name+"="); ok {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+func TestBuildOIDCKubeconfig(t *testing.T) {
+	issuer, issuerCA := newTestIssuer(t)
+	embedded := testEmbedded(t)
+
+	tests := []struct {
+		name         string
+		clientSecret string
+		extraScopes  []string
+		issuerCA     []byte
+	}{
+		{name: "public client"},
+		{name: "confidential client", clientSecret: "s3cret"},
+		{name: "extra scopes and issuer CA", extraScopes: []string{"email", "groups"}, issuerCA: issuerCA},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := BuildOIDCKubeconfig(embedded, "https://10.0.0.2:6443", issuer.URL, "kubesolo", tt.clientSecret, tt.extraScopes, tt.issuerCA)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			config, err := clientcmd.Load(data)
+			if err != nil {
+				t.Fatalf("failed to load kubeconfig: %v", err)
+			}
+
+			kubeContext := config.Contexts[config.CurrentContext]
+			if kubeContext == nil || kubeContext.AuthInfo != "oidc" {
+				t.Fatalf("current context %q does not use the oidc user", config.CurrentContext)
+			}
+			cluster := config.Clusters[kubeContext.Cluster]
+			if cluster == nil || cluster.Server != "https://10.0.0.2:6443" || string(cluster.CertificateAuthorityData) != "cluster-ca" {
+				t.Fatalf("unexpected cluster %+v", cluster)
+			}
+
+			exec := config.AuthInfos["oidc"].Exec
+			if exec == nil {
+				t.Fatal("the oidc user has no exec stanza")
+			}
+			if exec.Command != "kubectl" || exec.APIVersion != "client.authentication.k8s.io/v1beta1" || exec.InteractiveMode != api.IfAvailableExecInteractiveMode {
+				t.Errorf("unexpected exec stanza %+v", exec)
+			}
+			if !slices.Equal(exec.Args[:2], []string{"oidc-login", "get-token"}) {
+				t.Errorf("exec args %v do not start with oidc-login get-token", exec.Args)
+			}
+			if value, _ := execArg(exec.Args, "oidc-issuer-url"); value != issuer.URL {
+				t.Errorf("issuer URL %q, expected %q", value, issuer.URL)
+			}
+			if value, _ := execArg(exec.Args, "oidc-client-id"); value != "kubesolo" {
+				t.Errorf("client ID %q, expected kubesolo", value)
+			}
+			if value, ok := execArg(exec.Args, "oidc-client-secret"); ok != (tt.clientSecret != "") || value != tt.clientSecret {
+				t.Errorf("client secret %q, expected %q", value, tt.clientSecret)
+			}
+			scopes := []string{}
+			for _, arg := range exec.Args {
+				if scope, ok := strings.CutPrefix(arg, "--oidc-extra-scope="); ok {
+					scopes = append(scopes, scope)
+				}
+			}
+			if !slices.Equal(scopes, tt.extraScopes) {
+				t.Errorf("extra scopes %v, expected %v", scopes, tt.extraScopes)
+			}
+
+			value, ok := execArg(exec.Args, "certificate-authority-data")
+			if ok != (len(tt.issuerCA) > 0) {
+				t.Fatalf("certificate-authority-data set = %v, expected %v", ok, len(tt.issuerCA) > 0)
+			}
+			if !ok {
+				return
+			}
+
+			// the plugin reaches the issuer with the embedded CA on a machine that does not trust it
+			caPEM, err := base64.StdEncoding.DecodeString(value)
+			if err != nil {
+				t.Fatalf("invalid certificate-authority-data: %v", err)
+			}
+			roots := x509.NewCertPool()
+			if !roots.AppendCertsFromPEM(caPEM) {
+				t.Fatal("certificate-authority-data holds no certificate")
+			}
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+			resp, err := client.Get(issuer.URL + "/.well-known/openid-configuration")
+			if err != nil {
+				t.Fatalf("failed to reach the issuer with the embedded CA: %v", err)
+			}
+			defer resp.Body.Close()
+			discovery := struct {
+				Issuer string `json:"issuer"`
+			}{}
+			if err := json.NewDecoder(resp.Body).Decode(&discovery); err != nil {
+				t.Fatal(err)
+			}
+			if discovery.Issuer != issuer.URL {
+				t.Errorf("discovery issuer %q does not match the kubeconfig issuer %q", discovery.Issuer, issuer.URL)
+			}
+		})
+	}
+}
+
+func TestBuildOIDCKubeconfigWithoutCABundle(t *testing.T) {
+	embedded := types.Embedded{}
+	embedded.CACerts.Bundle = filepath.Join(t.TempDir(), "missing.crt")
+	if _, err := BuildOIDCKubeconfig(embedded, "https://10.0.0.2:6443", "https://issuer.example.com", "kubesolo", "", nil, nil); err == nil {
+		t.Fatal("expected an error without a CA bundle")
+	}
+}
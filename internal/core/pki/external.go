@@ -0,0 +1,232 @@
+package pki
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/portainer/kubesolo/internal/runtime/filesystem"
+	"github.com/portainer/kubesolo/types"
+	"github.com/rs/zerolog/log"
+)
+
+// installExternalCA copies the operator-supplied CA into the pki directory, replacing the current CA when it differs
+// the first certificate of the supplied file is the signing CA, the remaining ones are its chain up to the root
+// the replaced CA files are kept with a .previous suffix, leaf certificates issued by them are reissued afterwards
+func installExternalCA(opts CertOptions, externalCA ExternalCA, chainPath string) error {
+	if externalCA.CertFile == "" || externalCA.KeyFile == "" {
+		return fmt.Errorf("both the CA certificate and the CA key must be supplied")
+	}
+
+	certs, err := readCertificates(externalCA.CertFile)
+	if err != nil {
+		return err
+	}
+	caCert, chain := certs[0], certs[1:]
+
+	if !caCert.IsCA {
+		return fmt.Errorf("%s is not a CA certificate", externalCA.CertFile)
+	}
+	if caCert.KeyUsage != 0 && caCert.KeyUsage&x509.KeyUsageCertSign == 0 {
+		return fmt.Errorf("%s is not allowed to sign certificates", externalCA.CertFile)
+	}
+	if time.Now().After(caCert.NotAfter) {
+		return fmt.Errorf("%s expired on %s", externalCA.CertFile, caCert.NotAfter.Format(time.RFC3339))
+	}
+
+	keyPEMBlock, err := os.ReadFile(externalCA.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to read CA key file: %v", err)
+	}
+	keyDERBlock, _ := pem.Decode(keyPEMBlock)
+	if keyDERBlock == nil {
+		return fmt.Errorf("failed to parse CA key PEM data")
+	}
+	key, err := parsePrivateKey(keyDERBlock)
+	if err != nil {
+		return err
+	}
+	if !keyMatchesCertificate(key, caCert) {
+		return fmt.Errorf("the CA key does not match the CA certificate")
+	}
+
+	if err := verifyCAChain(caCert, chain); err != nil {
+		return err
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caCert.Raw})
+	keyPEM, err := EncodePrivateKey(key)
+	if err != nil {
+		return err
+	}
+	chainPEM := []byte{}
+	for _, cert := range chain {
+		chainPEM = append(chainPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+
+	if sameFileContent(opts.CertDir, certPEM) && sameFileContent(opts.KeyDir, keyPEM) && sameFileContent(chainPath, chainPEM) {
+		return nil
+	}
+
+	if err := ensureCertificateDirectories(opts); err != nil {
+		return err
+	}
+	for _, path := range []string{opts.CertDir, opts.KeyDir} {
+		if filesystem.FileExists(path) {
+			if err := backupFile(path); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := writeFileAtomically(chainPath, chainPEM, 0644); err != nil {
+		return fmt.Errorf("failed to write CA chain: %v", err)
+	}
+	if err := replaceCertificateAndKey(opts.CertDir, certPEM, opts.KeyDir, keyPEM); err != nil {
+		return fmt.Errorf("failed to write CA: %v", err)
+	}
+
+	log.Info().Str("component", "pki").Msgf("installed the supplied CA %s issued by %s", caCert.Subject.CommonName, caCert.Issuer.CommonName)
+	return nil
+}
+
+// verifyCAChain checks that the supplied chain links the CA certificate to a root
+// the self-signed certificates of the chain are the roots, when there is none the last certificate is used as the root
+// a CA supplied without a chain is accepted, clients then have to trust it or its issuer directly
+func verifyCAChain(caCert *x509.Certificate, chain []*x509.Certificate) error {
+	if len(chain) == 0 {
+		if !isSelfSigned(caCert) {
+			log.Warn().Str("component", "pki").Msgf("the supplied CA is issued by %s but no chain was supplied, clients must trust the issuer directly", caCert.Issuer.CommonName)
+		}
+		return nil
+	}
+
+	roots := x509.NewCertPool()
+	intermediates := x509.NewCertPool()
+	hasRoot := false
+	for _, cert := range chain {
+		if isSelfSigned(cert) {
+			roots.AddCert(cert)
+			hasRoot = true
+		} else {
+			intermediates.AddCert(cert)
+		}
+	}
+	if !hasRoot {
+		roots.AddCert(chain[len(chain)-1])
+	}
+
+	if _, err := caCert.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return fmt.Errorf("the supplied chain does not verify the CA certificate: %v", err)
+	}
+	return nil
+}
+
+// issuerChain returns the certificates a leaf certificate is written with after its own,
+// so clients that only trust the root of an operator-supplied CA can build the path to it
+// self-signed certificates are left out, clients have to trust those directly
+func issuerChain(opts CertOptions) ([][]byte, error) {
+	if opts.SignerChainDir == "" || !filesystem.FileExists(opts.SignerChainDir) {
+		return nil, nil
+	}
+
+	signer, err := readCertificate(opts.SignerCertDir)
+	if err != nil {
+		return nil, err
+	}
+	chain := []*x509.Certificate{signer}
+
+	data, err := os.ReadFile(opts.SignerChainDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA chain: %v", err)
+	}
+	certs, err := parseCertificates(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CA chain: %v", err)
+	}
+	chain = append(chain, certs...)
+
+	issuers := [][]byte{}
+	for _, cert := range chain {
+		if !isSelfSigned(cert) {
+			issuers = append(issuers, cert.Raw)
+		}
+	}
+	return issuers, nil
+}
+
+// writeCABundle writes the CA certificates followed by the chain of an operator-supplied CA to the bundle file
+// the file is only rewritten when its content changes
+func writeCABundle(paths types.CACertificatePaths) error {
+	bundle, err := os.ReadFile(paths.Cert)
+	if err != nil {
+		return fmt.Errorf("failed to read CA certificate: %v", err)
+	}
+
+	if filesystem.FileExists(paths.Chain) {
+		chain, err := os.ReadFile(paths.Chain)
+		if err != nil {
+			return fmt.Errorf("failed to read CA chain: %v", err)
+		}
+		bundle = append(bundle, chain...)
+	}
+
+	if sameFileContent(paths.Bundle, bundle) {
+		return nil
+	}
+	if err := writeFileAtomically(paths.Bundle, bundle, 0644); err != nil {
+		return fmt.Errorf("failed to write CA bundle: %v", err)
+	}
+	return nil
+}
+
+// readCertificates reads every certificate of a PEM file, it fails when the file holds none
+func readCertificates(path string) ([]*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+
+	certs, err := parseCertificates(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificate found in %s", path)
+	}
+	return certs, nil
+}
+
+// parseCertificates parses every CERTIFICATE block of PEM data, other blocks are ignored
+func parseCertificates(data []byte) ([]*x509.Certificate, error) {
+	certs := []*x509.Certificate{}
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+// isSelfSigned reports whether the certificate is issued and signed by itself
+func isSelfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, cert.RawSubject) && cert.CheckSignatureFrom(cert) == nil
+}
+
+// sameFileContent reports whether the file exists and holds exactly the data
+func sameFileContent(path string, data []byte) bool {
+	existing, err := os.ReadFile(path)
+	return err == nil && bytes.Equal(existing, data)
+}
@@ -0,0 +1,91 @@
+package pki
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// CertificateInfo describes a certificate found on disk
+type CertificateInfo struct {
+	File     string
+	Subject  string
+	Issuer   string
+	SANs     []string
+	IsCA     bool
+	NotAfter time.Time
+}
+
+// ListCertificates returns every certificate found in the .crt files under the directory
+// files holding a bundle return one entry per certificate
+func ListCertificates(dir string) ([]CertificateInfo, error) {
+	certs := []CertificateInfo{}
+
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || filepath.Ext(path) != ".crt" {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", path, err)
+		}
+
+		parsed, err := parseCertificates(data)
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %v", path, err)
+		}
+		for _, cert := range parsed {
+			certs = append(certs, newCertificateInfo(path, cert))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return certs, nil
+}
+
+// newCertificateInfo extracts the fields shown to operators from a parsed certificate
+func newCertificateInfo(path string, cert *x509.Certificate) CertificateInfo {
+	sans := append([]string{}, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+
+	return CertificateInfo{
+		File:     path,
+		Subject:  formatName(cert.Subject.CommonName, cert.Subject.Organization),
+		Issuer:   formatName(cert.Issuer.CommonName, cert.Issuer.Organization),
+		SANs:     sans,
+		IsCA:     cert.IsCA,
+		NotAfter: cert.NotAfter,
+	}
+}
+
+// formatName formats a common name and organization as CN=name,O=org
+func formatName(commonName string, organization []string) string {
+	name := "CN=" + commonName
+	if len(organization) > 0 {
+		name += ",O=" + strings.Join(organization, "+")
+	}
+	return name
+}
+
+// ParseCertificateType returns the leaf certificate type with the given name
+func ParseCertificateType(name string) (CertificateType, error) {
+	for _, certType := range leafCertificateTypes {
+		if string(certType) == name {
+			return certType, nil
+		}
+	}
+	return "", fmt.Errorf("unknown certificate %q, expected one of %v", name, leafCertificateTypes)
+}
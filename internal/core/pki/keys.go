@@ -0,0 +1,125 @@
+package pki
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+)
+
+// KeyAlgorithm is the algorithm of the private keys generated for certificates
+type KeyAlgorithm string
+
+const (
+	// KeyAlgorithmRSA generates RSA keys of CertOptions.KeySize bits
+	KeyAlgorithmRSA KeyAlgorithm = "rsa"
+	// KeyAlgorithmECDSAP256 generates ECDSA keys on the P-256 curve
+	KeyAlgorithmECDSAP256 KeyAlgorithm = "ecdsa-p256"
+	// KeyAlgorithmECDSAP384 generates ECDSA keys on the P-384 curve
+	KeyAlgorithmECDSAP384 KeyAlgorithm = "ecdsa-p384"
+	// KeyAlgorithmEd25519 generates Ed25519 keys
+	KeyAlgorithmEd25519 KeyAlgorithm = "ed25519"
+)
+
+// rsaKeySize is the size of the RSA keys generated outside of the certificate options
+const rsaKeySize = 2048
+
+// GeneratePrivateKey creates a new private key with the given algorithm
+// RSA keys are rsaKeySize bits, use generatePrivateKey for another size
+func GeneratePrivateKey(algorithm KeyAlgorithm) (crypto.Signer, error) {
+	return generatePrivateKey(algorithm, rsaKeySize)
+}
+
+// generatePrivateKey creates a new private key with the given algorithm, keySize is only used for RSA
+func generatePrivateKey(algorithm KeyAlgorithm, keySize int) (crypto.Signer, error) {
+	var key crypto.Signer
+	var err error
+
+	switch algorithm {
+	case KeyAlgorithmRSA, "":
+		key, err = rsa.GenerateKey(rand.Reader, keySize)
+	case KeyAlgorithmECDSAP256:
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case KeyAlgorithmECDSAP384:
+		key, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case KeyAlgorithmEd25519:
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported key algorithm %q", algorithm)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate private key: %v", err)
+	}
+	return key, nil
+}
+
+// EncodePrivateKey encodes the private key as a PKCS#8 PEM block
+func EncodePrivateKey(key crypto.Signer) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal private key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// parsePrivateKey parses a PEM block holding a PKCS#1 RSA, SEC 1 EC or PKCS#8 private key
+func parsePrivateKey(block *pem.Block) (crypto.Signer, error) {
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse key: %v", err)
+		}
+		return key, nil
+
+	case "EC PRIVATE KEY":
+		key, err := x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse key: %v", err)
+		}
+		return key, nil
+
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse key: %v", err)
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported key type %T", key)
+		}
+		return signer, nil
+	}
+
+	return nil, fmt.Errorf("unsupported key PEM type %q", block.Type)
+}
+
+// keyMatchesCertificate reports whether the private key belongs to the public key of the certificate
+func keyMatchesCertificate(key crypto.Signer, cert *x509.Certificate) bool {
+	publicKey, ok := key.Public().(interface{ Equal(crypto.PublicKey) bool })
+	return ok && publicKey.Equal(cert.PublicKey)
+}
+
+// certificateKeyAlgorithm returns the key algorithm of the certificate public key
+// RSA keys of any size are reported as KeyAlgorithmRSA
+func certificateKeyAlgorithm(cert *x509.Certificate) KeyAlgorithm {
+	switch publicKey := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return KeyAlgorithmRSA
+	case *ecdsa.PublicKey:
+		switch publicKey.Curve {
+		case elliptic.P256():
+			return KeyAlgorithmECDSAP256
+		case elliptic.P384():
+			return KeyAlgorithmECDSAP384
+		}
+	case ed25519.PublicKey:
+		return KeyAlgorithmEd25519
+	}
+	return ""
+}
@@ -12,12 +12,14 @@ import (
 
 // defaultCertOptions returns default options for the specified certificate type
 // it sets the relevant fields for the certificate type, including the local IPv4 addresses
-// the supported certificate types are CACert, KubeletCert, APIServerCert, ControllerManagerCert, AdminCert, and WebhookCert
-func defaultCertOptions(certType CertificateType, embedded types.Embedded) CertOptions {
+// the supported certificate types are CACert, KubeletCert, KubeletServingCert, APIServerCert, ControllerManagerCert, AdminCert, WebhookCert,
+// FrontProxyCACert and FrontProxyClientCert
+func defaultCertOptions(certType CertificateType, embedded types.Embedded, keyAlgorithm KeyAlgorithm) CertOptions {
 	opts := CertOptions{
 		Type:         certType,
 		NotAfterDays: 365,
-		KeySize:      2048,
+		KeyAlgorithm: keyAlgorithm,
+		KeySize:      rsaKeySize,
 	}
 
 	ipAddresses := []net.IP{}
@@ -37,6 +39,15 @@ func defaultCertOptions(certType CertificateType, embedded types.Embedded) CertO
 		opts.KeyDir = embedded.CACerts.Key
 
 	case KubeletCert:
+		// the client certificate the kubelet starts with, it rotates it through certificate signing requests afterwards
+		opts.CommonName = fmt.Sprintf("system:node:%s", system.GetHostname())
+		opts.Organization = []string{"system:nodes"}
+		opts.SignerCertDir = embedded.CACerts.Cert
+		opts.SignerKeyDir = embedded.CACerts.Key
+		opts.CertDir = filepath.Join(embedded.PKIKubeletDir, "kubelet.crt")
+		opts.KeyDir = filepath.Join(embedded.PKIKubeletDir, "kubelet.key")
+
+	case KubeletServingCert:
 		hostname := system.GetHostname()
 
 		opts.CommonName = fmt.Sprintf("system:node:%s", hostname)
@@ -44,8 +55,8 @@ func defaultCertOptions(certType CertificateType, embedded types.Embedded) CertO
 		opts.DNSNames = []string{hostname, "localhost"}
 		opts.SignerCertDir = embedded.CACerts.Cert
 		opts.SignerKeyDir = embedded.CACerts.Key
-		opts.CertDir = filepath.Join(embedded.PKIKubeletDir, "kubelet.crt")
-		opts.KeyDir = filepath.Join(embedded.PKIKubeletDir, "kubelet.key")
+		opts.CertDir = embedded.KubeletCerts.ServingCert
+		opts.KeyDir = embedded.KubeletCerts.ServingKey
 		opts.IPAddresses = ipAddresses
 
 	case APIServerCert:
@@ -88,14 +99,33 @@ func defaultCertOptions(certType CertificateType, embedded types.Embedded) CertO
 		opts.KeyDir = filepath.Join(embedded.PKIAdminDir, "admin.key")
 
 	case WebhookCert:
+		// the webhook certificate also serves the resource metrics API, the aggregation layer verifies it against the name of its service
 		opts.CommonName = "kubesolo-webhook"
 		opts.Organization = []string{"system:masters"}
-		opts.DNSNames = []string{"localhost", "kubesolo-webhook", "kubesolo-webhook.default", "kubesolo-webhook.default.svc"}
+		opts.DNSNames = []string{"localhost", "kubesolo-webhook", "kubesolo-webhook.default", "kubesolo-webhook.default.svc", "kubesolo-metrics.kube-system.svc"}
 		opts.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
 		opts.SignerCertDir = embedded.CACerts.Cert
 		opts.SignerKeyDir = embedded.CACerts.Key
 		opts.CertDir = filepath.Join(embedded.PKIWebhookDir, "webhook.crt")
 		opts.KeyDir = filepath.Join(embedded.PKIWebhookDir, "webhook.key")
+
+	case FrontProxyCACert:
+		// the front-proxy CA is always self-generated, aggregated API servers only trust it for the requests the API server proxies
+		opts.CommonName = "front-proxy-ca"
+		opts.NotAfterDays = 3650
+		opts.CertDir = embedded.FrontProxyCACerts.Cert
+		opts.KeyDir = embedded.FrontProxyCACerts.Key
+
+	case FrontProxyClientCert:
+		opts.CommonName = "front-proxy-client"
+		opts.SignerCertDir = embedded.FrontProxyCACerts.Cert
+		opts.SignerKeyDir = embedded.FrontProxyCACerts.Key
+		opts.CertDir = embedded.FrontProxyClientCerts.Cert
+		opts.KeyDir = embedded.FrontProxyClientCerts.Key
+	}
+
+	if opts.SignerCertDir == embedded.CACerts.Cert {
+		opts.SignerChainDir = embedded.CACerts.Chain
 	}
 
 	return opts
@@ -1,8 +1,8 @@
 package pki
 
 import (
+	"crypto"
 	"crypto/rand"
-	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
@@ -14,58 +14,122 @@ import (
 
 	"github.com/portainer/kubesolo/internal/runtime/filesystem"
 	"github.com/portainer/kubesolo/types"
+	"github.com/rs/zerolog/log"
 )
 
 // GenerateAllCertificates creates all certificates needed for the specified component
 // it generates the CA certificate, kubelet certificate, apiserver certificate, controller-manager certificate, admin certificate, and webhook certificate
-// all certificates are generated as self-signed certificates
-func GenerateAllCertificates(embedded types.Embedded) error {
-	caOpts := defaultCertOptions(CACert, embedded)
-	if err := generateCertificate(caOpts); err != nil {
+// existing leaf certificates are reissued when they expire within config.RenewBeforeDays, their identity, SANs or key algorithm
+// changed, or they were not issued by the current CA
+// the CA is self-generated unless config.ExternalCA supplies one, an intermediate CA is installed together with its chain
+func GenerateAllCertificates(embedded types.Embedded, config Config) error {
+	caOpts := defaultCertOptions(CACert, embedded, config.KeyAlgorithm)
+	if config.ExternalCA.CertFile != "" || config.ExternalCA.KeyFile != "" {
+		if err := installExternalCA(caOpts, config.ExternalCA, embedded.CACerts.Chain); err != nil {
+			return fmt.Errorf("failed to install the supplied CA certificate: %v", err)
+		}
+	} else if err := generateCertificate(caOpts, config.RenewBeforeDays); err != nil {
 		return fmt.Errorf("failed to generate CA certificate: %v", err)
 	}
 
-	kubeletOpts := defaultCertOptions(KubeletCert, embedded)
-	if err := generateCertificate(kubeletOpts); err != nil {
+	if err := writeCABundle(embedded.CACerts); err != nil {
+		return err
+	}
+
+	frontProxyCAOpts := defaultCertOptions(FrontProxyCACert, embedded, config.KeyAlgorithm)
+	if err := generateCertificate(frontProxyCAOpts, config.RenewBeforeDays); err != nil {
+		return fmt.Errorf("failed to generate front-proxy CA certificate: %v", err)
+	}
+
+	kubeletOpts := defaultCertOptions(KubeletCert, embedded, config.KeyAlgorithm)
+	if err := generateBootstrapCertificate(kubeletOpts); err != nil {
 		return fmt.Errorf("failed to generate kubelet certificate: %v", err)
 	}
 
-	apiserverOpts := defaultCertOptions(APIServerCert, embedded)
-	if err := generateCertificate(apiserverOpts); err != nil {
+	kubeletServingOpts := defaultCertOptions(KubeletServingCert, embedded, config.KeyAlgorithm)
+	if err := generateCertificate(kubeletServingOpts, config.RenewBeforeDays); err != nil {
+		return fmt.Errorf("failed to generate kubelet serving certificate: %v", err)
+	}
+
+	apiserverOpts := defaultCertOptions(APIServerCert, embedded, config.KeyAlgorithm)
+	if err := generateCertificate(apiserverOpts, config.RenewBeforeDays); err != nil {
 		return fmt.Errorf("failed to generate apiserver certificate: %v", err)
 	}
 
-	controllerOpts := defaultCertOptions(ControllerManagerCert, embedded)
-	if err := generateCertificate(controllerOpts); err != nil {
+	controllerOpts := defaultCertOptions(ControllerManagerCert, embedded, config.KeyAlgorithm)
+	if err := generateCertificate(controllerOpts, config.RenewBeforeDays); err != nil {
 		return fmt.Errorf("failed to generate controller-manager certificate: %v", err)
 	}
 
-	adminOpts := defaultCertOptions(AdminCert, embedded)
-	if err := generateCertificate(adminOpts); err != nil {
+	adminOpts := defaultCertOptions(AdminCert, embedded, config.KeyAlgorithm)
+	if err := generateCertificate(adminOpts, config.RenewBeforeDays); err != nil {
 		return fmt.Errorf("failed to generate admin certificate: %v", err)
 	}
 
-	webhookOpts := defaultCertOptions(WebhookCert, embedded)
-	if err := generateCertificate(webhookOpts); err != nil {
+	webhookOpts := defaultCertOptions(WebhookCert, embedded, config.KeyAlgorithm)
+	if err := generateCertificate(webhookOpts, config.RenewBeforeDays); err != nil {
 		return fmt.Errorf("failed to generate webhook certificate: %v", err)
 	}
 
+	frontProxyClientOpts := defaultCertOptions(FrontProxyClientCert, embedded, config.KeyAlgorithm)
+	if err := generateCertificate(frontProxyClientOpts, config.RenewBeforeDays); err != nil {
+		return fmt.Errorf("failed to generate front-proxy client certificate: %v", err)
+	}
+
 	return nil
 }
 
 // generateCertificate creates a certificate based on the provided options
-// it ensures the certificate directories exist, checks if the certificate already exists,
-// generates a private key, creates a certificate template, signs the certificate, and writes the certificate and key to disk
-func generateCertificate(opts CertOptions) error {
+// it ensures the certificate directories exist and checks if the certificate already exists
+// an existing CA certificate is always kept, an existing leaf certificate is reissued only when it needs renewal
+func generateCertificate(opts CertOptions, renewBeforeDays int) error {
+	if err := ensureCertificateDirectories(opts); err != nil {
+		return err
+	}
+
+	if certAlreadyExists(opts.CertDir, opts.KeyDir) {
+		if isCAType(opts.Type) {
+			return nil
+		}
+
+		renew, reason, err := certNeedsRenewal(opts, renewBeforeDays)
+		if err != nil {
+			reason = err.Error()
+		} else if !renew {
+			return nil
+		}
+		log.Info().Str("component", "pki").Str("certificate", string(opts.Type)).Msgf("reissuing certificate: %s", reason)
+	}
+
+	return issueCertificate(opts)
+}
+
+// generateBootstrapCertificate creates a certificate that another component renews once it is running
+// it is only issued when it is missing, unreadable or expired, so kubesolo never replaces it while it is still usable
+func generateBootstrapCertificate(opts CertOptions) error {
 	if err := ensureCertificateDirectories(opts); err != nil {
 		return err
 	}
 
 	if certAlreadyExists(opts.CertDir, opts.KeyDir) {
-		return nil
+		cert, err := readCertificate(opts.CertDir)
+		if err == nil && time.Now().Before(cert.NotAfter) {
+			return nil
+		}
+		reason := "expired"
+		if err != nil {
+			reason = err.Error()
+		}
+		log.Info().Str("component", "pki").Str("certificate", string(opts.Type)).Msgf("reissuing bootstrap certificate: %s", reason)
 	}
 
-	privateKey, err := generatePrivateKey(opts.KeySize)
+	return issueCertificate(opts)
+}
+
+// issueCertificate generates a private key, creates a certificate template, signs the certificate,
+// and writes the certificate and key to disk, replacing any existing files
+func issueCertificate(opts CertOptions) error {
+	privateKey, err := generatePrivateKey(opts.KeyAlgorithm, opts.KeySize)
 	if err != nil {
 		return err
 	}
@@ -80,7 +144,12 @@ func generateCertificate(opts CertOptions) error {
 		return err
 	}
 
-	if err := writeCertificateAndKey(opts.CertDir, opts.KeyDir, cert, privateKey); err != nil {
+	chain, err := issuerChain(opts)
+	if err != nil {
+		return err
+	}
+
+	if err := writeCertificateAndKey(opts.CertDir, opts.KeyDir, append([][]byte{cert}, chain...), privateKey); err != nil {
 		return err
 	}
 
@@ -121,16 +190,6 @@ func certAlreadyExists(certPath, keyPath string) bool {
 	return filesystem.FileExists(certPath) && filesystem.FileExists(keyPath)
 }
 
-// generatePrivateKey creates a new private key
-// it returns the private key and an error if it fails
-func generatePrivateKey(keySize int) (*rsa.PrivateKey, error) {
-	privateKey, err := rsa.GenerateKey(rand.Reader, keySize)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate private key: %v", err)
-	}
-	return privateKey, nil
-}
-
 // createCertificateTemplate creates a certificate template based on options
 // it returns the certificate template, the not before time, the not after time, and an error if it fails
 func createCertificateTemplate(opts CertOptions) (*x509.Certificate, time.Time, time.Time, error) {
@@ -157,6 +216,10 @@ func createCertificateTemplate(opts CertOptions) (*x509.Certificate, time.Time,
 	}
 
 	configureCertificateByType(template, opts.Type)
+	// key encipherment only applies to RSA keys
+	if opts.KeyAlgorithm != KeyAlgorithmRSA && opts.KeyAlgorithm != "" {
+		template.KeyUsage &^= x509.KeyUsageKeyEncipherment
+	}
 
 	return template, notBefore, notAfter, nil
 }
@@ -164,13 +227,17 @@ func createCertificateTemplate(opts CertOptions) (*x509.Certificate, time.Time,
 // configureCertificateByType sets the appropriate certificate extensions and usage flags
 func configureCertificateByType(template *x509.Certificate, certType CertificateType) {
 	switch certType {
-	case CACert:
+	case CACert, FrontProxyCACert:
 		template.IsCA = true
 		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature
 
 	case KubeletCert:
 		template.KeyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
-		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth}
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+
+	case KubeletServingCert:
+		template.KeyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
 
 	case APIServerCert:
 		template.KeyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
@@ -187,17 +254,21 @@ func configureCertificateByType(template *x509.Certificate, certType Certificate
 	case WebhookCert:
 		template.KeyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
 		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+
+	case FrontProxyClientCert:
+		template.KeyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
 	}
 }
 
 // signCertificate signs the certificate with the provided private key or CA certificate
 // it returns the signed certificate and an error if it fails
-func signCertificate(opts CertOptions, template *x509.Certificate, privateKey *rsa.PrivateKey) ([]byte, error) {
+func signCertificate(opts CertOptions, template *x509.Certificate, privateKey crypto.Signer) ([]byte, error) {
 	var cert []byte
 	var err error
 
-	if opts.Type == CACert {
-		cert, err = x509.CreateCertificate(rand.Reader, template, template, &privateKey.PublicKey, privateKey)
+	if isCAType(opts.Type) {
+		cert, err = x509.CreateCertificate(rand.Reader, template, template, privateKey.Public(), privateKey)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create self-signed certificate: %v", err)
 		}
@@ -207,7 +278,7 @@ func signCertificate(opts CertOptions, template *x509.Certificate, privateKey *r
 			return nil, fmt.Errorf("failed to load CA certificate: %v", err)
 		}
 
-		cert, err = x509.CreateCertificate(rand.Reader, template, signerCert, &privateKey.PublicKey, signerKey)
+		cert, err = x509.CreateCertificate(rand.Reader, template, signerCert, privateKey.Public(), signerKey)
 		if err != nil {
 			return nil, fmt.Errorf("failed to sign certificate: %v", err)
 		}
@@ -216,40 +287,60 @@ func signCertificate(opts CertOptions, template *x509.Certificate, privateKey *r
 	return cert, nil
 }
 
-// writeCertificateAndKey writes the certificate and key to disk
+// writeCertificateAndKey writes the certificate and the PKCS#8 encoded key to disk
+// certs is the certificate followed by the intermediate certificates of its issuer, if any
 // it returns an error if it fails
-func writeCertificateAndKey(certPath, keyPath string, cert []byte, privateKey *rsa.PrivateKey) error {
-	certOut, err := os.Create(certPath)
+func writeCertificateAndKey(certPath, keyPath string, certs [][]byte, privateKey crypto.Signer) error {
+	keyPEM, err := EncodePrivateKey(privateKey)
 	if err != nil {
-		return fmt.Errorf("failed to open certificate file for writing: %v", err)
+		return err
 	}
-	defer certOut.Close()
 
-	if err := pem.Encode(certOut, &pem.Block{Type: "CERTIFICATE", Bytes: cert}); err != nil {
-		return fmt.Errorf("failed to write certificate data: %v", err)
+	certPEM := []byte{}
+	for _, cert := range certs {
+		certPEM = append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert})...)
 	}
+	return replaceCertificateAndKey(certPath, certPEM, keyPath, keyPEM)
+}
 
-	keyOut, err := os.OpenFile(keyPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
-	if err != nil {
-		return fmt.Errorf("failed to open key file for writing: %v", err)
-	}
-	defer keyOut.Close()
-
-	keyBlock := &pem.Block{
-		Type:  "RSA PRIVATE KEY",
-		Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
+// replaceCertificateAndKey writes both files to temporary files first and only then renames them into place, certificate first
+// nothing is replaced when either file cannot be written, and the two renames leave a window of a few microseconds only,
+// readers such as KeyPairReloader reject a certificate that does not match its key and keep the previous pair,
+// certNeedsRenewal reissues a pair left mismatched by a failed rename
+func replaceCertificateAndKey(certPath string, certPEM []byte, keyPath string, keyPEM []byte) error {
+	certTmp, keyTmp := certPath+".tmp", keyPath+".tmp"
+	if err := os.WriteFile(certTmp, certPEM, 0644); err != nil {
+		return fmt.Errorf("failed to write certificate data: %v", err)
 	}
-
-	if err := pem.Encode(keyOut, keyBlock); err != nil {
+	if err := os.WriteFile(keyTmp, keyPEM, 0600); err != nil {
+		os.Remove(certTmp)
 		return fmt.Errorf("failed to write key data: %v", err)
 	}
 
+	if err := os.Rename(certTmp, certPath); err != nil {
+		os.Remove(certTmp)
+		os.Remove(keyTmp)
+		return fmt.Errorf("failed to replace certificate: %v", err)
+	}
+	if err := os.Rename(keyTmp, keyPath); err != nil {
+		os.Remove(keyTmp)
+		return fmt.Errorf("failed to replace key, the certificate %s no longer matches it: %v", certPath, err)
+	}
 	return nil
 }
 
+// writeFileAtomically writes the data to a temporary file in the same directory and renames it over the target
+func writeFileAtomically(path string, data []byte, perm os.FileMode) error {
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
 // loadCertificateAndKey loads the certificate and key from disk
 // it returns the certificate, the private key, and an error if it fails
-func loadCertificateAndKey(certPath, keyPath string) (*x509.Certificate, *rsa.PrivateKey, error) {
+func loadCertificateAndKey(certPath, keyPath string) (*x509.Certificate, crypto.Signer, error) {
 	certPEMBlock, err := os.ReadFile(certPath)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to read certificate file: %v", err)
@@ -275,9 +366,9 @@ func loadCertificateAndKey(certPath, keyPath string) (*x509.Certificate, *rsa.Pr
 		return nil, nil, fmt.Errorf("failed to parse key PEM data")
 	}
 
-	key, err := x509.ParsePKCS1PrivateKey(keyDERBlock.Bytes)
+	key, err := parsePrivateKey(keyDERBlock)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to parse key: %v", err)
+		return nil, nil, err
 	}
 
 	return cert, key, nil
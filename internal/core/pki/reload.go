@@ -0,0 +1,84 @@
+package pki
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// KeyPairReloader serves a TLS certificate from disk and reloads it when the files change
+// it is used by servers that load their certificate themselves so a renewed certificate is picked up without a restart
+type KeyPairReloader struct {
+	certFile string
+	keyFile  string
+
+	mu         sync.RWMutex
+	cert       *tls.Certificate
+	certChange time.Time
+	keyChange  time.Time
+}
+
+// NewKeyPairReloader loads the key pair and returns a reloader serving it
+func NewKeyPairReloader(certFile, keyFile string) (*KeyPairReloader, error) {
+	reloader := &KeyPairReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+
+	if err := reloader.reload(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+// GetCertificate returns the current certificate, reloading it first if the certificate or key file changed on disk
+// it is meant to be used as tls.Config.GetCertificate, a failed reload, such as a certificate that does not match the key
+// while the pair is being replaced, keeps serving the previous certificate and is retried on the next handshake
+func (r *KeyPairReloader) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	certInfo, certErr := os.Stat(r.certFile)
+	keyInfo, keyErr := os.Stat(r.keyFile)
+	if certErr == nil && keyErr == nil {
+		r.mu.RLock()
+		changed := !certInfo.ModTime().Equal(r.certChange) || !keyInfo.ModTime().Equal(r.keyChange)
+		r.mu.RUnlock()
+
+		if changed {
+			if err := r.reload(); err != nil {
+				log.Warn().Str("component", "pki").Msgf("failed to reload certificate %s, serving the previous one: %v", r.certFile, err)
+			}
+		}
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// reload reads the key pair from disk and swaps it in, the previous pair is kept when the files do not match
+func (r *KeyPairReloader) reload() error {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return fmt.Errorf("failed to stat certificate: %v", err)
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to stat key: %v", err)
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load key pair: %v", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.certChange = certInfo.ModTime()
+	r.keyChange = keyInfo.ModTime()
+	log.Debug().Str("component", "pki").Msgf("loaded certificate %s", r.certFile)
+	return nil
+}
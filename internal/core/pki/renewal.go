@@ -0,0 +1,167 @@
+package pki
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/portainer/kubesolo/types"
+	"github.com/rs/zerolog/log"
+)
+
+// leafCertificateTypes are the certificates kubesolo signs with the cluster CA or the front-proxy CA and renews, in that order
+// the kubelet client certificate is not one of them, it only bootstraps the kubelet, which then rotates its own
+// certificates through certificate signing requests, see generateBootstrapCertificate
+// the kubelet serving certificate is, the kubelet only reads it as the fallback it serves until a request is signed
+var leafCertificateTypes = []CertificateType{
+	KubeletServingCert,
+	APIServerCert,
+	ControllerManagerCert,
+	AdminCert,
+	WebhookCert,
+	FrontProxyClientCert,
+}
+
+// issueMu serializes the passes that reissue leaf certificates, renewals and address changes can trigger them concurrently
+var issueMu sync.Mutex
+
+// RenewalCallback is called with the certificates that were reissued by a renewal pass
+type RenewalCallback func(renewed []CertificateType)
+
+// RunRenewal checks the leaf certificates every interval until the context is cancelled
+// any certificate that is about to expire or whose identity, SANs or key algorithm changed is reissued with the existing CA
+// onRenew is called after each pass that reissued at least one certificate
+func RunRenewal(ctx context.Context, embedded types.Embedded, config Config, interval time.Duration, onRenew RenewalCallback) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			renewed, err := RenewCertificates(embedded, config)
+			if err != nil {
+				log.Error().Str("component", "pki").Msgf("certificate renewal failed: %v", err)
+			}
+			if len(renewed) > 0 && onRenew != nil {
+				onRenew(renewed)
+			}
+		}
+	}
+}
+
+// RenewCertificates reissues every leaf certificate that needs renewal
+// it returns the certificates that were reissued, and keeps going when a single certificate fails
+func RenewCertificates(embedded types.Embedded, config Config) ([]CertificateType, error) {
+	issueMu.Lock()
+	defer issueMu.Unlock()
+
+	renewed := []CertificateType{}
+	var lastErr error
+
+	for _, certType := range leafCertificateTypes {
+		opts := defaultCertOptions(certType, embedded, config.KeyAlgorithm)
+		renew, reason, err := certNeedsRenewal(opts, config.RenewBeforeDays)
+		if err != nil {
+			log.Warn().Str("component", "pki").Str("certificate", string(certType)).Msgf("failed to inspect certificate, reissuing it: %v", err)
+			renew, reason = true, "unreadable certificate"
+		}
+		if !renew {
+			continue
+		}
+
+		log.Info().Str("component", "pki").Str("certificate", string(certType)).Msgf("renewing certificate: %s", reason)
+		if err := issueCertificate(opts); err != nil {
+			lastErr = fmt.Errorf("failed to renew %s certificate: %v", certType, err)
+			log.Error().Str("component", "pki").Str("certificate", string(certType)).Msgf("%v", lastErr)
+			continue
+		}
+		renewed = append(renewed, certType)
+	}
+
+	return renewed, lastErr
+}
+
+// certNeedsRenewal compares the certificate on disk with the options it would be issued with today
+// it returns true and the reason when the certificate does not match its key, expires within renewBeforeDays,
+// or when its common name, organization, DNS names, IP addresses or key algorithm changed, or it was not issued by the current CA
+func certNeedsRenewal(opts CertOptions, renewBeforeDays int) (bool, string, error) {
+	cert, err := readCertificate(opts.CertDir)
+	if err != nil {
+		return false, "", err
+	}
+
+	signer, err := readCertificate(opts.SignerCertDir)
+	if err != nil {
+		return false, "", err
+	}
+	if _, err := tls.LoadX509KeyPair(opts.CertDir, opts.KeyDir); err != nil {
+		return true, fmt.Sprintf("the certificate and key do not match: %v", err), nil
+	}
+	if err := cert.CheckSignatureFrom(signer); err != nil {
+		return true, fmt.Sprintf("not issued by the current CA %s", signer.Subject.CommonName), nil
+	}
+
+	if remaining := time.Until(cert.NotAfter); remaining < time.Duration(renewBeforeDays)*24*time.Hour {
+		return true, fmt.Sprintf("expires on %s", cert.NotAfter.Format(time.RFC3339)), nil
+	}
+	if cert.Subject.CommonName != opts.CommonName {
+		return true, fmt.Sprintf("common name changed from %s to %s", cert.Subject.CommonName, opts.CommonName), nil
+	}
+	if !sameStrings(cert.Subject.Organization, opts.Organization) {
+		return true, "organization changed", nil
+	}
+	if !sameStrings(cert.DNSNames, opts.DNSNames) {
+		return true, fmt.Sprintf("DNS names changed from %v to %v", cert.DNSNames, opts.DNSNames), nil
+	}
+	if !sameStrings(ipStrings(cert.IPAddresses), ipStrings(opts.IPAddresses)) {
+		return true, fmt.Sprintf("IP addresses changed from %v to %v", cert.IPAddresses, opts.IPAddresses), nil
+	}
+	if algorithm := certificateKeyAlgorithm(cert); opts.KeyAlgorithm != "" && algorithm != opts.KeyAlgorithm {
+		return true, fmt.Sprintf("key algorithm changed from %s to %s", algorithm, opts.KeyAlgorithm), nil
+	}
+	return false, "", nil
+}
+
+// readCertificate reads and parses a PEM encoded certificate from disk
+func readCertificate(certPath string) (*x509.Certificate, error) {
+	certPEMBlock, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate file: %v", err)
+	}
+
+	certDERBlock, _ := pem.Decode(certPEMBlock)
+	if certDERBlock == nil {
+		return nil, fmt.Errorf("failed to parse certificate PEM data")
+	}
+
+	cert, err := x509.ParseCertificate(certDERBlock.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate: %v", err)
+	}
+	return cert, nil
+}
+
+// sameStrings reports whether both slices hold the same set of values, ignoring order and duplicates
+func sameStrings(a, b []string) bool {
+	a = slices.Compact(slices.Sorted(slices.Values(a)))
+	b = slices.Compact(slices.Sorted(slices.Values(b)))
+	return slices.Equal(a, b)
+}
+
+// ipStrings converts IP addresses to their canonical string form for comparison
+func ipStrings(ips []net.IP) []string {
+	values := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		values = append(values, ip.String())
+	}
+	return values
+}
@@ -0,0 +1,189 @@
+package pki
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/portainer/kubesolo/internal/runtime/filesystem"
+	"github.com/portainer/kubesolo/types"
+	"github.com/rs/zerolog/log"
+)
+
+// RotateCertificates reissues the given leaf certificates with the current CA, or every leaf certificate when none are given
+// it returns the certificates that were reissued
+func RotateCertificates(embedded types.Embedded, config Config, certTypes []CertificateType) ([]CertificateType, error) {
+	issueMu.Lock()
+	defer issueMu.Unlock()
+
+	if len(certTypes) == 0 {
+		certTypes = leafCertificateTypes
+	}
+
+	rotated := []CertificateType{}
+	for _, certType := range certTypes {
+		opts := defaultCertOptions(certType, embedded, config.KeyAlgorithm)
+		if err := ensureCertificateDirectories(opts); err != nil {
+			return rotated, err
+		}
+
+		if err := issueCertificate(opts); err != nil {
+			return rotated, fmt.Errorf("failed to rotate %s certificate: %v", certType, err)
+		}
+		log.Info().Str("component", "pki").Str("certificate", string(certType)).Msg("certificate rotated")
+		rotated = append(rotated, certType)
+	}
+
+	return rotated, nil
+}
+
+// RotateCA issues a new CA and reissues every leaf certificate with it
+// the CA file becomes a bundle of the new CA followed by the previous one, so clients holding certificates
+// issued by the previous CA keep being trusted until they are replaced
+// older CAs of the bundle are kept as long as a certificate of kubesolo or of the kubelet on disk still chains to them,
+// so rotating again before every leaf was replaced does not drop a CA that is still in use
+// the previous CA files are kept next to the new ones with a .previous suffix
+// an operator-supplied CA is rotated by supplying a new one instead
+func RotateCA(embedded types.Embedded, config Config) error {
+	if filesystem.FileExists(embedded.CACerts.Chain) {
+		return fmt.Errorf("the CA was supplied by the operator, supply a new CA certificate and key and restart kubesolo instead")
+	}
+
+	previousCert, _, err := loadCertificateAndKey(embedded.CACerts.Cert, embedded.CACerts.Key)
+	if err != nil {
+		return fmt.Errorf("failed to load the current CA: %v", err)
+	}
+	olderCAs, err := caBundleInUse(embedded)
+	if err != nil {
+		return err
+	}
+
+	if err := backupFile(embedded.CACerts.Cert); err != nil {
+		return err
+	}
+	if err := backupFile(embedded.CACerts.Key); err != nil {
+		return err
+	}
+
+	opts := defaultCertOptions(CACert, embedded, config.KeyAlgorithm)
+	privateKey, err := generatePrivateKey(opts.KeyAlgorithm, opts.KeySize)
+	if err != nil {
+		return err
+	}
+
+	template, _, _, err := createCertificateTemplate(opts)
+	if err != nil {
+		return err
+	}
+
+	cert, err := signCertificate(opts, template, privateKey)
+	if err != nil {
+		return err
+	}
+
+	keyPEM, err := EncodePrivateKey(privateKey)
+	if err != nil {
+		return err
+	}
+	bundlePEM := append(
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: previousCert.Raw})...,
+	)
+	for _, ca := range olderCAs {
+		bundlePEM = append(bundlePEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw})...)
+	}
+
+	if err := replaceCertificateAndKey(opts.CertDir, bundlePEM, opts.KeyDir, keyPEM); err != nil {
+		return fmt.Errorf("failed to write the new CA, the previous one is kept in %s.previous: %v", opts.CertDir, err)
+	}
+	if err := writeCABundle(embedded.CACerts); err != nil {
+		return err
+	}
+	log.Info().Str("component", "pki").Msg("new CA issued, the previous CA is kept in the bundle")
+
+	if _, err := RotateCertificates(embedded, config, nil); err != nil {
+		return err
+	}
+	return nil
+}
+
+// caBundleInUse returns the CAs of the bundle after the current one that still sign a leaf certificate on disk
+// the certificates of kubesolo and the ones the kubelet rotated through certificate signing requests are checked,
+// certificates handed out with kubeconfig create are not on disk and stop working once their CA is dropped
+func caBundleInUse(embedded types.Embedded) ([]*x509.Certificate, error) {
+	data, err := os.ReadFile(embedded.CACerts.Cert)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the CA bundle: %v", err)
+	}
+	cas, err := parseCertificates(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the CA bundle: %v", err)
+	}
+	if len(cas) < 2 {
+		return nil, nil
+	}
+
+	leaves := leafCertificatesOnDisk(embedded.PKIDir, filepath.Join(embedded.KubeletDir, "pki"))
+	inUse := []*x509.Certificate{}
+	for _, ca := range cas[1:] {
+		signed := slices.ContainsFunc(leaves, func(leaf *x509.Certificate) bool { return leaf.CheckSignatureFrom(ca) == nil })
+		if !signed {
+			log.Info().Str("component", "pki").Msgf("dropping CA %s from the bundle, no certificate on disk is issued by it anymore", ca.Subject.CommonName)
+			continue
+		}
+		log.Info().Str("component", "pki").Msgf("keeping CA %s in the bundle, certificates on disk are still issued by it", ca.Subject.CommonName)
+		inUse = append(inUse, ca)
+	}
+	return inUse, nil
+}
+
+// leafCertificatesOnDisk returns the certificates that are not CAs in the .crt and .pem files under the directories
+// files that cannot be read or parsed are skipped, a missing directory has no certificates
+func leafCertificatesOnDisk(dirs ...string) []*x509.Certificate {
+	leaves := []*x509.Certificate{}
+	for _, dir := range dirs {
+		_ = filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil || entry.IsDir() || (filepath.Ext(path) != ".crt" && filepath.Ext(path) != ".pem") {
+				return nil
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil
+			}
+			certs, err := parseCertificates(data)
+			if err != nil {
+				log.Warn().Str("component", "pki").Msgf("skipping %s while looking for certificates issued by older CAs: %v", path, err)
+				return nil
+			}
+			for _, cert := range certs {
+				if !cert.IsCA {
+					leaves = append(leaves, cert)
+				}
+			}
+			return nil
+		})
+	}
+	return leaves
+}
+
+// backupFile copies the file to the same path with a .previous suffix
+func backupFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", path, err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %v", path, err)
+	}
+
+	if err := os.WriteFile(path+".previous", data, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to back up %s: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package pki
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/portainer/kubesolo/types"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// serviceAccountKeyCreatedHeader records when the current signing key was generated
+	serviceAccountKeyCreatedHeader = "Created"
+	// serviceAccountKeyRetireAfterHeader records until when a previous signing key stays in the verification set
+	serviceAccountKeyRetireAfterHeader = "Retire-After"
+)
+
+// EnsureServiceAccountKeys makes sure the service account signing key and the verification set exist
+// previous keys past their grace period are retired and the signing key is rotated when it is older than the rotation period
+// the API server only loads the keys at startup, so this runs before it starts
+func EnsureServiceAccountKeys(embedded types.Embedded, config Config) error {
+	if _, err := os.Stat(embedded.ServiceAccountKeyFile); os.IsNotExist(err) {
+		return rotateServiceAccountKey(embedded, config, nil, nil)
+	}
+
+	current, previous, err := loadServiceAccountPublicKeys(embedded)
+	if err != nil {
+		return err
+	}
+	kept := retireServiceAccountKeys(previous)
+
+	if config.ServiceAccountKeyRotationDays > 0 {
+		created, err := time.Parse(time.RFC3339, current.Headers[serviceAccountKeyCreatedHeader])
+		if err != nil || time.Since(created) > time.Duration(config.ServiceAccountKeyRotationDays)*24*time.Hour {
+			log.Info().Str("component", "pki").Msgf("service account signing key is older than %d days, rotating it", config.ServiceAccountKeyRotationDays)
+			return rotateServiceAccountKey(embedded, config, current, kept)
+		}
+	}
+
+	return writeServiceAccountPublicKeys(embedded.ServiceAccountPublicKeyFile, current, kept)
+}
+
+// RotateServiceAccountKey generates a new service account signing key
+// the previous public key stays in the verification set for the grace period, so tokens it signed keep working until they are refreshed
+func RotateServiceAccountKey(embedded types.Embedded, config Config) error {
+	current, previous, err := loadServiceAccountPublicKeys(embedded)
+	if err != nil {
+		return err
+	}
+	return rotateServiceAccountKey(embedded, config, current, retireServiceAccountKeys(previous))
+}
+
+// rotateServiceAccountKey writes a new signing key, retiring is the public key of the key being replaced, if any
+// the verification set is written first so an interrupted rotation never leaves the signing key out of it
+func rotateServiceAccountKey(embedded types.Embedded, config Config, retiring *pem.Block, previous []*pem.Block) error {
+	algorithm := config.KeyAlgorithm
+	if algorithm == KeyAlgorithmEd25519 {
+		log.Info().Str("component", "pki").Msgf("service account tokens cannot be signed with %s keys, using %s", algorithm, KeyAlgorithmECDSAP256)
+		algorithm = KeyAlgorithmECDSAP256
+	}
+
+	privateKey, err := GeneratePrivateKey(algorithm)
+	if err != nil {
+		return err
+	}
+	privateKeyPEM, err := EncodePrivateKey(privateKey)
+	if err != nil {
+		return err
+	}
+	publicKeyDER, err := x509.MarshalPKIXPublicKey(privateKey.Public())
+	if err != nil {
+		return fmt.Errorf("failed to marshal public key: %v", err)
+	}
+
+	current := &pem.Block{
+		Type:    "PUBLIC KEY",
+		Headers: map[string]string{serviceAccountKeyCreatedHeader: time.Now().UTC().Format(time.RFC3339)},
+		Bytes:   publicKeyDER,
+	}
+	if retiring != nil {
+		retiring.Headers = map[string]string{
+			serviceAccountKeyRetireAfterHeader: time.Now().Add(types.DefaultServiceAccountKeyGracePeriod).UTC().Format(time.RFC3339),
+		}
+		previous = append(previous, retiring)
+	}
+
+	if err := writeServiceAccountPublicKeys(embedded.ServiceAccountPublicKeyFile, current, previous); err != nil {
+		return err
+	}
+	if err := writeFileAtomically(embedded.ServiceAccountKeyFile, privateKeyPEM, 0600); err != nil {
+		return fmt.Errorf("failed to write service account key: %v", err)
+	}
+
+	if retiring != nil {
+		log.Info().Str("component", "pki").Msgf("service account signing key rotated, the previous key is accepted until %s", retiring.Headers[serviceAccountKeyRetireAfterHeader])
+	}
+	return nil
+}
+
+// loadServiceAccountPublicKeys returns the public key of the current signing key and the previous keys of the verification set
+// a verification set written before rotation was supported, or by another key, is rebuilt around the current signing key
+func loadServiceAccountPublicKeys(embedded types.Embedded) (*pem.Block, []*pem.Block, error) {
+	data, err := os.ReadFile(embedded.ServiceAccountKeyFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read service account key: %v", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, nil, fmt.Errorf("failed to decode service account key")
+	}
+	privateKey, err := parsePrivateKey(block)
+	if err != nil {
+		return nil, nil, err
+	}
+	publicKeyDER, err := x509.MarshalPKIXPublicKey(privateKey.Public())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal public key: %v", err)
+	}
+
+	var current *pem.Block
+	previous := []*pem.Block{}
+
+	data, err = os.ReadFile(embedded.ServiceAccountPublicKeyFile)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, fmt.Errorf("failed to read service account public keys: %v", err)
+	}
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		switch {
+		case bytes.Equal(block.Bytes, publicKeyDER):
+			if current == nil {
+				current = &pem.Block{Type: "PUBLIC KEY", Headers: map[string]string{}, Bytes: publicKeyDER}
+			}
+			if created := block.Headers[serviceAccountKeyCreatedHeader]; created != "" {
+				current.Headers[serviceAccountKeyCreatedHeader] = created
+			}
+		case block.Headers[serviceAccountKeyRetireAfterHeader] != "":
+			previous = append(previous, block)
+		default:
+			// a signing key replaced outside of kubesolo, keep it for the grace period like a rotated key
+			block.Headers = map[string]string{
+				serviceAccountKeyRetireAfterHeader: time.Now().Add(types.DefaultServiceAccountKeyGracePeriod).UTC().Format(time.RFC3339),
+			}
+			previous = append(previous, block)
+		}
+	}
+
+	if current == nil {
+		current = &pem.Block{Type: "PUBLIC KEY", Headers: map[string]string{}, Bytes: publicKeyDER}
+	}
+	if current.Headers[serviceAccountKeyCreatedHeader] == "" {
+		// the age of a key without a creation time is taken from its file
+		info, err := os.Stat(embedded.ServiceAccountKeyFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to stat service account key: %v", err)
+		}
+		current.Headers[serviceAccountKeyCreatedHeader] = info.ModTime().UTC().Format(time.RFC3339)
+	}
+	return current, previous, nil
+}
+
+// retireServiceAccountKeys returns the previous keys still within their grace period
+func retireServiceAccountKeys(previous []*pem.Block) []*pem.Block {
+	kept := []*pem.Block{}
+	for _, block := range previous {
+		retireAfter, err := time.Parse(time.RFC3339, block.Headers[serviceAccountKeyRetireAfterHeader])
+		if err == nil && time.Now().After(retireAfter) {
+			log.Info().Str("component", "pki").Msgf("retiring service account verification key past its grace period of %s", retireAfter.Format(time.RFC3339))
+			continue
+		}
+		kept = append(kept, block)
+	}
+	return kept
+}
+
+// writeServiceAccountPublicKeys writes the verification set, the current key first followed by the previous keys
+// the API server ignores the PEM headers, they record the key lifecycle for kubesolo
+func writeServiceAccountPublicKeys(path string, current *pem.Block, previous []*pem.Block) error {
+	data := pem.EncodeToMemory(current)
+	for _, block := range previous {
+		data = append(data, pem.EncodeToMemory(block)...)
+	}
+	if err := writeFileAtomically(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write service account public keys: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package pki
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/portainer/kubesolo/types"
+)
+
+// SignCertificateRequest issues a certificate for a certificate signing request with the cluster CA
+// the certificate keeps the subject and SANs of the request and is valid for the given duration, capped to the CA validity
+// it returns the PEM encoded certificate followed by the intermediate certificates of an operator-supplied CA
+func SignCertificateRequest(embedded types.Embedded, request *x509.CertificateRequest, keyUsage x509.KeyUsage, extKeyUsage []x509.ExtKeyUsage, validity time.Duration) ([]byte, error) {
+	if err := request.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("invalid certificate request signature: %v", err)
+	}
+
+	signerCert, signerKey, err := loadCertificateAndKey(embedded.CACerts.Cert, embedded.CACerts.Key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load CA certificate: %v", err)
+	}
+
+	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
+	serialNumber, err := rand.Int(rand.Reader, serialNumberLimit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %v", err)
+	}
+
+	notBefore := time.Now()
+	notAfter := notBefore.Add(validity)
+	if notAfter.After(signerCert.NotAfter) {
+		notAfter = signerCert.NotAfter
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               request.Subject,
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		DNSNames:              request.DNSNames,
+		IPAddresses:           request.IPAddresses,
+		KeyUsage:              keyUsage,
+		ExtKeyUsage:           extKeyUsage,
+		BasicConstraintsValid: true,
+	}
+
+	cert, err := x509.CreateCertificate(rand.Reader, template, signerCert, request.PublicKey, signerKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign certificate: %v", err)
+	}
+
+	chain, err := issuerChain(CertOptions{
+		SignerCertDir:  embedded.CACerts.Cert,
+		SignerChainDir: embedded.CACerts.Chain,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	certPEM := []byte{}
+	for _, der := range append([][]byte{cert}, chain...) {
+		certPEM = append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	return certPEM, nil
+}
+
+// IssueClientCertificate generates a key and signs a client certificate for the user and groups with the cluster CA
+// it returns the PEM encoded certificate chain and private key
+func IssueClientCertificate(embedded types.Embedded, keyAlgorithm KeyAlgorithm, user string, groups []string, validity time.Duration) ([]byte, []byte, error) {
+	privateKey, err := GeneratePrivateKey(keyAlgorithm)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	requestDER, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{
+			CommonName:   user,
+			Organization: groups,
+		},
+	}, privateKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create certificate request: %v", err)
+	}
+
+	request, err := x509.ParseCertificateRequest(requestDER)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse certificate request: %v", err)
+	}
+
+	certPEM, err := SignCertificateRequest(embedded, request, x509.KeyUsageDigitalSignature, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}, validity)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyPEM, err := EncodePrivateKey(privateKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return certPEM, keyPEM, nil
+}
@@ -10,8 +10,10 @@ type CertificateType string
 const (
 	// CACert is a certificate authority
 	CACert CertificateType = "ca"
-	// KubeletCert is for the kubelet
+	// KubeletCert is the client certificate the kubelet starts with
 	KubeletCert CertificateType = "kubelet"
+	// KubeletServingCert is served by the kubelet until its first serving certificate signing request is signed
+	KubeletServingCert CertificateType = "kubelet-serving"
 	// APIServerCert is for the API server
 	APIServerCert CertificateType = "apiserver"
 	// ControllerManagerCert is for the kube-controller-manager
@@ -20,8 +22,17 @@ const (
 	AdminCert CertificateType = "admin"
 	// WebhookCert is for the webhook
 	WebhookCert CertificateType = "webhook"
+	// FrontProxyCACert is the certificate authority of the clients the API server proxies aggregated API requests with
+	FrontProxyCACert CertificateType = "front-proxy-ca"
+	// FrontProxyClientCert is for the API server when it proxies requests to aggregated API servers
+	FrontProxyClientCert CertificateType = "front-proxy-client"
 )
 
+// isCAType reports whether the certificate type is a self-signed certificate authority
+func isCAType(certType CertificateType) bool {
+	return certType == CACert || certType == FrontProxyCACert
+}
+
 // CertOptions holds configuration for certificate generation
 type CertOptions struct {
 	// Type of certificate to generate
@@ -37,17 +48,39 @@ type CertOptions struct {
 
 	// Certificate properties
 	NotAfterDays int
+	KeyAlgorithm KeyAlgorithm
 	KeySize      int // RSA key size in bits
 
 	// For signed certificates
 	SignerCertDir string
 	SignerKeyDir  string
+	// Intermediate certificates of an operator-supplied signer
+	SignerChainDir string
 
 	// Output Dirs
 	CertDir string
 	KeyDir  string
 }
 
+// Config holds the settings the cluster certificates are issued and renewed with
+type Config struct {
+	// RenewBeforeDays is how many days before expiry a leaf certificate is reissued
+	RenewBeforeDays int
+	// KeyAlgorithm is the algorithm of newly generated private keys
+	KeyAlgorithm KeyAlgorithm
+	// ExternalCA is an operator-supplied CA used instead of a self-generated one
+	ExternalCA ExternalCA
+	// ServiceAccountKeyRotationDays is the age after which the service account signing key is rotated at startup, 0 disables it
+	ServiceAccountKeyRotationDays int
+}
+
+// ExternalCA points to an operator-supplied CA used instead of a self-generated one
+// the certificate file holds the CA certificate, optionally followed by the chain up to the root
+type ExternalCA struct {
+	CertFile string
+	KeyFile  string
+}
+
 // CertificateDirs holds Dirs to certificate files
 type CertificateDirs struct {
 	CertDir   string
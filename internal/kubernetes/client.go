@@ -3,8 +3,10 @@ package kubernetes
 import (
 	"fmt"
 
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/clientcmd"
+	aggregator "k8s.io/kube-aggregator/pkg/client/clientset_generated/clientset"
 )
 
 // GetKubernetesClient returns a kubernetes client using the provided kubeconfig
@@ -22,3 +24,36 @@ func GetKubernetesClient(kubeconfig string) (*kubernetes.Clientset, error) {
 
 	return clientset, nil
 }
+
+// GetDynamicClient returns a dynamic kubernetes client using the provided kubeconfig
+// it is used to work with objects whose kinds are only known at runtime
+func GetDynamicClient(kubeconfig string) (*dynamic.DynamicClient, error) {
+	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build config from kubeconfig: %v", err)
+	}
+
+	config.BearerToken = ""
+	client, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dynamic kubernetes client: %v", err)
+	}
+
+	return client, nil
+}
+
+// GetAggregatorClient returns a client for the APIService objects of the aggregation layer using the provided kubeconfig
+func GetAggregatorClient(kubeconfig string) (*aggregator.Clientset, error) {
+	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build config from kubeconfig: %v", err)
+	}
+
+	config.BearerToken = ""
+	client, err := aggregator.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create aggregator client: %v", err)
+	}
+
+	return client, nil
+}
@@ -0,0 +1,97 @@
+package network
+
+import (
+	"context"
+	"net"
+	"slices"
+	"time"
+
+	"github.com/portainer/kubesolo/types"
+	"github.com/rs/zerolog/log"
+	"github.com/vishvananda/netlink"
+)
+
+// AddressChangeCallback is called with the host addresses before and after a change
+type AddressChangeCallback func(previous, current []net.IP)
+
+// WatchAddresses calls onChange when the addresses returned by GetLocalIPs change, until the context is cancelled
+// changes are read from netlink address updates and debounced, a DHCP renewal or a failover produces a burst of updates
+// when netlink is not available the addresses are polled instead
+func WatchAddresses(ctx context.Context, debounce time.Duration, onChange AddressChangeCallback) {
+	current, err := GetLocalIPs()
+	if err != nil {
+		log.Warn().Str("component", "network").Msgf("failed to read the host addresses: %v", err)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	var poll <-chan time.Time
+	updates := make(chan netlink.AddrUpdate, 16)
+	if err := netlink.AddrSubscribeWithOptions(updates, done, netlink.AddrSubscribeOptions{
+		ErrorCallback: func(err error) {
+			log.Warn().Str("component", "network").Msgf("netlink address subscription error: %v", err)
+		},
+	}); err != nil {
+		log.Warn().Str("component", "network").Msgf("failed to subscribe to address updates, polling every %s instead: %v", types.DefaultAddressPollInterval, err)
+		updates = nil
+		poll = pollAddresses(ctx)
+	}
+
+	var settle <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case _, ok := <-updates:
+			if !ok {
+				log.Warn().Str("component", "network").Msgf("address subscription closed, polling every %s instead", types.DefaultAddressPollInterval)
+				updates = nil
+				poll = pollAddresses(ctx)
+				continue
+			}
+			settle = time.After(debounce)
+
+		case <-poll:
+			settle = time.After(0)
+
+		case <-settle:
+			settle = nil
+			next, err := GetLocalIPs()
+			if err != nil {
+				log.Warn().Str("component", "network").Msgf("failed to read the host addresses: %v", err)
+				continue
+			}
+			if sameIPs(current, next) {
+				continue
+			}
+
+			log.Info().Str("component", "network").Msgf("host addresses changed from %v to %v", current, next)
+			onChange(current, next)
+			current = next
+		}
+	}
+}
+
+// pollAddresses returns a channel that ticks every DefaultAddressPollInterval until the context is cancelled
+func pollAddresses(ctx context.Context) <-chan time.Time {
+	ticker := time.NewTicker(types.DefaultAddressPollInterval)
+	go func() {
+		<-ctx.Done()
+		ticker.Stop()
+	}()
+	return ticker.C
+}
+
+// sameIPs reports whether both lists hold the same addresses, ignoring order
+func sameIPs(a, b []net.IP) bool {
+	toStrings := func(ips []net.IP) []string {
+		values := make([]string, 0, len(ips))
+		for _, ip := range ips {
+			values = append(values, ip.String())
+		}
+		return slices.Sorted(slices.Values(values))
+	}
+	return slices.Equal(toStrings(a), toStrings(b))
+}
@@ -13,10 +13,11 @@ import (
 
 // Run starts the kine service in the following order:
 // 1. it ensures the database directory exists
-// 2. it starts the kine server
-// 3. it waits for a signal to stop the kine server
-// 4. it logs the termination of the kine server
-// 5. it returns an error if it fails
+// 2. it checks the database integrity and recovers it according to the recovery policy
+// 3. it starts the kine server
+// 4. it waits for a signal to stop the kine server
+// 5. it logs the termination of the kine server
+// 6. it returns an error if it fails
 func (s *service) Run() error {
 	log.Info().Str("component", "kine").Str("database", s.databaseDir).Msg("starting kine process (sqlite storage)...")
 	if err := filesystem.EnsureDirectoryExists(s.databaseDir); err != nil {
@@ -25,6 +26,12 @@ func (s *service) Run() error {
 		return err
 	}
 
+	if err := s.ensureDatabaseIntegrity(); err != nil {
+		log.Error().Str("component", "kine").Msgf("failed to ensure database integrity: %v...", err)
+		s.terminate()
+		return err
+	}
+
 	if err := kubesoloservice.RunServiceWithStartupCheck(func() error {
 		log.Debug().Str("component", "kine").Msg("starting kine server...")
 		_, err := endpoint.Listen(s.ctx, s.generateKineConfig())
@@ -0,0 +1,324 @@
+package kine
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/portainer/kubesolo/internal/runtime/filesystem"
+	"github.com/rs/zerolog/log"
+)
+
+// RecoveryPolicy decides what happens when the sqlite database fails its integrity check at startup
+type RecoveryPolicy string
+
+const (
+	// RecoveryPolicyRestore moves the corrupt database aside and restores the newest good snapshot, or starts fresh if there is none
+	RecoveryPolicyRestore RecoveryPolicy = "restore"
+	// RecoveryPolicyFresh moves the corrupt database aside and starts with an empty database
+	RecoveryPolicyFresh RecoveryPolicy = "fresh"
+	// RecoveryPolicyFail leaves the corrupt database in place and stops kubesolo
+	RecoveryPolicyFail RecoveryPolicy = "fail"
+)
+
+// DatabaseFile is the name of the sqlite database kine stores the cluster state in
+const DatabaseFile = "state.db"
+
+const (
+	snapshotsDir       = "snapshots"
+	snapshotPrefix     = "state-"
+	snapshotTimeFormat = "20060102T150405Z"
+	maxSnapshots       = 3
+	// snapshotInterval is the minimum age of the newest snapshot before another one is taken,
+	// so a device in a boot loop does not copy the whole database to its flash storage on every restart
+	snapshotInterval   = 24 * time.Hour
+	recoveryReportFile = "recovery.json"
+)
+
+// errDatabaseCorrupt marks integrity check failures caused by a damaged database file
+// any other failure, such as a permission problem, a lock or a full disk, is not a reason to move the database aside
+var errDatabaseCorrupt = errors.New("database is corrupt")
+
+// recoveryReport is written next to the database every time a recovery decision is taken
+type recoveryReport struct {
+	Time         time.Time      `json:"time"`
+	Policy       RecoveryPolicy `json:"policy"`
+	Reason       string         `json:"reason"`
+	Action       string         `json:"action"`
+	CorruptFile  string         `json:"corruptFile,omitempty"`
+	RestoredFrom string         `json:"restoredFrom,omitempty"`
+}
+
+// ensureDatabaseIntegrity checks the sqlite database before kine opens it
+// a healthy database is snapshotted so it can be restored after a future corruption
+// a corrupt database is handled according to the recovery policy, a database that cannot be checked stops the startup
+func (s *service) ensureDatabaseIntegrity() error {
+	databasePath := filepath.Join(s.databaseDir, DatabaseFile)
+	if !filesystem.FileExists(databasePath) {
+		log.Debug().Str("component", "kine").Msg("no existing database found, skipping integrity check...")
+		return nil
+	}
+
+	checkErr := checkDatabaseIntegrity(databasePath)
+	if checkErr == nil {
+		log.Debug().Str("component", "kine").Msg("database integrity check passed...")
+		if err := s.snapshotDatabase(databasePath); err != nil {
+			log.Warn().Str("component", "kine").Msgf("failed to snapshot the database: %v...", err)
+		}
+		return nil
+	}
+
+	if !errors.Is(checkErr, errDatabaseCorrupt) {
+		return fmt.Errorf("failed to check the integrity of database %s, leaving it untouched: %v", databasePath, checkErr)
+	}
+
+	log.Error().Str("component", "kine").Str("policy", string(s.recoveryPolicy)).Msgf("database integrity check failed: %v...", checkErr)
+	return s.recoverDatabase(databasePath, checkErr)
+}
+
+// checkDatabaseIntegrity runs PRAGMA quick_check against the database
+// it returns an error describing the problems found, or nil if the database is healthy
+// the error wraps errDatabaseCorrupt only when quick_check reports problems or sqlite reports a damaged file
+func checkDatabaseIntegrity(databasePath string) error {
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?_busy_timeout=30000", databasePath))
+	if err != nil {
+		return databaseError("failed to open database", err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query("PRAGMA quick_check")
+	if err != nil {
+		return databaseError("failed to run quick_check", err)
+	}
+	defer rows.Close()
+
+	problems := []string{}
+	for rows.Next() {
+		var result string
+		if err := rows.Scan(&result); err != nil {
+			return databaseError("failed to read quick_check result", err)
+		}
+		if result != "ok" {
+			problems = append(problems, result)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return databaseError("failed to read quick_check results", err)
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: quick_check reported %d problem(s): %s", errDatabaseCorrupt, len(problems), strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// databaseError describes a failure of the integrity check, it is marked as corruption only for SQLITE_CORRUPT and SQLITE_NOTADB
+func databaseError(message string, err error) error {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && (sqliteErr.Code == sqlite3.ErrCorrupt || sqliteErr.Code == sqlite3.ErrNotADB) {
+		return fmt.Errorf("%w: %s: %v", errDatabaseCorrupt, message, err)
+	}
+	return fmt.Errorf("%s: %v", message, err)
+}
+
+// snapshotDatabase writes a consistent copy of the database to the snapshots directory using VACUUM INTO
+// the snapshot is skipped when the newest one is less than snapshotInterval old or the database has not changed since
+// only the newest maxSnapshots snapshots are kept
+func (s *service) snapshotDatabase(databasePath string) error {
+	dir := filepath.Join(s.databaseDir, snapshotsDir)
+	if err := filesystem.EnsureDirectoryExists(dir); err != nil {
+		return fmt.Errorf("failed to create snapshots directory: %v", err)
+	}
+
+	if skip, reason := snapshotUpToDate(databasePath, dir, time.Now()); skip {
+		log.Debug().Str("component", "kine").Msgf("skipping the database snapshot, %s", reason)
+		return nil
+	}
+
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?_busy_timeout=30000", databasePath))
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	snapshotPath := filepath.Join(dir, snapshotPrefix+time.Now().UTC().Format(snapshotTimeFormat)+".db")
+	if _, err := db.Exec("VACUUM INTO ?", snapshotPath); err != nil {
+		return fmt.Errorf("failed to write snapshot %s: %v", snapshotPath, err)
+	}
+	log.Debug().Str("component", "kine").Msgf("database snapshot written to %s", snapshotPath)
+
+	snapshots, err := listSnapshots(dir)
+	if err != nil {
+		return err
+	}
+	for _, old := range snapshots[min(len(snapshots), maxSnapshots):] {
+		if err := os.Remove(old); err != nil {
+			log.Warn().Str("component", "kine").Msgf("failed to remove old snapshot %s: %v", old, err)
+		}
+	}
+	return nil
+}
+
+// snapshotUpToDate reports whether the newest snapshot is recent enough or as recent as the database, and why
+// the database counts as changed when it or its write-ahead log was modified after the newest snapshot was written
+func snapshotUpToDate(databasePath, dir string, now time.Time) (bool, string) {
+	snapshots, err := listSnapshots(dir)
+	if err != nil || len(snapshots) == 0 {
+		return false, ""
+	}
+	newest, err := os.Stat(snapshots[0])
+	if err != nil {
+		return false, ""
+	}
+
+	if age := now.Sub(newest.ModTime()); age >= 0 && age < snapshotInterval {
+		return true, fmt.Sprintf("the newest snapshot %s is %s old", snapshots[0], age.Round(time.Second))
+	}
+
+	for _, path := range []string{databasePath, databasePath + "-wal"} {
+		info, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil || info.ModTime().After(newest.ModTime()) {
+			return false, ""
+		}
+	}
+	return true, fmt.Sprintf("the database has not changed since the newest snapshot %s", snapshots[0])
+}
+
+// listSnapshots returns the snapshot files in the directory, newest first
+func listSnapshots(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read snapshots directory: %v", err)
+	}
+
+	snapshots := []string{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, snapshotPrefix) || !strings.HasSuffix(name, ".db") {
+			continue
+		}
+		snapshots = append(snapshots, filepath.Join(dir, name))
+	}
+
+	// the timestamp format sorts lexically, so reverse order is newest first
+	slices.Sort(snapshots)
+	slices.Reverse(snapshots)
+	return snapshots, nil
+}
+
+// recoverDatabase applies the recovery policy to a corrupt database
+// it moves the database aside, optionally restores the newest good snapshot, and records the decision
+func (s *service) recoverDatabase(databasePath string, checkErr error) error {
+	report := recoveryReport{
+		Time:   time.Now().UTC(),
+		Policy: s.recoveryPolicy,
+		Reason: checkErr.Error(),
+	}
+
+	if s.recoveryPolicy == RecoveryPolicyFail {
+		report.Action = "none"
+		s.writeRecoveryReport(report)
+		return fmt.Errorf("database %s is corrupt and the recovery policy is %q; restore a snapshot from %s or restart with --db-recovery-policy=restore: %v",
+			databasePath, s.recoveryPolicy, filepath.Join(s.databaseDir, snapshotsDir), checkErr)
+	}
+
+	corruptPath, err := moveDatabaseAside(databasePath, report.Time)
+	if err != nil {
+		return err
+	}
+	report.CorruptFile = corruptPath
+	log.Warn().Str("component", "kine").Msgf("corrupt database moved to %s", corruptPath)
+
+	report.Action = "fresh"
+	if s.recoveryPolicy == RecoveryPolicyRestore {
+		snapshot, err := s.restoreNewestSnapshot(databasePath)
+		if err != nil {
+			log.Warn().Str("component", "kine").Msgf("failed to restore a snapshot: %v...", err)
+		}
+		if snapshot != "" {
+			report.Action = "restored"
+			report.RestoredFrom = snapshot
+		}
+	}
+
+	if report.Action == "restored" {
+		log.Warn().Str("component", "kine").Msgf("database restored from snapshot %s, changes made after the snapshot are lost", report.RestoredFrom)
+	} else {
+		log.Warn().Str("component", "kine").Msg("starting with a fresh database, all cluster state has been reset")
+	}
+
+	s.writeRecoveryReport(report)
+	return nil
+}
+
+// moveDatabaseAside renames the database and its WAL and shared memory files with a corrupt suffix
+// it returns the new path of the database file
+func moveDatabaseAside(databasePath string, at time.Time) (string, error) {
+	suffix := ".corrupt-" + at.Format(snapshotTimeFormat)
+	for _, ext := range []string{"", "-wal", "-shm"} {
+		source := databasePath + ext
+		if !filesystem.FileExists(source) {
+			continue
+		}
+		if err := os.Rename(source, databasePath+suffix+ext); err != nil {
+			return "", fmt.Errorf("failed to move %s aside: %v", source, err)
+		}
+	}
+	return databasePath + suffix, nil
+}
+
+// restoreNewestSnapshot copies the newest snapshot that passes the integrity check into place
+// it returns the path of the restored snapshot, or an empty string if no good snapshot was found
+func (s *service) restoreNewestSnapshot(databasePath string) (string, error) {
+	snapshots, err := listSnapshots(filepath.Join(s.databaseDir, snapshotsDir))
+	if err != nil {
+		return "", err
+	}
+
+	for _, snapshot := range snapshots {
+		if err := checkDatabaseIntegrity(snapshot); err != nil {
+			log.Warn().Str("component", "kine").Msgf("skipping snapshot %s: %v", snapshot, err)
+			continue
+		}
+
+		data, err := os.ReadFile(snapshot)
+		if err != nil {
+			return "", fmt.Errorf("failed to read snapshot %s: %v", snapshot, err)
+		}
+		if err := os.WriteFile(databasePath, data, 0600); err != nil {
+			return "", fmt.Errorf("failed to restore snapshot %s: %v", snapshot, err)
+		}
+		return snapshot, nil
+	}
+
+	return "", nil
+}
+
+// writeRecoveryReport records the recovery decision next to the database so it can be inspected after the fact
+func (s *service) writeRecoveryReport(report recoveryReport) {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		log.Warn().Str("component", "kine").Msgf("failed to marshal recovery report: %v", err)
+		return
+	}
+
+	reportPath := filepath.Join(s.databaseDir, recoveryReportFile)
+	if err := os.WriteFile(reportPath, data, 0644); err != nil {
+		log.Warn().Str("component", "kine").Msgf("failed to write recovery report: %v", err)
+		return
+	}
+	log.Info().Str("component", "kine").Msgf("recovery report written to %s", reportPath)
+}
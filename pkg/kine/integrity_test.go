@@ -0,0 +1,157 @@
+package kine
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCheckDatabaseIntegrity(t *testing.T) {
+	tests := []struct {
+		name        string
+		setup       func(t *testing.T, path string)
+		wantErr     bool
+		wantCorrupt bool
+	}{
+		{
+			name: "healthy database",
+			setup: func(t *testing.T, path string) {
+				db, err := sql.Open("sqlite3", path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer db.Close()
+				if _, err := db.Exec("CREATE TABLE kine (id INTEGER PRIMARY KEY, name TEXT); INSERT INTO kine (name) VALUES ('a')"); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "not a database",
+			setup: func(t *testing.T, path string) {
+				garbage := make([]byte, 8192)
+				for i := range garbage {
+					garbage[i] = byte(i)
+				}
+				if err := os.WriteFile(path, garbage, 0600); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr:     true,
+			wantCorrupt: true,
+		},
+		{
+			name: "database that cannot be opened",
+			setup: func(t *testing.T, path string) {
+				if err := os.Mkdir(path, 0700); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), DatabaseFile)
+			tt.setup(t, path)
+
+			err := checkDatabaseIntegrity(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkDatabaseIntegrity() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if corrupt := errors.Is(err, errDatabaseCorrupt); corrupt != tt.wantCorrupt {
+				t.Fatalf("checkDatabaseIntegrity() corrupt = %v, want %v (error %v)", corrupt, tt.wantCorrupt, err)
+			}
+		})
+	}
+}
+
+func TestEnsureDatabaseIntegrityLeavesUncheckableDatabase(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, DatabaseFile)
+	if err := os.Mkdir(path, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &service{databaseDir: dir, recoveryPolicy: RecoveryPolicyFresh}
+	if err := s.ensureDatabaseIntegrity(); err == nil {
+		t.Fatal("ensureDatabaseIntegrity() succeeded on a database that cannot be checked")
+	}
+	if info, err := os.Stat(path); err != nil || !info.IsDir() {
+		t.Fatalf("the database was moved aside: %v", err)
+	}
+}
+
+func TestSnapshotDatabaseSkipsUpToDateSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, DatabaseFile)
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("CREATE TABLE kine (id INTEGER PRIMARY KEY, name TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	s := &service{databaseDir: dir}
+	snapshotDir := filepath.Join(dir, snapshotsDir)
+	count := func() int {
+		t.Helper()
+		snapshots, err := listSnapshots(snapshotDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(snapshots)
+	}
+
+	if err := s.snapshotDatabase(path); err != nil {
+		t.Fatal(err)
+	}
+	if count() != 1 {
+		t.Fatalf("expected the first snapshot to be written, found %d", count())
+	}
+
+	// a restart right after the snapshot does not copy the database again
+	if err := s.snapshotDatabase(path); err != nil {
+		t.Fatal(err)
+	}
+	if count() != 1 {
+		t.Fatalf("expected a recent snapshot to be kept as is, found %d", count())
+	}
+
+	// age the snapshot past the interval, an unchanged database is still not copied
+	snapshots, _ := listSnapshots(snapshotDir)
+	old := time.Now().Add(-2 * snapshotInterval)
+	aged := filepath.Join(snapshotDir, snapshotPrefix+old.UTC().Format(snapshotTimeFormat)+".db")
+	if err := os.Rename(snapshots[0], aged); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, old.Add(-time.Hour), old.Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(aged, old, old); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.snapshotDatabase(path); err != nil {
+		t.Fatal(err)
+	}
+	if count() != 1 {
+		t.Fatalf("expected no snapshot of an unchanged database, found %d", count())
+	}
+
+	// a database changed after an old snapshot is copied
+	if err := os.Chtimes(path, time.Now(), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.snapshotDatabase(path); err != nil {
+		t.Fatal(err)
+	}
+	if count() != 2 {
+		t.Fatalf("expected a new snapshot of the changed database, found %d", count())
+	}
+}
@@ -0,0 +1,136 @@
+package apiserver
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/portainer/kubesolo/internal/core/audit"
+	"github.com/portainer/kubesolo/internal/runtime/filesystem"
+	"github.com/portainer/kubesolo/types"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// defaultAuditPolicy records who changed what without writing secret contents to the log
+// health checks, leases and events are dropped, they would fill the log on a small device without telling anything
+// secrets, config maps and tokens are recorded at metadata level, every other write with its request and response bodies
+const defaultAuditPolicy = `apiVersion: audit.k8s.io/v1
+kind: Policy
+omitStages:
+  - RequestReceived
+rules:
+  - level: None
+    nonResourceURLs:
+      - /healthz*
+      - /livez*
+      - /readyz*
+      - /version
+  - level: None
+    resources:
+      - group: coordination.k8s.io
+        resources: ["leases"]
+      - group: ""
+        resources: ["events"]
+      - group: events.k8s.io
+        resources: ["events"]
+  - level: None
+    userGroups: ["system:nodes"]
+    verbs: ["get", "list", "watch"]
+  - level: Metadata
+    resources:
+      - group: ""
+        resources: ["secrets", "configmaps", "serviceaccounts/token"]
+      - group: authentication.k8s.io
+        resources: ["tokenreviews"]
+      - group: authorization.k8s.io
+        resources: ["subjectaccessreviews", "selfsubjectaccessreviews"]
+  - level: RequestResponse
+    verbs: ["create", "update", "patch", "delete", "deletecollection"]
+  - level: Metadata
+`
+
+// auditWebhookKubeconfig is the file telling the API server where to send audit events, next to the API server files
+const auditWebhookKubeconfig = "audit-webhook.kubeconfig"
+
+// configureAuditFlags sets the audit flags of the API server
+// audit logging is on unless the log path is none, the default policy is written next to the API server files
+// the API server sends its events to the kubesolo webhook server, which chains every line of the log to the one
+// before it and seals the head of the chain, see audit.Log, so edited, removed or reordered lines can be detected
+func (s *service) configureAuditFlags(command *cobra.Command) error {
+	logPath := s.config.AuditLogPath
+	if logPath == "" {
+		logPath = s.embedded.AuditLogFile
+	}
+	if logPath == "none" {
+		log.Warn().Str("component", "apiserver").Msg("audit logging is disabled, changes made through the Kubernetes API are not recorded")
+		return nil
+	}
+
+	policyFile := s.config.AuditPolicyFile
+	if policyFile == "" {
+		policyFile = filepath.Join(s.serverPath, "audit-policy.yaml")
+		if err := filesystem.EnsureDirectoryExists(s.serverPath); err != nil {
+			return fmt.Errorf("failed to create API server directory: %v", err)
+		}
+		if err := os.WriteFile(policyFile, []byte(defaultAuditPolicy), 0600); err != nil {
+			return fmt.Errorf("failed to write default audit policy: %v", err)
+		}
+	} else if _, err := os.Stat(policyFile); err != nil {
+		return fmt.Errorf("failed to read audit policy: %v", err)
+	}
+
+	auditLog, err := audit.Open(audit.Options{
+		Path:        logPath,
+		SealKeyFile: s.embedded.AuditSealKeyFile,
+		MaxSize:     s.config.AuditLogMaxSize,
+		MaxBackups:  s.config.AuditLogMaxBackup,
+		MaxAge:      s.config.AuditLogMaxAge,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %v", err)
+	}
+	s.kubeSoloWebhook.auditLog = auditLog
+
+	webhookConfigFile, err := s.writeAuditWebhookKubeconfig()
+	if err != nil {
+		return err
+	}
+
+	flags := command.Flags()
+	_ = flags.Set("audit-policy-file", policyFile)
+	_ = flags.Set("audit-webhook-config-file", webhookConfigFile)
+	// each request waits until its event is written, nothing is lost in a buffer when the device loses power
+	_ = flags.Set("audit-webhook-mode", "blocking")
+	_ = flags.Set("audit-webhook-version", "audit.k8s.io/v1")
+
+	log.Info().Str("component", "apiserver").Msgf("audit logging to %s with policy %s", logPath, policyFile)
+	return nil
+}
+
+// writeAuditWebhookKubeconfig writes the kubeconfig the API server sends audit events with
+// the API server authenticates with its own certificate, the files are referenced so renewed certificates are picked up
+func (s *service) writeAuditWebhookKubeconfig() (string, error) {
+	config := clientcmdapi.NewConfig()
+	config.Clusters["audit"] = &clientcmdapi.Cluster{
+		Server:               fmt.Sprintf("https://127.0.0.1:%d%s", types.DefaultWebhookPort, auditWebhookPath),
+		CertificateAuthority: s.embedded.CACerts.Bundle,
+	}
+	config.AuthInfos["kube-apiserver"] = &clientcmdapi.AuthInfo{
+		ClientCertificate: s.apiServerCertFile,
+		ClientKey:         s.apiServerKeyFile,
+	}
+	config.Contexts["audit"] = &clientcmdapi.Context{
+		Cluster:  "audit",
+		AuthInfo: "kube-apiserver",
+	}
+	config.CurrentContext = "audit"
+
+	path := filepath.Join(s.serverPath, auditWebhookKubeconfig)
+	if err := clientcmd.WriteToFile(*config, path); err != nil {
+		return "", fmt.Errorf("failed to write audit webhook kubeconfig: %v", err)
+	}
+	return path, nil
+}
@@ -0,0 +1,85 @@
+package apiserver
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// auditWebhookPath is where the webhook server receives the audit events of the API server
+	auditWebhookPath = "/audit"
+	// auditClientName is the common name of the certificate the API server sends audit events with
+	auditClientName = "kube-apiserver"
+	// maxAuditBatchSize is the largest batch of events read, writes of big objects are recorded with their bodies
+	maxAuditBatchSize = 32 * 1024 * 1024
+)
+
+// auditEventList holds the events of an audit.k8s.io/v1 EventList, they are written to the log as received
+type auditEventList struct {
+	Items []json.RawMessage `json:"items"`
+}
+
+// serveAudit appends the audit events sent by the API server to the audit log
+// the events are only accepted from the API server, recognized by its client certificate signed by the cluster CA
+func (w *webhoook) serveAudit(resp http.ResponseWriter, req *http.Request) {
+	if !w.validateRequest(resp, req) {
+		return
+	}
+	if err := w.verifyAuditClient(req); err != nil {
+		log.Warn().Str("component", "webhook").Msgf("rejected audit events from %s: %v", req.RemoteAddr, err)
+		http.Error(resp, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	var events auditEventList
+	if err := json.NewDecoder(http.MaxBytesReader(resp, req.Body, maxAuditBatchSize)).Decode(&events); err != nil {
+		http.Error(resp, fmt.Sprintf("failed to decode audit events: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := w.auditLog.Append(events.Items); err != nil {
+		log.Error().Str("component", "webhook").Msgf("failed to write audit events: %v", err)
+		http.Error(resp, "failed to write audit events", http.StatusInternalServerError)
+		return
+	}
+	resp.WriteHeader(http.StatusOK)
+}
+
+// verifyAuditClient checks the client certificate of an audit request against the CA file
+// the CA file is read on every request so it follows a CA rotation
+func (w *webhoook) verifyAuditClient(req *http.Request) error {
+	if req.TLS == nil || len(req.TLS.PeerCertificates) == 0 {
+		return fmt.Errorf("no client certificate")
+	}
+
+	caPEM, err := os.ReadFile(filepath.Join(w.pkiPath, "ca", "ca.crt"))
+	if err != nil {
+		return fmt.Errorf("failed to read CA certificate: %v", err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(caPEM) {
+		return fmt.Errorf("no CA certificate found")
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range req.TLS.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	client := req.TLS.PeerCertificates[0]
+	if _, err := client.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}); err != nil {
+		return fmt.Errorf("invalid client certificate: %v", err)
+	}
+	if client.Subject.CommonName != auditClientName {
+		return fmt.Errorf("client certificate of %q is not the API server", client.Subject.CommonName)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package apiserver
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/portainer/kubesolo/internal/core/audit"
+)
+
+// newTestCertificate signs a certificate for commonName with the parent, or self-signs a CA when parent is nil
+func newTestCertificate(t *testing.T, commonName string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+		template.ExtKeyUsage = nil
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func TestServeAudit(t *testing.T) {
+	pkiPath := t.TempDir()
+	ca, caKey := newTestCertificate(t, "kubesolo-ca", nil, nil)
+	if err := os.MkdirAll(filepath.Join(pkiPath, "ca"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(pkiPath, "ca", "ca.crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	apiServer, _ := newTestCertificate(t, auditClientName, ca, caKey)
+	admin, _ := newTestCertificate(t, "kubesolo-admin", ca, caKey)
+	otherCA, otherCAKey := newTestCertificate(t, "other-ca", nil, nil)
+	forged, _ := newTestCertificate(t, auditClientName, otherCA, otherCAKey)
+
+	logDir := t.TempDir()
+	options := audit.Options{Path: filepath.Join(logDir, "audit.log"), SealKeyFile: filepath.Join(logDir, "seal.key")}
+	auditLog, err := audit.Open(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer auditLog.Close()
+	w := &webhoook{pkiPath: pkiPath, auditLog: auditLog}
+
+	events := `{"kind":"EventList","apiVersion":"audit.k8s.io/v1","items":[{"auditID":"1","verb":"create"},{"auditID":"2","verb":"delete"}]}`
+	tests := []struct {
+		name     string
+		client   *x509.Certificate
+		expected int
+	}{
+		{name: "API server", client: apiServer, expected: http.StatusOK},
+		{name: "no client certificate", client: nil, expected: http.StatusForbidden},
+		{name: "other user", client: admin, expected: http.StatusForbidden},
+		{name: "other CA", client: forged, expected: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, auditWebhookPath, bytes.NewBufferString(events))
+			req.TLS = &tls.ConnectionState{}
+			if tt.client != nil {
+				req.TLS.PeerCertificates = []*x509.Certificate{tt.client}
+			}
+			resp := httptest.NewRecorder()
+			w.serveAudit(resp, req)
+			if resp.Code != tt.expected {
+				t.Errorf("serveAudit() status = %d, expected %d: %s", resp.Code, tt.expected, resp.Body.String())
+			}
+		})
+	}
+
+	// only the events of the API server were written
+	result, err := audit.Verify(options.Path, options.SealKeyFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Records != 2 {
+		t.Errorf("audit log has %d lines, expected 2", result.Records)
+	}
+}
@@ -0,0 +1,216 @@
+package apiserver
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/portainer/kubesolo/pkg/kubernetes/scheduler"
+	"github.com/portainer/kubesolo/types"
+	"github.com/rs/zerolog/log"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+// fallbackBinderResync is how often pods without a node are retried, a pod that did not fit is bound once resources free up
+const fallbackBinderResync = 30 * time.Second
+
+// runFallbackBinder binds the pods created without a node name to the node
+// the mutating webhook sets the node name of new pods but fails open, so a pod created while the webhook was down,
+// not registered yet or not trusted by the API server would stay pending forever without a scheduler
+// the reason the webhook was missed is logged for every pod bound here
+func (w *webhoook) runFallbackBinder(ctx context.Context) {
+	if w.clientset == nil {
+		log.Error().Str("component", "webhook").Msg("no kubernetes client, pods created without a node name will not be bound")
+		return
+	}
+
+	// the pods without a node, the pods of the node and the node itself are each watched with a field selector,
+	// so the fit checks read them from the caches instead of the API server
+	factories := []informers.SharedInformerFactory{}
+	newFactory := func(field, value string) informers.SharedInformerFactory {
+		factory := informers.NewSharedInformerFactoryWithOptions(w.clientset, fallbackBinderResync,
+			informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+				options.FieldSelector = fields.OneTermEqualSelector(field, value).String()
+			}),
+		)
+		factories = append(factories, factory)
+		return factory
+	}
+	unboundInformer := newFactory("spec.nodeName", "").Core().V1().Pods()
+	nodePodInformer := newFactory("spec.nodeName", w.nodeName).Core().V1().Pods()
+	nodeInformer := newFactory("metadata.name", w.nodeName).Core().V1().Nodes()
+
+	// changes are coalesced, a burst of pods created while the webhook was down is bound in a single pass
+	trigger := make(chan struct{}, 1)
+	notify := func() {
+		select {
+		case trigger <- struct{}{}:
+		default:
+		}
+	}
+	if _, err := unboundInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(any) { notify() },
+		UpdateFunc: func(_, _ any) { notify() },
+	}); err != nil {
+		log.Error().Str("component", "webhook").Msgf("failed to watch pods without a node name: %v", err)
+		return
+	}
+	nodePodInformer.Informer()
+	nodeInformer.Informer()
+
+	for _, factory := range factories {
+		factory.Start(ctx.Done())
+		defer factory.Shutdown()
+	}
+	for _, factory := range factories {
+		factory.WaitForCacheSync(ctx.Done())
+	}
+
+	log.Info().Str("component", "webhook").Msg("fallback binder started for pods created without a node name")
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-trigger:
+		}
+
+		node, err := nodeInformer.Lister().Get(w.nodeName)
+		if err != nil {
+			log.Debug().Str("component", "webhook").Msgf("node %s is not registered yet, pods created without a node name are bound once it is: %v", w.nodeName, err)
+			continue
+		}
+		pods, err := unboundInformer.Lister().List(labels.Everything())
+		if err != nil {
+			log.Error().Str("component", "webhook").Msgf("failed to list pods without a node name: %v", err)
+			continue
+		}
+		nodePods, err := nodePodInformer.Lister().List(labels.Everything())
+		if err != nil {
+			log.Error().Str("component", "webhook").Msgf("failed to list the pods of node %s: %v", w.nodeName, err)
+			continue
+		}
+		w.bindUnboundPods(ctx, node, pods, nodePods)
+	}
+}
+
+// bindUnboundPods binds the pods the node can run, oldest first
+// the others are left pending with the PodScheduled condition set to Unschedulable and the reasons, as the scheduler does
+// pods asking for another scheduler are left to it
+func (w *webhoook) bindUnboundPods(ctx context.Context, node *corev1.Node, pods, nodePods []*corev1.Pod) {
+	bound := make([]corev1.Pod, 0, len(nodePods))
+	for _, pod := range nodePods {
+		bound = append(bound, *pod)
+	}
+
+	pods = slices.Clone(pods)
+	slices.SortStableFunc(pods, func(a, b *corev1.Pod) int {
+		return a.CreationTimestamp.Compare(b.CreationTimestamp.Time)
+	})
+
+	for _, cached := range pods {
+		if cached.Spec.NodeName != "" || cached.DeletionTimestamp != nil || !scheduler.IsScheduledByKubeSolo(cached) ||
+			cached.Status.Phase == corev1.PodSucceeded || cached.Status.Phase == corev1.PodFailed {
+			continue
+		}
+
+		// the pod is checked as the validating webhook would have checked it once bound by the mutating webhook
+		pod := cached.DeepCopy()
+		pod.Spec.NodeName = w.nodeName
+		reasons := append(scheduler.SchedulingReasons(pod, node), scheduler.CapacityReasons(pod, node, bound)...)
+		if len(reasons) > 0 {
+			w.markUnschedulable(ctx, cached.DeepCopy(), reasons)
+			continue
+		}
+
+		bindCtx, cancel := context.WithTimeout(ctx, types.DefaultContextTimeout)
+		err := scheduler.Bind(bindCtx, w.clientset, cached, w.nodeName)
+		cancel()
+		if err != nil {
+			log.Error().Str("component", "webhook").Str("pod", pod.Name).Str("namespace", pod.Namespace).Msgf("failed to bind pod created without a node name: %v", err)
+			continue
+		}
+		// the caches only see the binding later, the pod holds its resources for the next pods of this pass
+		bound = append(bound, *pod)
+
+		log.Warn().Str("component", "webhook").
+			Str("pod", pod.Name).
+			Str("namespace", pod.Namespace).
+			Msgf("bound pod created without a node name to node %s, the webhook was missed: %s", w.nodeName, w.diagnoseWebhook(ctx, cached))
+	}
+}
+
+// markUnschedulable records why a pod created without a node name cannot run on the node, the status is only written when the reasons change
+func (w *webhoook) markUnschedulable(ctx context.Context, pod *corev1.Pod, reasons []string) {
+	ctx, cancel := context.WithTimeout(ctx, types.DefaultContextTimeout)
+	defer cancel()
+
+	message, err := scheduler.MarkUnschedulable(ctx, w.clientset, pod, "", reasons)
+	if err != nil {
+		log.Error().Str("component", "webhook").Str("pod", pod.Name).Str("namespace", pod.Namespace).Msgf("failed to update the status of pod created without a node name: %v", err)
+		return
+	}
+	if message != "" {
+		log.Warn().Str("component", "webhook").
+			Str("pod", pod.Name).
+			Str("namespace", pod.Namespace).
+			Msgf("pod created without a node name cannot run on node %s, leaving it pending: %s", w.nodeName, message)
+	}
+}
+
+// diagnoseWebhook returns the most likely reason the API server created the pod without calling the mutating webhook
+// the current state of the webhook is checked the way the API server calls it, with the CA bundle of its configuration
+func (w *webhoook) diagnoseWebhook(ctx context.Context, pod *corev1.Pod) string {
+	ctx, cancel := context.WithTimeout(ctx, types.DefaultContextTimeout)
+	defer cancel()
+
+	config, err := w.clientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, types.DefaultWebhookName, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return fmt.Sprintf("the mutating webhook configuration %s does not exist", types.DefaultWebhookName)
+	}
+	if err != nil {
+		return fmt.Sprintf("the mutating webhook configuration %s cannot be read: %v", types.DefaultWebhookName, err)
+	}
+	if len(config.Webhooks) == 0 || config.Webhooks[0].ClientConfig.URL == nil {
+		return fmt.Sprintf("the mutating webhook configuration %s does not point to the webhook server", types.DefaultWebhookName)
+	}
+
+	clientConfig := config.Webhooks[0].ClientConfig
+	webhookURL, err := url.Parse(*clientConfig.URL)
+	if err != nil {
+		return fmt.Sprintf("the mutating webhook configuration %s has an invalid URL: %v", types.DefaultWebhookName, err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(clientConfig.CABundle) {
+		return fmt.Sprintf("the mutating webhook configuration %s has no valid CA bundle", types.DefaultWebhookName)
+	}
+
+	dialer := &tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: types.DefaultContextTimeout},
+		Config: &tls.Config{
+			RootCAs:    roots,
+			ServerName: webhookURL.Hostname(),
+		},
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", webhookURL.Host)
+	if err != nil {
+		return fmt.Sprintf("the API server cannot call the webhook at %s: %v", webhookURL.Host, err)
+	}
+	conn.Close()
+
+	if pod.CreationTimestamp.Time.Before(w.registeredAt) {
+		return "the pod was created before the webhook was registered at startup"
+	}
+	return "the webhook is reachable now, it was down or timed out when the pod was created"
+}
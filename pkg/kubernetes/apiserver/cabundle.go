@@ -0,0 +1,72 @@
+package apiserver
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	kubesolokubernetes "github.com/portainer/kubesolo/internal/kubernetes"
+	"github.com/portainer/kubesolo/types"
+	"github.com/rs/zerolog/log"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// UpdateCABundles sets the CA bundle of the webhook configurations and of the metrics APIService to the current CA bundle
+// the API server verifies the certificate of the webhook server with them, so they must follow a rotated CA,
+// the objects that are not registered yet are skipped as they get the current bundle when they are registered
+func UpdateCABundles(kubeconfig, caBundlePath string) error {
+	caBundle, err := os.ReadFile(caBundlePath)
+	if err != nil {
+		return fmt.Errorf("failed to read CA bundle: %v", err)
+	}
+
+	clientset, err := kubesolokubernetes.GetKubernetesClient(kubeconfig)
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes client: %v", err)
+	}
+	aggregatorClient, err := kubesolokubernetes.GetAggregatorClient(kubeconfig)
+	if err != nil {
+		return fmt.Errorf("failed to create aggregator client: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), types.DefaultContextTimeout)
+	defer cancel()
+
+	mutatingConfigs := clientset.AdmissionregistrationV1().MutatingWebhookConfigurations()
+	if config, err := mutatingConfigs.Get(ctx, types.DefaultWebhookName, metav1.GetOptions{}); err == nil {
+		for i := range config.Webhooks {
+			config.Webhooks[i].ClientConfig.CABundle = caBundle
+		}
+		if _, err := mutatingConfigs.Update(ctx, config, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("failed to update webhook configuration %s: %v", types.DefaultWebhookName, err)
+		}
+	} else if !k8serrors.IsNotFound(err) {
+		return fmt.Errorf("failed to get webhook configuration %s: %v", types.DefaultWebhookName, err)
+	}
+
+	validatingConfigs := clientset.AdmissionregistrationV1().ValidatingWebhookConfigurations()
+	if config, err := validatingConfigs.Get(ctx, types.DefaultValidatingWebhookName, metav1.GetOptions{}); err == nil {
+		for i := range config.Webhooks {
+			config.Webhooks[i].ClientConfig.CABundle = caBundle
+		}
+		if _, err := validatingConfigs.Update(ctx, config, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("failed to update webhook configuration %s: %v", types.DefaultValidatingWebhookName, err)
+		}
+	} else if !k8serrors.IsNotFound(err) {
+		return fmt.Errorf("failed to get webhook configuration %s: %v", types.DefaultValidatingWebhookName, err)
+	}
+
+	apiServices := aggregatorClient.ApiregistrationV1().APIServices()
+	if apiService, err := apiServices.Get(ctx, metricsAPIServiceName, metav1.GetOptions{}); err == nil {
+		apiService.Spec.CABundle = caBundle
+		if _, err := apiServices.Update(ctx, apiService, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("failed to update APIService %s: %v", metricsAPIServiceName, err)
+		}
+	} else if !k8serrors.IsNotFound(err) {
+		return fmt.Errorf("failed to get APIService %s: %v", metricsAPIServiceName, err)
+	}
+
+	log.Info().Str("component", "webhook").Msg("webhook configurations and APIService updated with the current CA bundle")
+	return nil
+}
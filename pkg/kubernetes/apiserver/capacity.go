@@ -0,0 +1,165 @@
+package apiserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	kubesolokubernetes "github.com/portainer/kubesolo/internal/kubernetes"
+	"github.com/portainer/kubesolo/pkg/kubernetes/scheduler"
+	"github.com/portainer/kubesolo/types"
+	"github.com/rs/zerolog/log"
+	admissionv1 "k8s.io/api/admission/v1"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// serveValidate handles validation requests
+// unless the built-in scheduler is enabled, pods are bound to the node by the webhook, so the checks of the scheduler
+// are made here and a pod the node cannot run is rejected with the reason instead of failing in the kubelet
+func (w *webhoook) serveValidate(resp http.ResponseWriter, req *http.Request) {
+	if !w.validateRequest(resp, req) {
+		return
+	}
+
+	admissionReview, err := w.decodeAdmissionReview(req)
+	if err != nil {
+		http.Error(resp, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response := &admissionv1.AdmissionResponse{
+		UID:     admissionReview.Request.UID,
+		Allowed: true,
+	}
+
+	if admissionReview.Request.Kind.Kind == "Pod" {
+		var pod corev1.Pod
+		if err := json.Unmarshal(admissionReview.Request.Object.Raw, &pod); err != nil {
+			log.Error().Str("component", "webhook").Err(err).Msg("failed to unmarshal pod")
+		} else if reasons := w.podFitsNode(req.Context(), &pod); len(reasons) > 0 {
+			message := fmt.Sprintf("pod cannot run on node %s: %s", w.nodeName, strings.Join(reasons, "; "))
+			log.Info().Str("component", "webhook").
+				Str("pod", pod.Name).
+				Str("namespace", admissionReview.Request.Namespace).
+				Msg(message)
+
+			response.Allowed = false
+			response.Result = &metav1.Status{
+				Status:  metav1.StatusFailure,
+				Message: message,
+				Reason:  metav1.StatusReasonForbidden,
+				Code:    http.StatusForbidden,
+			}
+		}
+	}
+
+	admissionReview.Response = response
+	resp.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(resp).Encode(admissionReview)
+}
+
+// podFitsNode returns the reasons the node cannot run the pod, it is empty when the pod fits
+// the pod is allowed when the node or its pods cannot be read, the kubelet still has the last word
+func (w *webhoook) podFitsNode(ctx context.Context, pod *corev1.Pod) []string {
+	if _, mirror := pod.Annotations[corev1.MirrorPodAnnotationKey]; mirror || w.clientset == nil {
+		return nil
+	}
+	if pod.Spec.NodeName != "" && pod.Spec.NodeName != w.nodeName {
+		return []string{fmt.Sprintf("spec.nodeName is set to %s, which is not a node of this cluster, remove it", pod.Spec.NodeName)}
+	}
+	// the scheduler checks a pod without a node when it binds it and preempts pods to make room if needed
+	if pod.Spec.NodeName == "" {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, types.DefaultContextTimeout)
+	defer cancel()
+
+	node, err := w.clientset.CoreV1().Nodes().Get(ctx, w.nodeName, metav1.GetOptions{})
+	if err != nil {
+		if !k8serrors.IsNotFound(err) {
+			log.Error().Str("component", "webhook").Msgf("failed to get node %s, skipping the capacity checks: %v", w.nodeName, err)
+		}
+		return nil
+	}
+
+	reasons := scheduler.SchedulingReasons(pod, node)
+
+	pods, err := w.clientset.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", w.nodeName).String(),
+	})
+	if err != nil {
+		log.Error().Str("component", "webhook").Msgf("failed to list the pods of node %s, skipping the capacity checks: %v", w.nodeName, err)
+		return reasons
+	}
+	return append(reasons, scheduler.CapacityReasons(pod, node, pods.Items)...)
+}
+
+// registerValidatingWebhook registers the webhook rejecting pods the node cannot run
+func (w *webhoook) registerValidatingWebhook() error {
+	caCert, err := w.readCABundle()
+	if err != nil {
+		return err
+	}
+
+	failurePolicy := admissionregistrationv1.Ignore
+	sideEffects := admissionregistrationv1.SideEffectClassNone
+	timeoutSeconds := int32(10)
+
+	webhookConfig := &admissionregistrationv1.ValidatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: types.DefaultValidatingWebhookName,
+		},
+		Webhooks: []admissionregistrationv1.ValidatingWebhook{
+			{
+				Name: types.DefaultValidatingWebhookName,
+				ClientConfig: admissionregistrationv1.WebhookClientConfig{
+					URL:      kubesolokubernetes.StringPtr(fmt.Sprintf("https://127.0.0.1:%d/validate", types.DefaultWebhookPort)),
+					CABundle: caCert,
+				},
+				Rules: []admissionregistrationv1.RuleWithOperations{
+					{
+						Operations: []admissionregistrationv1.OperationType{
+							admissionregistrationv1.Create,
+						},
+						Rule: admissionregistrationv1.Rule{
+							APIGroups:   []string{""},
+							APIVersions: []string{"v1"},
+							Resources:   []string{"pods"},
+						},
+					},
+				},
+				FailurePolicy:           &failurePolicy,
+				SideEffects:             &sideEffects,
+				TimeoutSeconds:          &timeoutSeconds,
+				AdmissionReviewVersions: []string{"v1"},
+			},
+		},
+	}
+
+	configs := w.clientset.AdmissionregistrationV1().ValidatingWebhookConfigurations()
+	existing, err := configs.Get(context.Background(), types.DefaultValidatingWebhookName, metav1.GetOptions{})
+	if err != nil {
+		if !k8serrors.IsNotFound(err) {
+			return fmt.Errorf("failed to get validating webhook configuration: %v", err)
+		}
+		if _, err := configs.Create(context.Background(), webhookConfig, metav1.CreateOptions{}); err != nil && !k8serrors.IsAlreadyExists(err) {
+			return fmt.Errorf("failed to create validating webhook configuration: %v", err)
+		}
+	} else {
+		webhookConfig.ResourceVersion = existing.ResourceVersion
+		if _, err := configs.Update(context.Background(), webhookConfig, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("failed to update validating webhook configuration: %v", err)
+		}
+	}
+
+	log.Info().Str("component", "webhook").Msgf("webhook %s registered with API server", types.DefaultValidatingWebhookName)
+	return nil
+}
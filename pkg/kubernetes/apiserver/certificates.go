@@ -0,0 +1,24 @@
+package apiserver
+
+import (
+	"github.com/portainer/kubesolo/internal/core/pki"
+	"github.com/rs/zerolog/log"
+)
+
+// CertificatesRenewed refreshes what depends on the content of a renewed certificate
+// the API server reloads its serving and client certificates from disk and the webhook reloads its own on the next handshake,
+// but the admin kubeconfig embeds the admin certificate and the webhook registrations embed the CA bundle it is verified with
+func (s *service) CertificatesRenewed(renewed []pki.CertificateType) {
+	for _, certType := range renewed {
+		switch certType {
+		case pki.AdminCert:
+			if err := s.generateKubeConfig(); err != nil {
+				log.Error().Str("component", "apiserver").Msgf("failed to regenerate the kubeconfig after renewal: %v...", err)
+			}
+		case pki.WebhookCert:
+			if err := UpdateCABundles(s.adminKubeconfig, s.embedded.CACerts.Bundle); err != nil {
+				log.Error().Str("component", "apiserver").Msgf("failed to update the CA bundle of the webhook after renewal: %v...", err)
+			}
+		}
+	}
+}
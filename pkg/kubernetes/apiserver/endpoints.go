@@ -0,0 +1,188 @@
+package apiserver
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/portainer/kubesolo/internal/runtime/network"
+	"github.com/portainer/kubesolo/types"
+	"github.com/rs/zerolog/log"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// kubernetesServiceName is the service the API server is reachable through from pods
+	kubernetesServiceName = "kubernetes"
+	// endpointsManagedBy marks the endpoint slice as managed by kubesolo instead of the API server
+	endpointsManagedBy = "kubesolo"
+)
+
+// runEndpointsReconciler keeps the kubernetes service endpoints on the node address until the context is cancelled
+// a failed reconcile is retried with an exponential backoff, then the endpoints are checked again on every interval,
+// so endpoints lost to a failed write or edited by hand are restored without waiting for an address change
+func (s *service) runEndpointsReconciler() {
+	backoff := types.DefaultEndpointsRetryDelay
+	for {
+		wait := types.DefaultEndpointsReconcileInterval
+		if err := s.ReconcileKubernetesEndpoints(); err != nil {
+			log.Warn().Str("component", "apiserver").Msgf("failed to set the kubernetes service endpoints, retrying in %s: %v", backoff, err)
+			wait = backoff
+			backoff = min(backoff*2, types.DefaultEndpointsReconcileInterval)
+		} else {
+			backoff = types.DefaultEndpointsRetryDelay
+		}
+
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// ReconcileKubernetesEndpoints points the endpoints of the kubernetes service at the current node address
+// the endpoint reconciler of the API server is disabled because it only knows the advertise address it was started with,
+// which goes stale when the host address changes
+// the endpoints of the resource metrics service follow the node address the same way
+// nothing is written when the endpoints already point at the node address
+func (s *service) ReconcileKubernetesEndpoints() error {
+	nodeIP, err := network.GetNodeIP()
+	if err != nil {
+		return fmt.Errorf("failed to get node IP address: %v", err)
+	}
+
+	clientset, err := s.initializeKubernetesClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, types.DefaultContextTimeout)
+	defer cancel()
+
+	endpointsChanged, err := s.reconcileEndpoints(ctx, clientset, nodeIP)
+	if err != nil {
+		return err
+	}
+	sliceChanged, err := s.reconcileEndpointSlice(ctx, clientset, nodeIP)
+	if err != nil {
+		return err
+	}
+	if s.metricsServer != nil {
+		if err := s.metricsServer.reconcileEndpoints(ctx, clientset, nodeIP); err != nil {
+			return err
+		}
+	}
+
+	if endpointsChanged || sliceChanged {
+		log.Info().Str("component", "apiserver").Msgf("kubernetes service endpoints set to %s:%d", nodeIP, types.DefaultAPIServerPort)
+	}
+	return nil
+}
+
+// reconcileEndpoints creates or updates the endpoints of the kubernetes service, it reports whether anything was written
+func (s *service) reconcileEndpoints(ctx context.Context, clientset *kubernetes.Clientset, nodeIP string) (bool, error) {
+	subsets := []corev1.EndpointSubset{
+		{
+			Addresses: []corev1.EndpointAddress{{IP: nodeIP}},
+			Ports: []corev1.EndpointPort{
+				{
+					Name:     "https",
+					Port:     types.DefaultAPIServerPort,
+					Protocol: corev1.ProtocolTCP,
+				},
+			},
+		},
+	}
+
+	endpointsClient := clientset.CoreV1().Endpoints(metav1.NamespaceDefault)
+	existing, err := endpointsClient.Get(ctx, kubernetesServiceName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = endpointsClient.Create(ctx, &corev1.Endpoints{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      kubernetesServiceName,
+				Namespace: metav1.NamespaceDefault,
+			},
+			Subsets: subsets,
+		}, metav1.CreateOptions{})
+		if err != nil {
+			return false, fmt.Errorf("failed to create kubernetes endpoints: %v", err)
+		}
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get kubernetes endpoints: %v", err)
+	}
+	if apiequality.Semantic.DeepEqual(existing.Subsets, subsets) {
+		return false, nil
+	}
+
+	existing.Subsets = subsets
+	if _, err := endpointsClient.Update(ctx, existing, metav1.UpdateOptions{}); err != nil {
+		return false, fmt.Errorf("failed to update kubernetes endpoints: %v", err)
+	}
+	return true, nil
+}
+
+// reconcileEndpointSlice creates or updates the endpoint slice of the kubernetes service, kube-proxy reads the service backends from it
+// it reports whether anything was written
+func (s *service) reconcileEndpointSlice(ctx context.Context, clientset *kubernetes.Clientset, nodeIP string) (bool, error) {
+	ready := true
+	portName := "https"
+	port := int32(types.DefaultAPIServerPort)
+	protocol := corev1.ProtocolTCP
+
+	slice := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      kubernetesServiceName,
+			Namespace: metav1.NamespaceDefault,
+			Labels: map[string]string{
+				discoveryv1.LabelServiceName: kubernetesServiceName,
+				discoveryv1.LabelManagedBy:   endpointsManagedBy,
+			},
+		},
+		AddressType: discoveryv1.AddressTypeIPv4,
+		Endpoints: []discoveryv1.Endpoint{
+			{
+				Addresses:  []string{nodeIP},
+				Conditions: discoveryv1.EndpointConditions{Ready: &ready},
+			},
+		},
+		Ports: []discoveryv1.EndpointPort{
+			{
+				Name:     &portName,
+				Port:     &port,
+				Protocol: &protocol,
+			},
+		},
+	}
+
+	slicesClient := clientset.DiscoveryV1().EndpointSlices(metav1.NamespaceDefault)
+	existing, err := slicesClient.Get(ctx, kubernetesServiceName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		if _, err := slicesClient.Create(ctx, slice, metav1.CreateOptions{}); err != nil {
+			return false, fmt.Errorf("failed to create kubernetes endpoint slice: %v", err)
+		}
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get kubernetes endpoint slice: %v", err)
+	}
+	if apiequality.Semantic.DeepEqual(existing.Labels, slice.Labels) &&
+		existing.AddressType == slice.AddressType &&
+		apiequality.Semantic.DeepEqual(existing.Endpoints, slice.Endpoints) &&
+		apiequality.Semantic.DeepEqual(existing.Ports, slice.Ports) {
+		return false, nil
+	}
+
+	slice.ResourceVersion = existing.ResourceVersion
+	if _, err := slicesClient.Update(ctx, slice, metav1.UpdateOptions{}); err != nil {
+		return false, fmt.Errorf("failed to update kubernetes endpoint slice: %v", err)
+	}
+	return true, nil
+}
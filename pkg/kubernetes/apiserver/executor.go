@@ -14,18 +14,13 @@ import (
 )
 
 // Run starts the API server in the following order:
-// 1. it generates the service account key
-// 2. it registers the admission plugins
-// 3. it sets the API server flags
-// 4. it starts the API server
-// 5. it waits for a signal to stop the API server
-// 6. it logs the termination of the API server
+// 1. it registers the admission plugins
+// 2. it sets the API server flags
+// 3. it starts the API server
+// 4. it waits for a signal to stop the API server
+// 5. it logs the termination of the API server
 func (s *service) Run(kineReadyCh chan struct{}) error {
 	log.Info().Str("component", "apiserver").Msg("starting API server...")
-	if err := s.generateServiceAccountKey(); err != nil {
-		log.Error().Str("component", "apiserver").Msgf("failed to generate the service account key: %v...", err)
-	}
-
 	register(admission.NewPlugins(), s.nodeName)
 
 	command := app.NewAPIServerCommand(nil)
@@ -42,6 +37,14 @@ func (s *service) Run(kineReadyCh chan struct{}) error {
 		return err
 	}
 
+	if s.metricsServer != nil {
+		if err := s.metricsServer.start(s.ctx); err != nil {
+			log.Error().Str("component", "apiserver").Msgf("failed to start the resource metrics server: %v...", err)
+			s.terminate()
+			return err
+		}
+	}
+
 	time.Sleep(types.DefaultComponentSleep)
 	if err := kubesoloservice.RunServiceWithStartupCheck(func() error {
 		<-kineReadyCh
@@ -90,6 +93,19 @@ func (s *service) postSetup() {
 	if err := s.kubeSoloWebhook.RegisterWebhook(s.adminKubeconfig); err != nil {
 		log.Error().Str("component", "apiserver").Msgf("failed to register the kubesolo webhook: %v...", err)
 	}
+	s.kubeSoloWebhook.watchRuleConfigMaps(s.ctx)
+	// the built-in scheduler binds every pod without a node name, otherwise the pods the webhook missed are bound here
+	if !s.config.Scheduler {
+		go s.kubeSoloWebhook.runFallbackBinder(s.ctx)
+	}
+
+	if s.metricsServer != nil {
+		if err := s.metricsServer.RegisterAPIService(s.adminKubeconfig); err != nil {
+			log.Error().Str("component", "apiserver").Msgf("failed to register the resource metrics API: %v...", err)
+		}
+	}
+
+	go s.runEndpointsReconciler()
 }
 
 func (s *service) terminate() {
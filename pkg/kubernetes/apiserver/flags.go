@@ -2,6 +2,7 @@ package apiserver
 
 import (
 	"fmt"
+	"slices"
 
 	"github.com/portainer/kubesolo/internal/runtime/network"
 	"github.com/portainer/kubesolo/types"
@@ -19,20 +20,50 @@ func (s *service) configureAPIServerFlags(command *cobra.Command) error {
 	_ = flags.Set("insecure-port", "0")
 	_ = flags.Set("secure-port", "6443")
 	_ = flags.Set("bind-address", "0.0.0.0")
+	// the advertise address is read once, it stays on the address kubesolo started with until the next restart
 	_ = flags.Set("advertise-address", nodeIP)
+	// the kubernetes service endpoints follow the node address instead, see runEndpointsReconciler
+	_ = flags.Set("endpoint-reconciler-type", "none")
 	_ = flags.Set("cert-dir", s.pkiAPIServerDir)
+	_ = flags.Set("tls-cert-file", s.apiServerCertFile)
+	_ = flags.Set("tls-private-key-file", s.apiServerKeyFile)
 	_ = flags.Set("service-account-issuer", "kubernetes.default.svc")
 	_ = flags.Set("service-account-signing-key-file", s.serviceAccountKeyFile)
-	_ = flags.Set("service-account-key-file", s.serviceAccountKeyFile)
+	// the verification set holds the current key and the rotated keys still within their grace period
+	_ = flags.Set("service-account-key-file", s.serviceAccountPubFile)
 	_ = flags.Set("api-audiences", "kubernetes.default.svc")
+	_ = flags.Set("encryption-provider-config", s.encryptionConfigFile)
+	_ = flags.Set("encryption-provider-config-automatic-reload", "true")
 	_ = flags.Set("service-cluster-ip-range", types.DefaultServiceClusterIPRange)
 	_ = flags.Set("allow-privileged", "true")
 	_ = flags.Set("authorization-mode", "Node,RBAC")
 	_ = flags.Set("client-ca-file", s.caFile)
 	_ = flags.Set("kubelet-client-certificate", s.apiServerCertFile)
 	_ = flags.Set("kubelet-client-key", s.apiServerKeyFile)
-	_ = flags.Set("enable-admission-plugins", "NodeRestriction,ServiceAccount,MutatingAdmissionWebhook,DefaultStorageClass")
-	_ = flags.Set("disable-admission-plugins", "ValidatingAdmissionWebhook,RuntimeClass,PodSecurity,CertificateApproval,CertificateSigning,ClusterTrustBundleAttest,CertificateSubjectRestriction,MutatingAdmissionPolicy,ValidatingAdmissionPolicy,DefaultIngressClass,TaintNodesByCondition,Priority,DefaultTolerationSeconds,StorageObjectInUseProtection,PersistentVolumeClaimResize,ResourceQuota,LimitRanger")
+	// the aggregation layer proxies requests to aggregated API servers such as metrics-server with the front-proxy client certificate,
+	// they trust the user and groups it sends in the request headers
+	_ = flags.Set("requestheader-client-ca-file", s.frontProxyCAFile)
+	_ = flags.Set("requestheader-allowed-names", "front-proxy-client")
+	_ = flags.Set("requestheader-username-headers", "X-Remote-User")
+	_ = flags.Set("requestheader-group-headers", "X-Remote-Group")
+	_ = flags.Set("requestheader-extra-headers-prefix", "X-Remote-Extra-")
+	_ = flags.Set("proxy-client-cert-file", s.frontProxyCertFile)
+	_ = flags.Set("proxy-client-key-file", s.frontProxyKeyFile)
+	// aggregated API servers are reached through their endpoints, so they do not depend on the kube-proxy rules of their service
+	_ = flags.Set("enable-aggregator-routing", "true")
+	admissionPlugins := s.config.AdmissionPlugins
+	// the scheduler orders and preempts pods by the priority the Priority plugin resolves from their priority class
+	if s.config.Scheduler {
+		admissionPlugins = append(slices.Clone(admissionPlugins), "Priority")
+	}
+	enabledPlugins, disabledPlugins := admissionPluginFlags(admissionPlugins)
+	_ = flags.Set("enable-admission-plugins", enabledPlugins)
+	_ = flags.Set("disable-admission-plugins", disabledPlugins)
+	admissionConfigFile, err := s.writeAdmissionConfig()
+	if err != nil {
+		return err
+	}
+	_ = flags.Set("admission-control-config-file", admissionConfigFile)
 	_ = flags.Set("max-requests-inflight", "50")
 	_ = flags.Set("max-mutating-requests-inflight", "25")
 	_ = flags.Set("etcd-compaction-interval", "30m")
@@ -43,12 +74,17 @@ func (s *service) configureAPIServerFlags(command *cobra.Command) error {
 	_ = flags.Set("enable-bootstrap-token-auth", "false")
 	_ = flags.Set("enable-garbage-collector", "false")
 	_ = flags.Set("profiling", "false")
-	_ = flags.Set("audit-log-path", "-")
-	_ = flags.Set("audit-log-maxage", "0")
-	_ = flags.Set("audit-log-maxbackup", "0")
-	_ = flags.Set("audit-log-maxsize", "0")
 	_ = flags.Set("min-request-timeout", "30")
 	_ = flags.Set("request-timeout", "300s")
+	if len(s.config.FeatureGates) > 0 {
+		_ = flags.Set("feature-gates", s.config.FeatureGates.String())
+	}
+	if s.config.RuntimeConfig != "" {
+		_ = flags.Set("runtime-config", s.config.RuntimeConfig)
+	}
 
-	return nil
+	if err := s.configureOIDCFlags(command); err != nil {
+		return err
+	}
+	return s.configureAuditFlags(command)
 }
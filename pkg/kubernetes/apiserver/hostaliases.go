@@ -0,0 +1,143 @@
+package apiserver
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"slices"
+
+	"github.com/rs/zerolog/log"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// hostAliasesConfigMapName holds host aliases managed through the Kubernetes API, next to the ones of the host aliases file
+	hostAliasesConfigMapName = "kubesolo-host-aliases"
+	// hostAliasesConfigMapKey is the key of the ConfigMap holding the host aliases in the format of the host aliases file
+	hostAliasesConfigMapKey = "host-aliases.yaml"
+)
+
+// hostAliasesConfig is the format of the host aliases file and ConfigMap
+type hostAliasesConfig struct {
+	HostAliases []hostAliasRule `json:"hostAliases"`
+}
+
+// hostAliasRule adds the hostnames of an IP address to the /etc/hosts of pods
+// it applies to every pod unless it is limited to namespaces or to pods matching a label selector
+type hostAliasRule struct {
+	IP         string   `json:"ip"`
+	Hostnames  []string `json:"hostnames"`
+	Namespaces []string `json:"namespaces,omitempty"`
+	Selector   string   `json:"selector,omitempty"`
+
+	selector labels.Selector
+}
+
+// LoadHostAliases reads and validates a host aliases file, it is used to reject a broken file at startup
+func LoadHostAliases(path string) error {
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read host aliases file: %v", err)
+	}
+	if _, err := parseHostAliases(data); err != nil {
+		return fmt.Errorf("invalid host aliases file %s: %v", path, err)
+	}
+	return nil
+}
+
+// parseHostAliases parses and validates host alias rules
+func parseHostAliases(data []byte) ([]hostAliasRule, error) {
+	var config hostAliasesConfig
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, err
+	}
+
+	for i := range config.HostAliases {
+		rule := &config.HostAliases[i]
+		if net.ParseIP(rule.IP) == nil {
+			return nil, fmt.Errorf("host alias %d: invalid IP address %q", i, rule.IP)
+		}
+		if len(rule.Hostnames) == 0 {
+			return nil, fmt.Errorf("host alias %s: at least one hostname is required", rule.IP)
+		}
+
+		selector, err := labels.Parse(rule.Selector)
+		if err != nil {
+			return nil, fmt.Errorf("host alias %s: invalid selector: %v", rule.IP, err)
+		}
+		rule.selector = selector
+	}
+	return config.HostAliases, nil
+}
+
+// matches reports whether the rule applies to the pod
+func (r hostAliasRule) matches(pod corev1.Pod, namespace string) bool {
+	if len(r.Namespaces) > 0 && !slices.Contains(r.Namespaces, namespace) {
+		return false
+	}
+	return r.selector == nil || r.selector.Matches(labels.Set(pod.Labels))
+}
+
+// createHostAliasesPatch creates the patches adding the matching host aliases to the pod
+// hostnames the pod already resolves through its own host aliases are left to the pod
+func (w *webhoook) createHostAliasesPatch(pod corev1.Pod, namespace string) []map[string]interface{} {
+	defined := map[string]bool{}
+	for _, alias := range pod.Spec.HostAliases {
+		for _, hostname := range alias.Hostnames {
+			defined[hostname] = true
+		}
+	}
+
+	aliases := []corev1.HostAlias{}
+	for _, rule := range w.hostAliases.rules() {
+		if !rule.matches(pod, namespace) {
+			continue
+		}
+
+		hostnames := []string{}
+		for _, hostname := range rule.Hostnames {
+			if !defined[hostname] {
+				defined[hostname] = true
+				hostnames = append(hostnames, hostname)
+			}
+		}
+		if len(hostnames) > 0 {
+			aliases = append(aliases, corev1.HostAlias{IP: rule.IP, Hostnames: hostnames})
+		}
+	}
+	if len(aliases) == 0 {
+		return nil
+	}
+
+	log.Info().Str("component", "webhook").
+		Str("pod", pod.Name).
+		Str("namespace", namespace).
+		Int("aliases", len(aliases)).
+		Msg("adding host aliases to pod")
+
+	if len(pod.Spec.HostAliases) == 0 {
+		return []map[string]interface{}{
+			{
+				"op":    "add",
+				"path":  "/spec/hostAliases",
+				"value": aliases,
+			},
+		}
+	}
+
+	patches := []map[string]interface{}{}
+	for _, alias := range aliases {
+		patches = append(patches, map[string]interface{}{
+			"op":    "add",
+			"path":  "/spec/hostAliases/-",
+			"value": alias,
+		})
+	}
+	return patches
+}
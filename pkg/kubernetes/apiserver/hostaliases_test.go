@@ -0,0 +1,104 @@
+package apiserver
+
+import (
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseHostAliases(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		expect  int
+		wantErr string
+	}{
+		{name: "empty", data: "", expect: 0},
+		{
+			name: "rules",
+			data: `hostAliases:
+  - ip: 10.0.0.10
+    hostnames: [registry.local]
+  - ip: "fd00::10"
+    hostnames: [mqtt.local, broker.local]
+    namespaces: [apps]
+    selector: app=sensor
+`,
+			expect: 2,
+		},
+		{name: "invalid IP address", data: "hostAliases:\n  - ip: 10.0.0\n    hostnames: [registry.local]\n", wantErr: "invalid IP address"},
+		{name: "no hostnames", data: "hostAliases:\n  - ip: 10.0.0.10\n", wantErr: "at least one hostname"},
+		{name: "invalid selector", data: "hostAliases:\n  - ip: 10.0.0.10\n    hostnames: [registry.local]\n    selector: app in (\n", wantErr: "invalid selector"},
+		{name: "unknown field", data: "hostAliases:\n  - ip: 10.0.0.10\n    hostname: registry.local\n", wantErr: "unknown field"},
+		{name: "not YAML", data: "hostAliases: [", wantErr: "error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := parseHostAliases([]byte(tt.data))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected an error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(rules) != tt.expect {
+				t.Fatalf("parsed %d rules, expected %d", len(rules), tt.expect)
+			}
+			for _, rule := range rules {
+				if rule.selector == nil {
+					t.Errorf("rule %s has no parsed selector", rule.IP)
+				}
+			}
+		})
+	}
+}
+
+func TestHostAliasRuleMatches(t *testing.T) {
+	rules, err := parseHostAliases([]byte(`hostAliases:
+  - ip: 10.0.0.10
+    hostnames: [everywhere.local]
+  - ip: 10.0.0.11
+    hostnames: [apps.local]
+    namespaces: [apps, tools]
+  - ip: 10.0.0.12
+    hostnames: [sensor.local]
+    namespaces: [apps]
+    selector: app=sensor
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	everywhere, namespaced, selected := rules[0], rules[1], rules[2]
+
+	sensor := corev1.Pod{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "sensor"}}}
+	web := corev1.Pod{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "web"}}}
+
+	tests := []struct {
+		name      string
+		rule      hostAliasRule
+		pod       corev1.Pod
+		namespace string
+		expect    bool
+	}{
+		{name: "rule without limits", rule: everywhere, pod: web, namespace: "default", expect: true},
+		{name: "listed namespace", rule: namespaced, pod: web, namespace: "tools", expect: true},
+		{name: "other namespace", rule: namespaced, pod: web, namespace: "default", expect: false},
+		{name: "matching labels", rule: selected, pod: sensor, namespace: "apps", expect: true},
+		{name: "other labels", rule: selected, pod: web, namespace: "apps", expect: false},
+		{name: "matching labels in another namespace", rule: selected, pod: sensor, namespace: "tools", expect: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rule.matches(tt.pod, tt.namespace); got != tt.expect {
+				t.Errorf("matches() = %v, expected %v", got, tt.expect)
+			}
+		})
+	}
+}
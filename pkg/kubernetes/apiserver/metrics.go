@@ -0,0 +1,587 @@
+package apiserver
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/portainer/kubesolo/internal/core/pki"
+	kubesolokubernetes "github.com/portainer/kubesolo/internal/kubernetes"
+	"github.com/portainer/kubesolo/types"
+	"github.com/rs/zerolog/log"
+	corev1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+	apiregistrationv1 "k8s.io/kube-aggregator/pkg/apis/apiregistration/v1"
+	statsv1alpha1 "k8s.io/kubelet/pkg/apis/stats/v1alpha1"
+	metricsv1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+)
+
+const (
+	// metricsServiceName is the service the aggregation layer reaches the resource metrics API through
+	metricsServiceName = "kubesolo-metrics"
+	// metricsAPIServiceName registers the metrics.k8s.io group with the aggregation layer
+	metricsAPIServiceName = "v1beta1.metrics.k8s.io"
+	// metricsGroupVersion is the API version of the served objects
+	metricsGroupVersion = "metrics.k8s.io/v1beta1"
+	// metricsWindow is the interval the CPU usage reported by the kubelet is averaged over,
+	// it follows the stats_collect_period of containerd
+	metricsWindow = 10 * time.Second
+	// metricsCacheTTL is how long a scraped summary answers requests, kubectl top and the HPA controller ask in bursts
+	metricsCacheTTL = 5 * time.Second
+	// kubeletSummaryURL is the CPU and memory summary of the local kubelet
+	kubeletSummaryURL = "https://127.0.0.1:10250/stats/summary?only_cpu_and_memory=true"
+)
+
+// metricsServer serves the resource metrics API from the stats summary of the local kubelet
+// it replaces a metrics-server deployment, the API server proxies metrics.k8s.io requests to it through the aggregation layer
+type metricsServer struct {
+	server   *http.Server
+	nodeName string
+	embedded types.Embedded
+	kubelet  *http.Client
+	// clientset is set once the API service is registered, after the server already serves requests
+	clientset atomic.Pointer[kubernetes.Clientset]
+
+	mu        sync.Mutex
+	summary   *statsv1alpha1.Summary
+	scrapedAt time.Time
+}
+
+// newMetricsServer creates a new resource metrics server
+func newMetricsServer(nodeName string, embedded types.Embedded) *metricsServer {
+	return &metricsServer{
+		nodeName: nodeName,
+		embedded: embedded,
+	}
+}
+
+// start starts the resource metrics server
+// it serves the webhook certificate and only accepts requests proxied by the API server with the front-proxy client certificate,
+// the API server has authorized them before proxying
+func (m *metricsServer) start(ctx context.Context) error {
+	servingCert, err := pki.NewKeyPairReloader(m.embedded.WebhookCerts.Cert, m.embedded.WebhookCerts.Key)
+	if err != nil {
+		return fmt.Errorf("failed to load metrics serving certificate: %v", err)
+	}
+	clientCert, err := pki.NewKeyPairReloader(m.embedded.APIServerCerts.Cert, m.embedded.APIServerCerts.Key)
+	if err != nil {
+		return fmt.Errorf("failed to load kubelet client certificate: %v", err)
+	}
+
+	frontProxyCAs, err := loadCertPool(m.embedded.FrontProxyCACerts.Cert)
+	if err != nil {
+		return fmt.Errorf("failed to load front-proxy CA: %v", err)
+	}
+	clusterCAs, err := loadCertPool(m.embedded.CACerts.Bundle)
+	if err != nil {
+		return fmt.Errorf("failed to load CA bundle: %v", err)
+	}
+
+	// the kubelet serving certificate is signed by the cluster CA for the node name through a CSR
+	m.kubelet = &http.Client{
+		Timeout: types.DefaultContextTimeout,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				RootCAs:    clusterCAs,
+				ServerName: m.nodeName,
+				GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+					return clientCert.GetCertificate(nil)
+				},
+			},
+		},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /apis/metrics.k8s.io/v1beta1", m.serveResources)
+	mux.HandleFunc("GET /apis/metrics.k8s.io/v1beta1/{$}", m.serveResources)
+	mux.HandleFunc("GET /apis/metrics.k8s.io/v1beta1/nodes", m.serveNodes)
+	mux.HandleFunc("GET /apis/metrics.k8s.io/v1beta1/nodes/{name}", m.serveNode)
+	mux.HandleFunc("GET /apis/metrics.k8s.io/v1beta1/pods", m.servePods)
+	mux.HandleFunc("GET /apis/metrics.k8s.io/v1beta1/namespaces/{namespace}/pods", m.servePods)
+	mux.HandleFunc("GET /apis/metrics.k8s.io/v1beta1/namespaces/{namespace}/pods/{name}", m.servePod)
+
+	m.server = &http.Server{
+		Addr:    fmt.Sprintf(":%d", types.DefaultMetricsPort),
+		Handler: requireFrontProxy(mux),
+		TLSConfig: &tls.Config{
+			GetCertificate: servingCert.GetCertificate,
+			ClientAuth:     tls.RequireAndVerifyClientCert,
+			ClientCAs:      frontProxyCAs,
+		},
+	}
+
+	log.Info().Str("component", "metrics").Msgf("starting resource metrics server on :%d", types.DefaultMetricsPort)
+
+	go func() {
+		if err := m.server.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+			log.Error().Str("component", "metrics").Err(err).Msg("resource metrics server failed")
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		if err := m.server.Shutdown(context.Background()); err != nil {
+			log.Error().Str("component", "metrics").Err(err).Msg("error shutting down resource metrics server")
+		}
+	}()
+
+	return nil
+}
+
+// loadCertPool reads the PEM certificates of a file into a certificate pool
+func loadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %s", path)
+	}
+	return pool, nil
+}
+
+// requireFrontProxy rejects requests that were not sent by the API server with the front-proxy client certificate
+func requireFrontProxy(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 || req.TLS.VerifiedChains[0][0].Subject.CommonName != "front-proxy-client" {
+			writeMetricsError(resp, http.StatusForbidden, metav1.StatusReasonForbidden, "requests must be proxied by the API server")
+			return
+		}
+		next.ServeHTTP(resp, req)
+	})
+}
+
+// serveResources serves the discovery document of metrics.k8s.io/v1beta1
+func (m *metricsServer) serveResources(resp http.ResponseWriter, _ *http.Request) {
+	verbs := metav1.Verbs{"get", "list"}
+	writeMetricsResponse(resp, &metav1.APIResourceList{
+		TypeMeta:     metav1.TypeMeta{Kind: "APIResourceList", APIVersion: "v1"},
+		GroupVersion: metricsGroupVersion,
+		APIResources: []metav1.APIResource{
+			{Name: "nodes", Kind: "NodeMetrics", Namespaced: false, Verbs: verbs},
+			{Name: "pods", Kind: "PodMetrics", Namespaced: true, Verbs: verbs},
+		},
+	})
+}
+
+// serveNodes lists the metrics of the node, an empty list is returned when the node does not match the selectors
+func (m *metricsServer) serveNodes(resp http.ResponseWriter, req *http.Request) {
+	summary, err := m.scrape(req.Context())
+	if err != nil {
+		writeMetricsError(resp, http.StatusServiceUnavailable, metav1.StatusReasonServiceUnavailable, err.Error())
+		return
+	}
+
+	list := &metricsv1beta1.NodeMetricsList{
+		TypeMeta: metav1.TypeMeta{Kind: "NodeMetricsList", APIVersion: metricsGroupVersion},
+		Items:    []metricsv1beta1.NodeMetrics{},
+	}
+
+	node, ok := nodeMetrics(summary.Node)
+	if ok {
+		selected, err := m.selectedNodes(req)
+		if err != nil {
+			writeMetricsError(resp, http.StatusBadRequest, metav1.StatusReasonBadRequest, err.Error())
+			return
+		}
+		if selected == nil || selected[node.Name] {
+			list.Items = append(list.Items, node)
+		}
+	}
+	writeMetricsResponse(resp, list)
+}
+
+// serveNode serves the metrics of the node
+func (m *metricsServer) serveNode(resp http.ResponseWriter, req *http.Request) {
+	summary, err := m.scrape(req.Context())
+	if err != nil {
+		writeMetricsError(resp, http.StatusServiceUnavailable, metav1.StatusReasonServiceUnavailable, err.Error())
+		return
+	}
+
+	name := req.PathValue("name")
+	node, ok := nodeMetrics(summary.Node)
+	if !ok || node.Name != name {
+		writeMetricsError(resp, http.StatusNotFound, metav1.StatusReasonNotFound, fmt.Sprintf("nodemetrics %q not found", name))
+		return
+	}
+
+	node.TypeMeta = metav1.TypeMeta{Kind: "NodeMetrics", APIVersion: metricsGroupVersion}
+	writeMetricsResponse(resp, &node)
+}
+
+// servePods lists the metrics of the pods, in every namespace or in the namespace of the path
+func (m *metricsServer) servePods(resp http.ResponseWriter, req *http.Request) {
+	summary, err := m.scrape(req.Context())
+	if err != nil {
+		writeMetricsError(resp, http.StatusServiceUnavailable, metav1.StatusReasonServiceUnavailable, err.Error())
+		return
+	}
+
+	namespace := req.PathValue("namespace")
+	selected, err := m.selectedPods(req, namespace)
+	if err != nil {
+		writeMetricsError(resp, http.StatusBadRequest, metav1.StatusReasonBadRequest, err.Error())
+		return
+	}
+
+	list := &metricsv1beta1.PodMetricsList{
+		TypeMeta: metav1.TypeMeta{Kind: "PodMetricsList", APIVersion: metricsGroupVersion},
+		Items:    []metricsv1beta1.PodMetrics{},
+	}
+	for _, stats := range summary.Pods {
+		if namespace != "" && stats.PodRef.Namespace != namespace {
+			continue
+		}
+		if selected != nil && !selected[stats.PodRef.Namespace+"/"+stats.PodRef.Name] {
+			continue
+		}
+		if pod, ok := podMetrics(stats); ok {
+			list.Items = append(list.Items, pod)
+		}
+	}
+	writeMetricsResponse(resp, list)
+}
+
+// servePod serves the metrics of a single pod
+func (m *metricsServer) servePod(resp http.ResponseWriter, req *http.Request) {
+	summary, err := m.scrape(req.Context())
+	if err != nil {
+		writeMetricsError(resp, http.StatusServiceUnavailable, metav1.StatusReasonServiceUnavailable, err.Error())
+		return
+	}
+
+	namespace, name := req.PathValue("namespace"), req.PathValue("name")
+	for _, stats := range summary.Pods {
+		if stats.PodRef.Namespace != namespace || stats.PodRef.Name != name {
+			continue
+		}
+		if pod, ok := podMetrics(stats); ok {
+			pod.TypeMeta = metav1.TypeMeta{Kind: "PodMetrics", APIVersion: metricsGroupVersion}
+			writeMetricsResponse(resp, &pod)
+			return
+		}
+	}
+	writeMetricsError(resp, http.StatusNotFound, metav1.StatusReasonNotFound, fmt.Sprintf("podmetrics %q not found", name))
+}
+
+// selectedNodes returns the names of the nodes matching the label and field selectors of the request, nil when there are none
+// the kubelet summary carries no labels, so the selectors are resolved against the node objects
+func (m *metricsServer) selectedNodes(req *http.Request) (map[string]bool, error) {
+	opts, ok := selectorListOptions(req)
+	if !ok {
+		return nil, nil
+	}
+	clientset := m.clientset.Load()
+	if clientset == nil {
+		return nil, fmt.Errorf("selectors are not supported before the metrics API is registered")
+	}
+
+	nodes, err := clientset.CoreV1().Nodes().List(req.Context(), opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %v", err)
+	}
+
+	selected := map[string]bool{}
+	for _, node := range nodes.Items {
+		selected[node.Name] = true
+	}
+	return selected, nil
+}
+
+// selectedPods returns the namespaced names of the pods matching the label and field selectors of the request, nil when there are none
+func (m *metricsServer) selectedPods(req *http.Request, namespace string) (map[string]bool, error) {
+	opts, ok := selectorListOptions(req)
+	if !ok {
+		return nil, nil
+	}
+	clientset := m.clientset.Load()
+	if clientset == nil {
+		return nil, fmt.Errorf("selectors are not supported before the metrics API is registered")
+	}
+
+	pods, err := clientset.CoreV1().Pods(namespace).List(req.Context(), opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %v", err)
+	}
+
+	selected := map[string]bool{}
+	for _, pod := range pods.Items {
+		selected[pod.Namespace+"/"+pod.Name] = true
+	}
+	return selected, nil
+}
+
+// selectorListOptions returns the label and field selectors of the request, false when it has none
+func selectorListOptions(req *http.Request) (metav1.ListOptions, bool) {
+	query := req.URL.Query()
+	opts := metav1.ListOptions{
+		LabelSelector: query.Get("labelSelector"),
+		FieldSelector: query.Get("fieldSelector"),
+	}
+	return opts, opts.LabelSelector != "" || opts.FieldSelector != ""
+}
+
+// scrape returns the stats summary of the kubelet, a summary scraped within metricsCacheTTL is reused
+func (m *metricsServer) scrape(ctx context.Context) (*statsv1alpha1.Summary, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.summary != nil && time.Since(m.scrapedAt) < metricsCacheTTL {
+		return m.summary, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, kubeletSummaryURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubelet stats request: %v", err)
+	}
+	res, err := m.kubelet.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scrape kubelet stats: %v", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to scrape kubelet stats: kubelet returned %s", res.Status)
+	}
+
+	var summary statsv1alpha1.Summary
+	if err := json.NewDecoder(res.Body).Decode(&summary); err != nil {
+		return nil, fmt.Errorf("failed to decode kubelet stats: %v", err)
+	}
+
+	m.summary = &summary
+	m.scrapedAt = time.Now()
+	return m.summary, nil
+}
+
+// nodeMetrics converts the node stats of the summary, it returns false while the kubelet has no CPU or memory usage yet
+func nodeMetrics(stats statsv1alpha1.NodeStats) (metricsv1beta1.NodeMetrics, bool) {
+	usage, timestamp, ok := resourceUsage(stats.CPU, stats.Memory)
+	if !ok {
+		return metricsv1beta1.NodeMetrics{}, false
+	}
+
+	return metricsv1beta1.NodeMetrics{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              stats.NodeName,
+			CreationTimestamp: metav1.Now(),
+		},
+		Timestamp: timestamp,
+		Window:    metav1.Duration{Duration: metricsWindow},
+		Usage:     usage,
+	}, true
+}
+
+// podMetrics converts the pod stats of the summary
+// like metrics-server it returns false for pods with a container missing its usage, a partial sum would mislead the HPA
+func podMetrics(stats statsv1alpha1.PodStats) (metricsv1beta1.PodMetrics, bool) {
+	if len(stats.Containers) == 0 {
+		return metricsv1beta1.PodMetrics{}, false
+	}
+
+	pod := metricsv1beta1.PodMetrics{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              stats.PodRef.Name,
+			Namespace:         stats.PodRef.Namespace,
+			CreationTimestamp: metav1.Now(),
+		},
+		Window:     metav1.Duration{Duration: metricsWindow},
+		Containers: []metricsv1beta1.ContainerMetrics{},
+	}
+
+	for _, container := range stats.Containers {
+		usage, timestamp, ok := resourceUsage(container.CPU, container.Memory)
+		if !ok {
+			return metricsv1beta1.PodMetrics{}, false
+		}
+		if timestamp.After(pod.Timestamp.Time) {
+			pod.Timestamp = timestamp
+		}
+		pod.Containers = append(pod.Containers, metricsv1beta1.ContainerMetrics{
+			Name:  container.Name,
+			Usage: usage,
+		})
+	}
+	return pod, true
+}
+
+// resourceUsage returns the CPU and working set memory usage and the time the CPU usage was sampled at
+func resourceUsage(cpu *statsv1alpha1.CPUStats, memory *statsv1alpha1.MemoryStats) (corev1.ResourceList, metav1.Time, bool) {
+	if cpu == nil || cpu.UsageNanoCores == nil || memory == nil || memory.WorkingSetBytes == nil {
+		return nil, metav1.Time{}, false
+	}
+
+	return corev1.ResourceList{
+		corev1.ResourceCPU:    *resource.NewScaledQuantity(int64(*cpu.UsageNanoCores), resource.Nano),
+		corev1.ResourceMemory: *resource.NewQuantity(int64(*memory.WorkingSetBytes), resource.BinarySI),
+	}, cpu.Time, true
+}
+
+// writeMetricsResponse writes an API object as the JSON response
+func writeMetricsResponse(resp http.ResponseWriter, obj any) {
+	resp.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(resp).Encode(obj); err != nil {
+		log.Error().Str("component", "metrics").Err(err).Msg("failed to write resource metrics response")
+	}
+}
+
+// writeMetricsError writes a failure status, kubectl and the HPA controller show its message
+func writeMetricsError(resp http.ResponseWriter, code int, reason metav1.StatusReason, message string) {
+	resp.Header().Set("Content-Type", "application/json")
+	resp.WriteHeader(code)
+	if err := json.NewEncoder(resp).Encode(&metav1.Status{
+		TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+		Status:   metav1.StatusFailure,
+		Message:  message,
+		Reason:   reason,
+		Code:     int32(code),
+	}); err != nil {
+		log.Error().Str("component", "metrics").Err(err).Msg("failed to write resource metrics error")
+	}
+}
+
+// RegisterAPIService registers the resource metrics API with the aggregation layer
+// the service has no selector, its endpoints point at the node address and are kept current by ReconcileKubernetesEndpoints
+func (m *metricsServer) RegisterAPIService(kubeconfig string) error {
+	clientset, err := kubesolokubernetes.GetKubernetesClient(kubeconfig)
+	if err != nil {
+		return fmt.Errorf("failed to create Kubernetes client: %v", err)
+	}
+	aggregatorClient, err := kubesolokubernetes.GetAggregatorClient(kubeconfig)
+	if err != nil {
+		return err
+	}
+	m.clientset.Store(clientset)
+
+	ctx, cancel := context.WithTimeout(context.Background(), types.DefaultContextTimeout)
+	defer cancel()
+
+	if err := ensureMetricsService(ctx, clientset); err != nil {
+		return err
+	}
+
+	caBundle, err := os.ReadFile(m.embedded.CACerts.Bundle)
+	if err != nil {
+		return fmt.Errorf("failed to read CA bundle: %v", err)
+	}
+
+	apiService := &apiregistrationv1.APIService{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: metricsAPIServiceName,
+		},
+		Spec: apiregistrationv1.APIServiceSpec{
+			Service: &apiregistrationv1.ServiceReference{
+				Namespace: metav1.NamespaceSystem,
+				Name:      metricsServiceName,
+				Port:      kubesolokubernetes.Int32Ptr(443),
+			},
+			Group:                "metrics.k8s.io",
+			Version:              "v1beta1",
+			CABundle:             caBundle,
+			GroupPriorityMinimum: 100,
+			VersionPriority:      100,
+		},
+	}
+
+	apiServices := aggregatorClient.ApiregistrationV1().APIServices()
+	existing, err := apiServices.Get(ctx, metricsAPIServiceName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		if _, err := apiServices.Create(ctx, apiService, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("failed to create metrics APIService: %v", err)
+		}
+	} else if err != nil {
+		return fmt.Errorf("failed to get metrics APIService: %v", err)
+	} else {
+		// an existing APIService is updated so the CA bundle follows a rotated CA
+		apiService.ResourceVersion = existing.ResourceVersion
+		if _, err := apiServices.Update(ctx, apiService, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("failed to update metrics APIService: %v", err)
+		}
+	}
+
+	log.Info().Str("component", "metrics").Msgf("APIService %s registered with API server", metricsAPIServiceName)
+	return nil
+}
+
+// ensureMetricsService creates the service the APIService refers to
+func ensureMetricsService(ctx context.Context, clientset *kubernetes.Clientset) error {
+	_, err := clientset.CoreV1().Services(metav1.NamespaceSystem).Create(ctx, &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      metricsServiceName,
+			Namespace: metav1.NamespaceSystem,
+		},
+		Spec: corev1.ServiceSpec{
+			Ports: []corev1.ServicePort{
+				{
+					Name:       "https",
+					Port:       443,
+					TargetPort: intstr.FromInt32(types.DefaultMetricsPort),
+					Protocol:   corev1.ProtocolTCP,
+				},
+			},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create metrics service: %v", err)
+	}
+	return nil
+}
+
+// reconcileEndpoints points the endpoints of the metrics service at the node address
+// the aggregation layer routes to the endpoints directly, so kube-proxy is not involved
+func (m *metricsServer) reconcileEndpoints(ctx context.Context, clientset *kubernetes.Clientset, nodeIP string) error {
+	subsets := []corev1.EndpointSubset{
+		{
+			Addresses: []corev1.EndpointAddress{{IP: nodeIP}},
+			Ports: []corev1.EndpointPort{
+				{
+					Name:     "https",
+					Port:     types.DefaultMetricsPort,
+					Protocol: corev1.ProtocolTCP,
+				},
+			},
+		},
+	}
+
+	endpointsClient := clientset.CoreV1().Endpoints(metav1.NamespaceSystem)
+	existing, err := endpointsClient.Get(ctx, metricsServiceName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = endpointsClient.Create(ctx, &corev1.Endpoints{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      metricsServiceName,
+				Namespace: metav1.NamespaceSystem,
+			},
+			Subsets: subsets,
+		}, metav1.CreateOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to create metrics endpoints: %v", err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get metrics endpoints: %v", err)
+	}
+	if apiequality.Semantic.DeepEqual(existing.Subsets, subsets) {
+		return nil
+	}
+
+	existing.Subsets = subsets
+	if _, err := endpointsClient.Update(ctx, existing, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update metrics endpoints: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,481 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	jsonpatch "gopkg.in/evanphx/json-patch.v4"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// mutationRulesConfigMapName holds mutation rules managed through the Kubernetes API, next to the ones of the mutation rules file
+	mutationRulesConfigMapName = "kubesolo-mutation-rules"
+	// mutationRulesConfigMapKey is the key of the ConfigMap holding the mutation rules in the format of the mutation rules file
+	mutationRulesConfigMapKey = "mutation-rules.yaml"
+)
+
+// mutationRuleKinds are the kinds the mutating webhook is registered for, a rule can only match those
+var mutationRuleKinds = []string{"Pod", "PersistentVolumeClaim"}
+
+// mutationRulesConfig is the format of the mutation rules file and ConfigMap
+type mutationRulesConfig struct {
+	Rules []mutationRule `json:"rules"`
+}
+
+// mutationRule changes the objects it matches when they are created
+// labels and annotations are added unless the object sets them, env vars, tolerations and security contexts only apply to pods,
+// env vars are added to the containers that do not define them and the security contexts fill the fields the pod leaves unset
+// patch is a JSON patch applied first, it can change anything including what the object sets itself
+type mutationRule struct {
+	Name                     string                     `json:"name"`
+	Match                    mutationRuleMatch          `json:"match"`
+	Patch                    json.RawMessage            `json:"patch,omitempty"`
+	Labels                   map[string]string          `json:"labels,omitempty"`
+	Annotations              map[string]string          `json:"annotations,omitempty"`
+	Env                      []corev1.EnvVar            `json:"env,omitempty"`
+	Tolerations              []corev1.Toleration        `json:"tolerations,omitempty"`
+	SecurityContext          *corev1.PodSecurityContext `json:"securityContext,omitempty"`
+	ContainerSecurityContext *corev1.SecurityContext    `json:"containerSecurityContext,omitempty"`
+
+	patch    jsonpatch.Patch
+	selector labels.Selector
+}
+
+// mutationRuleMatch selects the objects a rule applies to, every object of the kinds when the namespaces and selector are empty
+// kinds defaults to Pod
+type mutationRuleMatch struct {
+	Kinds      []string `json:"kinds,omitempty"`
+	Namespaces []string `json:"namespaces,omitempty"`
+	Selector   string   `json:"selector,omitempty"`
+}
+
+// LoadMutationRules reads and validates a mutation rules file, it is used to reject a broken file at startup
+func LoadMutationRules(path string) error {
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read mutation rules file: %v", err)
+	}
+	if _, err := parseMutationRules(data); err != nil {
+		return fmt.Errorf("invalid mutation rules file %s: %v", path, err)
+	}
+	return nil
+}
+
+// parseMutationRules parses and validates mutation rules
+func parseMutationRules(data []byte) ([]mutationRule, error) {
+	var config mutationRulesConfig
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, err
+	}
+
+	names := map[string]bool{}
+	for i := range config.Rules {
+		rule := &config.Rules[i]
+		if rule.Name == "" {
+			return nil, fmt.Errorf("mutation rule %d: a name is required", i)
+		}
+		if names[rule.Name] {
+			return nil, fmt.Errorf("mutation rule %s: the name is used by another rule", rule.Name)
+		}
+		names[rule.Name] = true
+
+		if len(rule.Match.Kinds) == 0 {
+			rule.Match.Kinds = []string{"Pod"}
+		}
+		for _, kind := range rule.Match.Kinds {
+			if !slices.Contains(mutationRuleKinds, kind) {
+				return nil, fmt.Errorf("mutation rule %s: unsupported kind %q, supported kinds are %s", rule.Name, kind, strings.Join(mutationRuleKinds, ", "))
+			}
+		}
+		if rule.podOnly() && !reflect.DeepEqual(rule.Match.Kinds, []string{"Pod"}) {
+			return nil, fmt.Errorf("mutation rule %s: env, tolerations and security contexts only apply to the Pod kind", rule.Name)
+		}
+
+		selector, err := labels.Parse(rule.Match.Selector)
+		if err != nil {
+			return nil, fmt.Errorf("mutation rule %s: invalid selector: %v", rule.Name, err)
+		}
+		rule.selector = selector
+
+		if len(rule.Patch) > 0 {
+			patch, err := jsonpatch.DecodePatch(rule.Patch)
+			if err != nil {
+				return nil, fmt.Errorf("mutation rule %s: invalid patch: %v", rule.Name, err)
+			}
+			rule.patch = patch
+		}
+	}
+	return config.Rules, nil
+}
+
+// selects reports whether the rule applies to objects of the kind in the namespace, whatever their labels
+func (r mutationRule) selects(kind, namespace string) bool {
+	if !slices.Contains(r.Match.Kinds, kind) {
+		return false
+	}
+	return len(r.Match.Namespaces) == 0 || slices.Contains(r.Match.Namespaces, namespace)
+}
+
+// matches reports whether the rule applies to an object of the kind, namespace and labels
+func (r mutationRule) matches(kind, namespace string, objectLabels map[string]string) bool {
+	return r.selects(kind, namespace) && (r.selector == nil || r.selector.Matches(labels.Set(objectLabels)))
+}
+
+// applyMutationRules applies the matching mutation rules on top of the built-in patches
+// the rules run in order on the object as patched by the built-in handlers and the rules before them,
+// each rule is matched against the labels of the object as changed so far, so a rule can select the labels an earlier one added
+// the result is returned as a single patch against the object of the request, replacing the built-in patches
+// a rule that fails is logged and skipped so it never blocks the creation of the object
+func (w *webhoook) applyMutationRules(admissionReview *admissionv1.AdmissionReview, patches []map[string]interface{}) []map[string]interface{} {
+	request := admissionReview.Request
+
+	candidates := []mutationRule{}
+	for _, rule := range w.mutationRules.rules() {
+		// the namespace of an object created through a workload is only set on the request
+		if rule.selects(request.Kind.Kind, request.Namespace) {
+			candidates = append(candidates, rule)
+		}
+	}
+	if len(candidates) == 0 {
+		return patches
+	}
+
+	document := request.Object.Raw
+	if len(patches) > 0 {
+		builtin, err := json.Marshal(patches)
+		if err == nil {
+			var patch jsonpatch.Patch
+			if patch, err = jsonpatch.DecodePatch(builtin); err == nil {
+				document, err = patch.Apply(document)
+			}
+		}
+		if err != nil {
+			log.Error().Str("component", "webhook").Err(err).Msg("failed to apply the built-in patches, skipping the mutation rules")
+			return patches
+		}
+	}
+
+	applied := false
+	for _, rule := range candidates {
+		var object metav1.PartialObjectMetadata
+		if err := json.Unmarshal(document, &object); err != nil {
+			log.Error().Str("component", "webhook").Err(err).Msg("failed to unmarshal object metadata")
+			return patches
+		}
+		if !rule.matches(request.Kind.Kind, request.Namespace, object.Labels) {
+			continue
+		}
+
+		mutated, err := rule.apply(request.Kind.Kind, document)
+		if err != nil {
+			log.Error().Str("component", "webhook").
+				Str("rule", rule.Name).
+				Str("kind", request.Kind.Kind).
+				Str("name", object.Name).
+				Str("namespace", request.Namespace).
+				Msgf("failed to apply mutation rule, skipping it: %v", err)
+			continue
+		}
+
+		log.Info().Str("component", "webhook").
+			Str("rule", rule.Name).
+			Str("kind", request.Kind.Kind).
+			Str("name", object.Name).
+			Str("namespace", request.Namespace).
+			Msg("applying mutation rule")
+		document = mutated
+		applied = true
+	}
+	if !applied {
+		return patches
+	}
+
+	result, err := diffDocuments(request.Object.Raw, document)
+	if err != nil {
+		log.Error().Str("component", "webhook").Err(err).Msg("failed to compute the patch of the mutation rules")
+		return patches
+	}
+	return result
+}
+
+// podOnly reports whether the rule has actions that only apply to pods
+func (r mutationRule) podOnly() bool {
+	return len(r.Env) > 0 || len(r.Tolerations) > 0 || r.SecurityContext != nil || r.ContainerSecurityContext != nil
+}
+
+// apply applies the rule to the JSON document of an object of the kind
+// the document is only changed as a generic object, so the fields the rule does not touch are kept as they are
+func (r mutationRule) apply(kind string, document []byte) ([]byte, error) {
+	var err error
+	if r.patch != nil {
+		if document, err = r.patch.Apply(document); err != nil {
+			return nil, fmt.Errorf("failed to apply patch: %v", err)
+		}
+	}
+
+	metadataChanges := len(r.Labels) > 0 || len(r.Annotations) > 0
+	podChanges := kind == "Pod" && r.podOnly()
+	if !metadataChanges && !podChanges {
+		return document, nil
+	}
+
+	var object map[string]interface{}
+	if err := json.Unmarshal(document, &object); err != nil {
+		return nil, err
+	}
+
+	if metadataChanges {
+		metadata, _ := object["metadata"].(map[string]interface{})
+		if metadata == nil {
+			metadata = map[string]interface{}{}
+			object["metadata"] = metadata
+		}
+		addMissingKeys(metadata, "labels", r.Labels)
+		addMissingKeys(metadata, "annotations", r.Annotations)
+	}
+
+	if podChanges {
+		if err := r.applyToPod(object); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(object)
+}
+
+// applyToPod adds the env vars, tolerations and security context defaults of the rule to the pod object
+func (r mutationRule) applyToPod(pod map[string]interface{}) error {
+	spec, _ := pod["spec"].(map[string]interface{})
+	if spec == nil {
+		return fmt.Errorf("the pod has no spec")
+	}
+
+	var env []interface{}
+	if err := remarshal(r.Env, &env); err != nil {
+		return err
+	}
+	var containerSecurityContext map[string]interface{}
+	if r.ContainerSecurityContext != nil {
+		if err := remarshal(r.ContainerSecurityContext, &containerSecurityContext); err != nil {
+			return err
+		}
+	}
+
+	for _, key := range []string{"initContainers", "containers"} {
+		containers, _ := spec[key].([]interface{})
+		for _, item := range containers {
+			container, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			containerEnv, _ := container["env"].([]interface{})
+			for _, value := range env {
+				name := value.(map[string]interface{})["name"]
+				if !slices.ContainsFunc(containerEnv, func(existing interface{}) bool {
+					existingVar, ok := existing.(map[string]interface{})
+					return ok && existingVar["name"] == name
+				}) {
+					containerEnv = append(containerEnv, deepCopyJSON(value))
+				}
+			}
+			if len(containerEnv) > 0 {
+				container["env"] = containerEnv
+			}
+
+			if containerSecurityContext != nil {
+				container["securityContext"] = mergeMissing(container["securityContext"], containerSecurityContext)
+			}
+		}
+	}
+
+	if len(r.Tolerations) > 0 {
+		tolerations, _ := spec["tolerations"].([]interface{})
+		var existing []corev1.Toleration
+		if err := remarshal(tolerations, &existing); err != nil {
+			return err
+		}
+		for _, toleration := range r.Tolerations {
+			if slices.ContainsFunc(existing, func(existing corev1.Toleration) bool { return existing.MatchToleration(&toleration) }) {
+				continue
+			}
+			var value map[string]interface{}
+			if err := remarshal(toleration, &value); err != nil {
+				return err
+			}
+			tolerations = append(tolerations, value)
+			existing = append(existing, toleration)
+		}
+		spec["tolerations"] = tolerations
+	}
+
+	if r.SecurityContext != nil {
+		var securityContext map[string]interface{}
+		if err := remarshal(r.SecurityContext, &securityContext); err != nil {
+			return err
+		}
+		spec["securityContext"] = mergeMissing(spec["securityContext"], securityContext)
+	}
+	return nil
+}
+
+// addMissingKeys adds the values to the map under the key of the metadata, keys already set are left alone
+func addMissingKeys(metadata map[string]interface{}, key string, values map[string]string) {
+	if len(values) == 0 {
+		return
+	}
+
+	existing, _ := metadata[key].(map[string]interface{})
+	if existing == nil {
+		existing = map[string]interface{}{}
+		metadata[key] = existing
+	}
+	for name, value := range values {
+		if _, ok := existing[name]; !ok {
+			existing[name] = value
+		}
+	}
+}
+
+// mergeMissing returns dst with the keys of src it is missing, recursing into the objects both have
+// a missing or null dst is replaced by a copy of src, any other value of dst is kept
+func mergeMissing(dst interface{}, src map[string]interface{}) interface{} {
+	if dst == nil {
+		return deepCopyJSON(src)
+	}
+	dstMap, ok := dst.(map[string]interface{})
+	if !ok {
+		return dst
+	}
+
+	for key, value := range src {
+		valueMap, valueIsMap := value.(map[string]interface{})
+		switch {
+		case dstMap[key] == nil:
+			dstMap[key] = deepCopyJSON(value)
+		case valueIsMap:
+			dstMap[key] = mergeMissing(dstMap[key], valueMap)
+		}
+	}
+	return dstMap
+}
+
+// deepCopyJSON copies a value decoded from JSON, so the values of a rule are never shared with the objects it changes
+func deepCopyJSON(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			copied[key] = deepCopyJSON(item)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(value))
+		for i, item := range value {
+			copied[i] = deepCopyJSON(item)
+		}
+		return copied
+	default:
+		return value
+	}
+}
+
+// remarshal converts a value to another type through JSON
+func remarshal(in, out interface{}) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+// diffDocuments returns a JSON patch turning the original document into the mutated one
+// objects are compared key by key and arrays of the same length item by item, so only the fields that changed are patched
+func diffDocuments(original, mutated []byte) ([]map[string]interface{}, error) {
+	var before, after interface{}
+	if err := json.Unmarshal(original, &before); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(mutated, &after); err != nil {
+		return nil, err
+	}
+
+	patches := []map[string]interface{}{}
+	diffJSON("", before, after, &patches)
+	return patches, nil
+}
+
+// diffJSON appends the operations turning before into after at the path to the patches
+func diffJSON(path string, before, after interface{}, patches *[]map[string]interface{}) {
+	if reflect.DeepEqual(before, after) {
+		return
+	}
+
+	beforeMap, beforeIsMap := before.(map[string]interface{})
+	afterMap, afterIsMap := after.(map[string]interface{})
+	if beforeIsMap && afterIsMap {
+		keys := make([]string, 0, len(beforeMap)+len(afterMap))
+		for key := range beforeMap {
+			keys = append(keys, key)
+		}
+		for key := range afterMap {
+			if _, ok := beforeMap[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		slices.Sort(keys)
+
+		for _, key := range keys {
+			keyPath := path + "/" + escapeJSONPointer(key)
+			beforeValue, inBefore := beforeMap[key]
+			afterValue, inAfter := afterMap[key]
+			switch {
+			case !inAfter:
+				*patches = append(*patches, map[string]interface{}{"op": "remove", "path": keyPath})
+			case !inBefore:
+				*patches = append(*patches, map[string]interface{}{"op": "add", "path": keyPath, "value": afterValue})
+			default:
+				diffJSON(keyPath, beforeValue, afterValue, patches)
+			}
+		}
+		return
+	}
+
+	beforeList, beforeIsList := before.([]interface{})
+	afterList, afterIsList := after.([]interface{})
+	if beforeIsList && afterIsList {
+		// items appended at the end are added one by one, any other change of length replaces the list
+		if len(afterList) >= len(beforeList) && reflect.DeepEqual(beforeList, afterList[:len(beforeList)]) {
+			for _, item := range afterList[len(beforeList):] {
+				*patches = append(*patches, map[string]interface{}{"op": "add", "path": path + "/-", "value": item})
+			}
+			return
+		}
+		if len(beforeList) == len(afterList) {
+			for i := range afterList {
+				diffJSON(fmt.Sprintf("%s/%d", path, i), beforeList[i], afterList[i], patches)
+			}
+			return
+		}
+	}
+
+	*patches = append(*patches, map[string]interface{}{"op": "replace", "path": path, "value": after})
+}
+
+// escapeJSONPointer escapes a key for use in a JSON pointer
+func escapeJSONPointer(key string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
@@ -0,0 +1,283 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	jsonpatch "gopkg.in/evanphx/json-patch.v4"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestParseMutationRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		expect  int
+		wantErr string
+	}{
+		{name: "empty", data: "", expect: 0},
+		{
+			name: "rules",
+			data: `rules:
+  - name: team
+    match:
+      namespaces: [apps]
+      selector: app=sensor
+    labels:
+      team: edge
+    env:
+      - name: SITE
+        value: plant-1
+  - name: storage
+    match:
+      kinds: [PersistentVolumeClaim]
+    annotations:
+      backup: "true"
+    patch:
+      - op: add
+        path: /spec/storageClassName
+        value: local-path
+`,
+			expect: 2,
+		},
+		{name: "no name", data: "rules:\n  - labels:\n      team: edge\n", wantErr: "a name is required"},
+		{name: "duplicate name", data: "rules:\n  - name: a\n  - name: a\n", wantErr: "used by another rule"},
+		{name: "unsupported kind", data: "rules:\n  - name: a\n    match:\n      kinds: [Service]\n", wantErr: "unsupported kind"},
+		{name: "pod action on a PVC", data: "rules:\n  - name: a\n    match:\n      kinds: [PersistentVolumeClaim]\n    env:\n      - name: SITE\n", wantErr: "only apply to the Pod kind"},
+		{name: "invalid selector", data: "rules:\n  - name: a\n    match:\n      selector: app in (\n", wantErr: "invalid selector"},
+		{name: "invalid patch", data: "rules:\n  - name: a\n    patch: {op: add}\n", wantErr: "invalid patch"},
+		{name: "unknown field", data: "rules:\n  - name: a\n    label:\n      team: edge\n", wantErr: "unknown field"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := parseMutationRules([]byte(tt.data))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected an error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(rules) != tt.expect {
+				t.Fatalf("parsed %d rules, expected %d", len(rules), tt.expect)
+			}
+			for _, rule := range rules {
+				if rule.selector == nil || len(rule.Match.Kinds) == 0 {
+					t.Errorf("rule %s has no parsed selector or kinds", rule.Name)
+				}
+				if len(rule.Patch) > 0 && rule.patch == nil {
+					t.Errorf("rule %s has no decoded patch", rule.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestDiffDocuments(t *testing.T) {
+	tests := []struct {
+		name     string
+		original string
+		mutated  string
+		expect   string
+	}{
+		{name: "unchanged", original: `{"a":1}`, mutated: `{"a":1}`, expect: `[]`},
+		{
+			name:     "nested fields",
+			original: `{"metadata":{"name":"p","labels":{"app":"a"}},"spec":{"x":1}}`,
+			mutated:  `{"metadata":{"name":"p","labels":{"app":"a","team":"edge"}},"spec":{"x":2}}`,
+			expect:   `[{"op":"add","path":"/metadata/labels/team","value":"edge"},{"op":"replace","path":"/spec/x","value":2}]`,
+		},
+		{
+			name:     "removed field",
+			original: `{"metadata":{"annotations":{"a":"1","b":"2"}}}`,
+			mutated:  `{"metadata":{"annotations":{"a":"1"}}}`,
+			expect:   `[{"op":"remove","path":"/metadata/annotations/b"}]`,
+		},
+		{
+			name:     "appended items",
+			original: `{"list":[1,2]}`,
+			mutated:  `{"list":[1,2,3,4]}`,
+			expect:   `[{"op":"add","path":"/list/-","value":3},{"op":"add","path":"/list/-","value":4}]`,
+		},
+		{
+			name:     "changed item",
+			original: `{"list":[{"name":"a","value":"1"},{"name":"b"}]}`,
+			mutated:  `{"list":[{"name":"a","value":"2"},{"name":"b"}]}`,
+			expect:   `[{"op":"replace","path":"/list/0/value","value":"2"}]`,
+		},
+		{
+			name:     "shorter list",
+			original: `{"list":[1,2,3]}`,
+			mutated:  `{"list":[1,3]}`,
+			expect:   `[{"op":"replace","path":"/list","value":[1,3]}]`,
+		},
+		{
+			name:     "escaped keys",
+			original: `{"metadata":{"labels":{}}}`,
+			mutated:  `{"metadata":{"labels":{"example.com/a~b":"x"}}}`,
+			expect:   `[{"op":"add","path":"/metadata/labels/example.com~1a~0b","value":"x"}]`,
+		},
+		{
+			name:     "changed type",
+			original: `{"a":{"b":1}}`,
+			mutated:  `{"a":[1]}`,
+			expect:   `[{"op":"replace","path":"/a","value":[1]}]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patches, err := diffDocuments([]byte(tt.original), []byte(tt.mutated))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			data, err := json.Marshal(patches)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.expect {
+				t.Fatalf("got patch %s, expected %s", data, tt.expect)
+			}
+
+			patch, err := jsonpatch.DecodePatch(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			patched, err := patch.Apply([]byte(tt.original))
+			if err != nil {
+				t.Fatalf("failed to apply the patch: %v", err)
+			}
+			if !jsonpatch.Equal(patched, []byte(tt.mutated)) {
+				t.Fatalf("the patch turns the document into %s, expected %s", patched, tt.mutated)
+			}
+		})
+	}
+}
+
+func TestMergeMissing(t *testing.T) {
+	tests := []struct {
+		name   string
+		dst    string
+		src    string
+		expect string
+	}{
+		{name: "missing", dst: `null`, src: `{"runAsNonRoot":true}`, expect: `{"runAsNonRoot":true}`},
+		{name: "added keys", dst: `{"runAsUser":1000}`, src: `{"runAsNonRoot":true}`, expect: `{"runAsNonRoot":true,"runAsUser":1000}`},
+		{name: "kept values", dst: `{"runAsNonRoot":false}`, src: `{"runAsNonRoot":true}`, expect: `{"runAsNonRoot":false}`},
+		{name: "null value", dst: `{"runAsNonRoot":null}`, src: `{"runAsNonRoot":true}`, expect: `{"runAsNonRoot":true}`},
+		{
+			name:   "nested objects",
+			dst:    `{"seccompProfile":{"type":"Localhost","localhostProfile":"p.json"}}`,
+			src:    `{"seccompProfile":{"type":"RuntimeDefault"},"capabilities":{"drop":["ALL"]}}`,
+			expect: `{"capabilities":{"drop":["ALL"]},"seccompProfile":{"localhostProfile":"p.json","type":"Localhost"}}`,
+		},
+		{name: "not an object", dst: `"x"`, src: `{"a":1}`, expect: `"x"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var dst interface{}
+			var src map[string]interface{}
+			if err := json.Unmarshal([]byte(tt.dst), &dst); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(tt.src), &src); err != nil {
+				t.Fatal(err)
+			}
+			data, err := json.Marshal(mergeMissing(dst, src))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.expect {
+				t.Fatalf("got %s, expected %s", data, tt.expect)
+			}
+		})
+	}
+}
+
+func TestApplyMutationRules(t *testing.T) {
+	const rules = `rules:
+  - name: team
+    labels:
+      team: edge
+  - name: edge
+    match:
+      selector: team=edge
+    env:
+      - name: SITE
+        value: plant-1
+    tolerations:
+      - key: edge
+        operator: Exists
+    containerSecurityContext:
+      allowPrivilegeEscalation: false
+`
+	const pod = `{"apiVersion":"v1","kind":"Pod","metadata":{"name":"sensor","creationTimestamp":null},` +
+		`"spec":{"containers":[{"name":"app","image":"app","env":[{"name":"SITE","value":"plant-2"}]}]},"status":{}}`
+
+	w := &webhoook{mutationRules: newRuleSource("mutation rules", "", mutationRulesConfigMapName, mutationRulesConfigMapKey, parseMutationRules)}
+	w.mutationRules.loadConfigMap(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: mutationRulesConfigMapName},
+		Data:       map[string]string{mutationRulesConfigMapKey: rules},
+	})
+
+	review := &admissionv1.AdmissionReview{Request: &admissionv1.AdmissionRequest{
+		Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+		Namespace: "apps",
+		Object:    runtime.RawExtension{Raw: []byte(pod)},
+	}}
+	patches := w.applyMutationRules(review, nil)
+
+	data, err := json.Marshal(patches)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the second rule matches the label added by the first one, the env var set by the pod is kept
+	expect := `[{"op":"add","path":"/metadata/labels","value":{"team":"edge"}},` +
+		`{"op":"add","path":"/spec/containers/0/securityContext","value":{"allowPrivilegeEscalation":false}},` +
+		`{"op":"add","path":"/spec/tolerations","value":[{"key":"edge","operator":"Exists"}]}]`
+	if string(data) != expect {
+		t.Fatalf("got patch %s, expected %s", data, expect)
+	}
+
+	w.mutationRules.loadConfigMap(nil)
+	if patches := w.applyMutationRules(review, nil); len(patches) != 0 {
+		t.Fatalf("expected no patch once the rules are removed, got %v", patches)
+	}
+}
+
+func TestMutationRuleMatches(t *testing.T) {
+	rules, err := parseMutationRules([]byte("rules:\n  - name: a\n    match:\n      namespaces: [apps]\n      selector: app=sensor\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rule := rules[0]
+
+	tests := []struct {
+		kind      string
+		namespace string
+		labels    map[string]string
+		expect    bool
+	}{
+		{kind: "Pod", namespace: "apps", labels: map[string]string{"app": "sensor"}, expect: true},
+		{kind: "Pod", namespace: "default", labels: map[string]string{"app": "sensor"}, expect: false},
+		{kind: "Pod", namespace: "apps", labels: map[string]string{"app": "other"}, expect: false},
+		{kind: "PersistentVolumeClaim", namespace: "apps", labels: map[string]string{"app": "sensor"}, expect: false},
+	}
+	for _, tt := range tests {
+		if got := rule.matches(tt.kind, tt.namespace, tt.labels); got != tt.expect {
+			t.Errorf("matches(%s, %s, %v) = %v, expected %v", tt.kind, tt.namespace, tt.labels, got, tt.expect)
+		}
+	}
+	if !reflect.DeepEqual(rule.Match.Kinds, []string{"Pod"}) {
+		t.Errorf("kinds default to %v, expected [Pod]", rule.Match.Kinds)
+	}
+}
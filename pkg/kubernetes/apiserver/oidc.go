@@ -0,0 +1,77 @@
+package apiserver
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+// OIDCConfig holds the OpenID Connect provider the API server accepts ID tokens from
+// authentication with OIDC is disabled when IssuerURL is empty
+type OIDCConfig struct {
+	IssuerURL      string
+	ClientID       string
+	UsernameClaim  string
+	UsernamePrefix string
+	GroupsClaim    string
+	GroupsPrefix   string
+	CAFile         string
+}
+
+// Validate checks that the OIDC settings are complete before the API server is started with them
+func (c OIDCConfig) Validate() error {
+	if c.IssuerURL == "" {
+		return nil
+	}
+
+	issuer, err := url.Parse(c.IssuerURL)
+	if err != nil || issuer.Scheme != "https" || issuer.Host == "" {
+		return fmt.Errorf("OIDC issuer URL %q must be an https URL", c.IssuerURL)
+	}
+	if c.ClientID == "" {
+		return fmt.Errorf("OIDC client ID is required with an OIDC issuer URL")
+	}
+	if c.CAFile != "" {
+		if _, err := os.Stat(c.CAFile); err != nil {
+			return fmt.Errorf("failed to read OIDC CA file: %v", err)
+		}
+	}
+	return nil
+}
+
+// configureOIDCFlags sets the OIDC authentication flags of the API server
+// users signing in with OIDC keep their identity from the provider, RBAC bindings refer to the prefixed username and groups
+func (s *service) configureOIDCFlags(command *cobra.Command) error {
+	oidc := s.config.OIDC
+	if oidc.IssuerURL == "" {
+		return nil
+	}
+	if err := oidc.Validate(); err != nil {
+		return err
+	}
+
+	flags := command.Flags()
+	_ = flags.Set("oidc-issuer-url", oidc.IssuerURL)
+	_ = flags.Set("oidc-client-id", oidc.ClientID)
+	if oidc.UsernameClaim != "" {
+		_ = flags.Set("oidc-username-claim", oidc.UsernameClaim)
+	}
+	if oidc.UsernamePrefix != "" {
+		_ = flags.Set("oidc-username-prefix", oidc.UsernamePrefix)
+	}
+	if oidc.GroupsClaim != "" {
+		_ = flags.Set("oidc-groups-claim", oidc.GroupsClaim)
+	}
+	if oidc.GroupsPrefix != "" {
+		_ = flags.Set("oidc-groups-prefix", oidc.GroupsPrefix)
+	}
+	if oidc.CAFile != "" {
+		_ = flags.Set("oidc-ca-file", oidc.CAFile)
+	}
+
+	log.Info().Str("component", "apiserver").Msgf("OIDC authentication enabled for issuer %s and client %s", oidc.IssuerURL, oidc.ClientID)
+	return nil
+}
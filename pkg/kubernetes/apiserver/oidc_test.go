@@ -0,0 +1,214 @@
+package apiserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+// newTestIssuer starts an OIDC issuer serving its discovery document and a JWKS with one signing key
+// it returns the issuer and the path of its CA certificate
+func newTestIssuer(t *testing.T) (*httptest.Server, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	issuer := httptest.NewTLSServer(mux)
+	t.Cleanup(issuer.Close)
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                                issuer.URL,
+			"jwks_uri":                              issuer.URL + "/keys",
+			"id_token_signing_alg_values_supported": []string{"ES256"},
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"keys": []map[string]string{{
+				"kty": "EC",
+				"crv": "P-256",
+				"alg": "ES256",
+				"use": "sig",
+				"kid": "test",
+				"x":   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+				"y":   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+			}},
+		})
+	})
+
+	caFile := filepath.Join(t.TempDir(), "oidc-ca.crt")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: issuer.Certificate().Raw})
+	if err := os.WriteFile(caFile, caPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return issuer, caFile
+}
+
+// newOIDCCommand returns a command with the OIDC flags of the API server
+func newOIDCCommand() *cobra.Command {
+	command := &cobra.Command{}
+	for _, name := range []string{"oidc-issuer-url", "oidc-client-id", "oidc-username-claim", "oidc-username-prefix", "oidc-groups-claim", "oidc-groups-prefix", "oidc-ca-file"} {
+		command.Flags().String(name, "", "")
+	}
+	return command
+}
+
+// fetchJSON decodes the JSON document at the URL, trusting only the CA of the file
+func fetchJSON(t *testing.T, caFile, url string, into any) {
+	t.Helper()
+
+	caPEM, err := os.ReadFile(caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(caPEM) {
+		t.Fatalf("no certificate in %s", caFile)
+	}
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatalf("failed to fetch %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("fetching %s returned %s", url, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(into); err != nil {
+		t.Fatalf("failed to decode %s: %v", url, err)
+	}
+}
+
+func TestConfigureOIDCFlags(t *testing.T) {
+	issuer, caFile := newTestIssuer(t)
+
+	tests := []struct {
+		name   string
+		config OIDCConfig
+		expect map[string]string
+	}{
+		{
+			name:   "disabled without an issuer",
+			config: OIDCConfig{ClientID: "kubesolo"},
+			expect: map[string]string{"oidc-issuer-url": "", "oidc-client-id": ""},
+		},
+		{
+			name:   "issuer and client only",
+			config: OIDCConfig{IssuerURL: issuer.URL, ClientID: "kubesolo", CAFile: caFile},
+			expect: map[string]string{
+				"oidc-issuer-url":     issuer.URL,
+				"oidc-client-id":      "kubesolo",
+				"oidc-ca-file":        caFile,
+				"oidc-username-claim": "",
+				"oidc-groups-claim":   "",
+			},
+		},
+		{
+			name: "claims and prefixes",
+			config: OIDCConfig{
+				IssuerURL:      issuer.URL,
+				ClientID:       "kubesolo",
+				UsernameClaim:  "email",
+				UsernamePrefix: "oidc:",
+				GroupsClaim:    "groups",
+				GroupsPrefix:   "oidc:",
+				CAFile:         caFile,
+			},
+			expect: map[string]string{
+				"oidc-issuer-url":      issuer.URL,
+				"oidc-client-id":       "kubesolo",
+				"oidc-username-claim":  "email",
+				"oidc-username-prefix": "oidc:",
+				"oidc-groups-claim":    "groups",
+				"oidc-groups-prefix":   "oidc:",
+				"oidc-ca-file":         caFile,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &service{config: Config{OIDC: tt.config}}
+			command := newOIDCCommand()
+			if err := s.configureOIDCFlags(command); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			for name, expect := range tt.expect {
+				if got, _ := command.Flags().GetString(name); got != expect {
+					t.Errorf("flag %s = %q, expected %q", name, got, expect)
+				}
+			}
+			if tt.config.IssuerURL == "" {
+				return
+			}
+
+			// the API server discovers the signing keys from the issuer with the flags it was given
+			issuerURL, _ := command.Flags().GetString("oidc-issuer-url")
+			oidcCAFile, _ := command.Flags().GetString("oidc-ca-file")
+			discovery := struct {
+				Issuer  string `json:"issuer"`
+				JWKSURI string `json:"jwks_uri"`
+			}{}
+			fetchJSON(t, oidcCAFile, issuerURL+"/.well-known/openid-configuration", &discovery)
+			if discovery.Issuer != issuerURL {
+				t.Fatalf("discovery issuer %q does not match the issuer flag %q", discovery.Issuer, issuerURL)
+			}
+			keys := struct {
+				Keys []map[string]string `json:"keys"`
+			}{}
+			fetchJSON(t, oidcCAFile, discovery.JWKSURI, &keys)
+			if len(keys.Keys) != 1 || keys.Keys[0]["kid"] != "test" {
+				t.Fatalf("unexpected JWKS: %v", keys.Keys)
+			}
+		})
+	}
+}
+
+func TestOIDCConfigValidate(t *testing.T) {
+	issuer, caFile := newTestIssuer(t)
+
+	tests := []struct {
+		name    string
+		config  OIDCConfig
+		wantErr bool
+	}{
+		{name: "disabled", config: OIDCConfig{}},
+		{name: "valid", config: OIDCConfig{IssuerURL: issuer.URL, ClientID: "kubesolo", CAFile: caFile}},
+		{name: "http issuer", config: OIDCConfig{IssuerURL: "http://issuer.example.com", ClientID: "kubesolo"}, wantErr: true},
+		{name: "issuer without host", config: OIDCConfig{IssuerURL: "https://", ClientID: "kubesolo"}, wantErr: true},
+		{name: "missing client ID", config: OIDCConfig{IssuerURL: issuer.URL}, wantErr: true},
+		{name: "missing CA file", config: OIDCConfig{IssuerURL: issuer.URL, ClientID: "kubesolo", CAFile: filepath.Join(t.TempDir(), "missing.crt")}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	s := &service{config: Config{OIDC: OIDCConfig{IssuerURL: "http://issuer.example.com", ClientID: "kubesolo"}}}
+	if err := s.configureOIDCFlags(newOIDCCommand()); err == nil {
+		t.Fatal("expected configureOIDCFlags to reject an invalid config")
+	}
+}
@@ -0,0 +1,75 @@
+package apiserver
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"k8s.io/kubernetes/pkg/kubeapiserver/options"
+)
+
+// defaultAdmissionPlugins are the admission plugins enabled on every node
+var defaultAdmissionPlugins = []string{
+	"NodeRestriction",
+	"ServiceAccount",
+	"MutatingAdmissionWebhook",
+	// the webhook rejects pods the node cannot run unless the built-in scheduler leaves them pending
+	"ValidatingAdmissionWebhook",
+	"DefaultStorageClass",
+	"CertificateApproval",
+	"CertificateSigning",
+	"CertificateSubjectRestriction",
+	"PodSecurity",
+}
+
+// disabledAdmissionPlugins are admission plugins enabled upstream by default that kubesolo turns off to save memory and requests
+// each of them can be turned back on with --enable-admission-plugins
+var disabledAdmissionPlugins = []string{
+	"RuntimeClass",
+	"ClusterTrustBundleAttest",
+	"MutatingAdmissionPolicy",
+	"ValidatingAdmissionPolicy",
+	"DefaultIngressClass",
+	"TaintNodesByCondition",
+	"Priority",
+	"DefaultTolerationSeconds",
+	"StorageObjectInUseProtection",
+	"PersistentVolumeClaimResize",
+	"ResourceQuota",
+	"LimitRanger",
+}
+
+// ParseAdmissionPlugins parses a comma separated list of admission plugins to enable on top of the defaults
+// it fails on names the API server does not know, so a typo does not silently leave a plugin off
+func ParseAdmissionPlugins(list string) ([]string, error) {
+	plugins := []string{}
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || slices.Contains(plugins, name) {
+			continue
+		}
+		if !slices.Contains(options.AllOrderedPlugins, name) {
+			return nil, fmt.Errorf("unknown admission plugin %q", name)
+		}
+		plugins = append(plugins, name)
+	}
+	return plugins, nil
+}
+
+// admissionPluginFlags returns the enabled and disabled admission plugins with the extra plugins turned on
+func admissionPluginFlags(extra []string) (string, string) {
+	enabled := slices.Clone(defaultAdmissionPlugins)
+	for _, name := range extra {
+		if !slices.Contains(enabled, name) {
+			enabled = append(enabled, name)
+		}
+	}
+
+	disabled := []string{}
+	for _, name := range disabledAdmissionPlugins {
+		if !slices.Contains(enabled, name) {
+			disabled = append(disabled, name)
+		}
+	}
+	return strings.Join(enabled, ","), strings.Join(disabled, ",")
+}
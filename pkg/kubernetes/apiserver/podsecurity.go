@@ -0,0 +1,112 @@
+package apiserver
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/portainer/kubesolo/internal/runtime/filesystem"
+	"github.com/portainer/kubesolo/pkg/components/localpath"
+	"github.com/portainer/kubesolo/pkg/components/portainer"
+	"github.com/rs/zerolog/log"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// podSecurityPluginName is the name of the Pod Security Admission plugin in the admission configuration
+const podSecurityPluginName = "PodSecurity"
+
+// podSecurityExemptNamespaces are the namespaces of the components kubesolo deploys
+// they need host access, so pod security levels are not applied to them
+var podSecurityExemptNamespaces = []string{
+	metav1.NamespaceSystem,
+	localpath.LocalPathNamespace,
+	portainer.PortainerNamespace,
+}
+
+// podSecurityConfiguration returns the Pod Security Admission defaults applied to namespaces without pod security labels
+func (s *service) podSecurityConfiguration() map[string]any {
+	return map[string]any{
+		"apiVersion": "pod-security.admission.config.k8s.io/v1",
+		"kind":       "PodSecurityConfiguration",
+		"defaults": map[string]any{
+			"enforce":         s.config.PodSecurityEnforce,
+			"enforce-version": "latest",
+			"audit":           s.config.PodSecurityAudit,
+			"audit-version":   "latest",
+			"warn":            s.config.PodSecurityWarn,
+			"warn-version":    "latest",
+		},
+		"exemptions": map[string]any{
+			"usernames":      []string{},
+			"runtimeClasses": []string{},
+			"namespaces":     podSecurityExemptNamespaces,
+		},
+	}
+}
+
+// writeAdmissionConfig writes the admission configuration passed to the API server and returns its path
+// plugin configurations from a user-supplied file are kept as they are, the generated pod security defaults are only added
+// when the file does not configure PodSecurity itself
+func (s *service) writeAdmissionConfig() (string, error) {
+	plugins := []any{}
+
+	if s.config.AdmissionConfigFile != "" {
+		data, err := os.ReadFile(s.config.AdmissionConfigFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read admission configuration: %v", err)
+		}
+		config := map[string]any{}
+		if err := yaml.Unmarshal(data, &config); err != nil {
+			return "", fmt.Errorf("failed to parse admission configuration: %v", err)
+		}
+		if config["plugins"] != nil {
+			userPlugins, ok := config["plugins"].([]any)
+			if !ok {
+				return "", fmt.Errorf("plugins of the admission configuration must be a list")
+			}
+			plugins = userPlugins
+		}
+	}
+
+	hasPodSecurity := false
+	for _, entry := range plugins {
+		plugin, ok := entry.(map[string]any)
+		if !ok {
+			return "", fmt.Errorf("invalid plugin entry in the admission configuration")
+		}
+		if plugin["name"] == podSecurityPluginName {
+			hasPodSecurity = true
+			log.Info().Str("component", "apiserver").Msgf("using the PodSecurity configuration of %s", s.config.AdmissionConfigFile)
+		}
+		// paths are relative to the user-supplied file, which is not where the merged file is written
+		if path, ok := plugin["path"].(string); ok && path != "" && !filepath.IsAbs(path) {
+			plugin["path"] = filepath.Join(filepath.Dir(s.config.AdmissionConfigFile), path)
+		}
+	}
+	if !hasPodSecurity {
+		plugins = append(plugins, map[string]any{
+			"name":          podSecurityPluginName,
+			"configuration": s.podSecurityConfiguration(),
+		})
+		log.Info().Str("component", "apiserver").Msgf("pod security defaults: enforce %s, audit %s, warn %s", s.config.PodSecurityEnforce, s.config.PodSecurityAudit, s.config.PodSecurityWarn)
+	}
+
+	data, err := yaml.Marshal(map[string]any{
+		"apiVersion": "apiserver.config.k8s.io/v1",
+		"kind":       "AdmissionConfiguration",
+		"plugins":    plugins,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal admission configuration: %v", err)
+	}
+
+	if err := filesystem.EnsureDirectoryExists(s.serverPath); err != nil {
+		return "", fmt.Errorf("failed to create API server directory: %v", err)
+	}
+	configFile := filepath.Join(s.serverPath, "admission-config.yaml")
+	if err := os.WriteFile(configFile, data, 0600); err != nil {
+		return "", fmt.Errorf("failed to write admission configuration: %v", err)
+	}
+	return configFile, nil
+}
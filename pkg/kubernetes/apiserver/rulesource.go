@@ -0,0 +1,180 @@
+package apiserver
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rs/zerolog/log"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// ruleSource keeps the rules of a file and of a ConfigMap in kube-system parsed in memory for the webhook
+// the file is watched with fsnotify and the ConfigMap with an informer, so admission requests read a snapshot
+// instead of reading the file and the API server every time
+// a change that cannot be parsed is logged and the previous rules of that source are kept
+type ruleSource[T any] struct {
+	description   string
+	file          string
+	configMapName string
+	configMapKey  string
+	parse         func([]byte) ([]T, error)
+
+	// mu serializes the updates of the two sources, readers only load the snapshot
+	mu             sync.Mutex
+	fileRules      []T
+	configMapRules []T
+	snapshot       atomic.Pointer[[]T]
+}
+
+// newRuleSource creates a rule source for the file, which is optional, and the ConfigMap key
+func newRuleSource[T any](description, file, configMapName, configMapKey string, parse func([]byte) ([]T, error)) *ruleSource[T] {
+	return &ruleSource[T]{
+		description:   description,
+		file:          file,
+		configMapName: configMapName,
+		configMapKey:  configMapKey,
+		parse:         parse,
+	}
+}
+
+// rules returns the rules of the file followed by the rules of the ConfigMap, the slice must not be modified
+func (r *ruleSource[T]) rules() []T {
+	if rules := r.snapshot.Load(); rules != nil {
+		return *rules
+	}
+	return nil
+}
+
+// update replaces the rules of one of the sources and publishes a new snapshot
+func (r *ruleSource[T]) update(set func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	set()
+	rules := make([]T, 0, len(r.fileRules)+len(r.configMapRules))
+	rules = append(rules, r.fileRules...)
+	rules = append(rules, r.configMapRules...)
+	r.snapshot.Store(&rules)
+}
+
+// loadFile parses the file into the rules of the file source, a missing file has no rules
+func (r *ruleSource[T]) loadFile() {
+	data, err := os.ReadFile(r.file)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Warn().Str("component", "webhook").Msgf("%s file %s does not exist, its rules are removed", r.description, r.file)
+		r.update(func() { r.fileRules = nil })
+		return
+	}
+	if err == nil {
+		var rules []T
+		if rules, err = r.parse(data); err == nil {
+			r.update(func() { r.fileRules = rules })
+			log.Info().Str("component", "webhook").Msgf("loaded %d %s rule(s) from %s", len(rules), r.description, r.file)
+			return
+		}
+	}
+	log.Error().Str("component", "webhook").Msgf("failed to load %s file %s, keeping the previous rules: %v", r.description, r.file, err)
+}
+
+// loadConfigMap parses the ConfigMap into the rules of the ConfigMap source, nil removes them
+func (r *ruleSource[T]) loadConfigMap(configMap *corev1.ConfigMap) {
+	if configMap == nil {
+		r.update(func() { r.configMapRules = nil })
+		log.Info().Str("component", "webhook").Msgf("%s ConfigMap %s/%s removed", r.description, metav1.NamespaceSystem, r.configMapName)
+		return
+	}
+
+	rules, err := r.parse([]byte(configMap.Data[r.configMapKey]))
+	if err != nil {
+		log.Error().Str("component", "webhook").Msgf("failed to load %s ConfigMap %s/%s, keeping the previous rules: %v", r.description, metav1.NamespaceSystem, r.configMapName, err)
+		return
+	}
+	r.update(func() { r.configMapRules = rules })
+	log.Info().Str("component", "webhook").Msgf("loaded %d %s rule(s) from ConfigMap %s/%s", len(rules), r.description, metav1.NamespaceSystem, r.configMapName)
+}
+
+// watchFile loads the file and reloads it on every change until the context is cancelled
+// the directory is watched rather than the file, so a file replaced by a rename, as editors and config management do, is followed
+func (r *ruleSource[T]) watchFile(ctx context.Context) {
+	if r.file == "" {
+		return
+	}
+	r.loadFile()
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Error().Str("component", "webhook").Msgf("failed to watch %s file %s, changes need a restart: %v", r.description, r.file, err)
+		return
+	}
+	if err := watcher.Add(filepath.Dir(r.file)); err != nil {
+		watcher.Close()
+		log.Error().Str("component", "webhook").Msgf("failed to watch %s file %s, changes need a restart: %v", r.description, r.file, err)
+		return
+	}
+
+	go func() {
+		defer watcher.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) == filepath.Clean(r.file) && !event.Has(fsnotify.Chmod) {
+					r.loadFile()
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Error().Str("component", "webhook").Msgf("error watching %s file %s: %v", r.description, r.file, err)
+			}
+		}
+	}()
+}
+
+// watchConfigMap keeps the rules of the ConfigMap in sync until the context is cancelled
+// only the ConfigMap itself is watched, through a field selector on its name
+func (r *ruleSource[T]) watchConfigMap(ctx context.Context, clientset kubernetes.Interface) {
+	factory := informers.NewSharedInformerFactoryWithOptions(clientset, 0,
+		informers.WithNamespace(metav1.NamespaceSystem),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", r.configMapName).String()
+		}),
+	)
+
+	if _, err := factory.Core().V1().ConfigMaps().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj any) {
+			if configMap, ok := obj.(*corev1.ConfigMap); ok {
+				r.loadConfigMap(configMap)
+			}
+		},
+		UpdateFunc: func(_, obj any) {
+			if configMap, ok := obj.(*corev1.ConfigMap); ok {
+				r.loadConfigMap(configMap)
+			}
+		},
+		DeleteFunc: func(any) { r.loadConfigMap(nil) },
+	}); err != nil {
+		log.Error().Str("component", "webhook").Msgf("failed to watch %s ConfigMap %s/%s: %v", r.description, metav1.NamespaceSystem, r.configMapName, err)
+		return
+	}
+
+	factory.Start(ctx.Done())
+	go func() {
+		<-ctx.Done()
+		factory.Shutdown()
+	}()
+}
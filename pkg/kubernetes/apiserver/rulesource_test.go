@@ -0,0 +1,58 @@
+package apiserver
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestRuleSource(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "host-aliases.yaml")
+	source := newRuleSource("host aliases", file, hostAliasesConfigMapName, hostAliasesConfigMapKey, parseHostAliases)
+
+	write := func(data string) {
+		t.Helper()
+		if err := os.WriteFile(file, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		source.loadFile()
+	}
+	ips := func() []string {
+		result := []string{}
+		for _, rule := range source.rules() {
+			result = append(result, rule.IP)
+		}
+		return result
+	}
+	expect := func(want ...string) {
+		t.Helper()
+		if got := ips(); !slices.Equal(got, want) {
+			t.Fatalf("got rules %v, expected %v", got, want)
+		}
+	}
+
+	expect()
+
+	write("hostAliases:\n  - ip: 10.0.0.1\n    hostnames: [a.local]\n")
+	expect("10.0.0.1")
+
+	source.loadConfigMap(&corev1.ConfigMap{Data: map[string]string{hostAliasesConfigMapKey: "hostAliases:\n  - ip: 10.0.0.2\n    hostnames: [b.local]\n"}})
+	expect("10.0.0.1", "10.0.0.2")
+
+	// invalid changes keep the previous rules of that source
+	write("hostAliases: [")
+	source.loadConfigMap(&corev1.ConfigMap{Data: map[string]string{hostAliasesConfigMapKey: "hostAliases:\n  - ip: nope\n"}})
+	expect("10.0.0.1", "10.0.0.2")
+
+	if err := os.Remove(file); err != nil {
+		t.Fatal(err)
+	}
+	source.loadFile()
+	expect("10.0.0.2")
+
+	source.loadConfigMap(nil)
+	expect()
+}
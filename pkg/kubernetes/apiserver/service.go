@@ -3,9 +3,39 @@ package apiserver
 import (
 	"context"
 
+	"github.com/portainer/kubesolo/internal/core/featuregates"
 	"github.com/portainer/kubesolo/types"
 )
 
+// Config holds the API server options set from the command line
+// AuditLogPath defaults to the audit log under the kubesolo path and none disables audit logging, AuditPolicyFile defaults to the built-in policy
+// AdmissionPlugins are turned on in addition to the defaults, AdmissionConfigFile configures them
+// PodSecurityEnforce, PodSecurityAudit and PodSecurityWarn are the pod security levels of namespaces without their own labels
+// OIDC is the OpenID Connect provider users sign in with
+// MetricsAPI serves metrics.k8s.io from the kubelet stats instead of a metrics-server deployment
+// FeatureGates are shared with the other components, RuntimeConfig enables or disables API groups and versions
+// HostAliasesFile holds host aliases the webhook adds to pods, MutationRulesFile holds rules the webhook applies to new objects
+// Scheduler leaves pods without a node to the built-in scheduler instead of binding them at admission
+type Config struct {
+	AuditLogPath        string
+	AuditPolicyFile     string
+	AuditLogMaxSize     int
+	AuditLogMaxBackup   int
+	AuditLogMaxAge      int
+	AdmissionPlugins    []string
+	AdmissionConfigFile string
+	PodSecurityEnforce  string
+	PodSecurityAudit    string
+	PodSecurityWarn     string
+	OIDC                OIDCConfig
+	MetricsAPI          bool
+	FeatureGates        featuregates.Gates
+	RuntimeConfig       string
+	HostAliasesFile     string
+	MutationRulesFile   string
+	Scheduler           bool
+}
+
 // service is the service for the API server
 type service struct {
 	apiServerReady        chan struct{}
@@ -20,12 +50,25 @@ type service struct {
 	adminCertFile         string
 	adminKeyFile          string
 	adminKubeconfig       string
+	frontProxyCAFile      string
+	frontProxyCertFile    string
+	frontProxyKeyFile     string
 	serviceAccountKeyFile string
+	serviceAccountPubFile string
+	encryptionConfigFile  string
 	kubeSoloWebhook       *webhoook
+	metricsServer         *metricsServer
+	embedded              types.Embedded
+	config                Config
 }
 
 // NewService creates a new API server service
-func NewService(ctx context.Context, cancel context.CancelFunc, apiServerReady chan struct{}, nodeName string, embedded types.Embedded) *service {
+func NewService(ctx context.Context, cancel context.CancelFunc, apiServerReady chan struct{}, nodeName string, embedded types.Embedded, config Config) *service {
+	var metrics *metricsServer
+	if config.MetricsAPI {
+		metrics = newMetricsServer(nodeName, embedded)
+	}
+
 	return &service{
 		apiServerReady:        apiServerReady,
 		ctx:                   ctx,
@@ -39,7 +82,15 @@ func NewService(ctx context.Context, cancel context.CancelFunc, apiServerReady c
 		adminCertFile:         embedded.AdminCerts.Cert,
 		adminKeyFile:          embedded.AdminCerts.Key,
 		adminKubeconfig:       embedded.AdminKubeconfigFile,
+		frontProxyCAFile:      embedded.FrontProxyCACerts.Cert,
+		frontProxyCertFile:    embedded.FrontProxyClientCerts.Cert,
+		frontProxyKeyFile:     embedded.FrontProxyClientCerts.Key,
 		serviceAccountKeyFile: embedded.ServiceAccountKeyFile,
-		kubeSoloWebhook:       newWebhook(nodeName, embedded.PKIDir),
+		serviceAccountPubFile: embedded.ServiceAccountPublicKeyFile,
+		encryptionConfigFile:  embedded.EncryptionConfigFile,
+		kubeSoloWebhook:       newWebhook(nodeName, embedded.PKIDir, config.HostAliasesFile, config.MutationRulesFile, config.Scheduler),
+		metricsServer:         metrics,
+		embedded:              embedded,
+		config:                config,
 	}
 }
@@ -1,39 +0,0 @@
-package apiserver
-
-import (
-	"crypto/rand"
-	"crypto/rsa"
-	"crypto/x509"
-	"encoding/pem"
-	"fmt"
-	"os"
-)
-
-// generateServiceAccountKey generates a service account key if it doesn't exist
-func (s *service) generateServiceAccountKey() error {
-	if _, err := os.Stat(s.serviceAccountKeyFile); err == nil {
-		return nil
-	}
-
-	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
-	if err != nil {
-		return fmt.Errorf("failed to generate private key: %v", err)
-	}
-
-	privateKeyPEM := &pem.Block{
-		Type:  "RSA PRIVATE KEY",
-		Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
-	}
-
-	keyFile, err := os.OpenFile(s.serviceAccountKeyFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
-	if err != nil {
-		return fmt.Errorf("failed to open key file: %v", err)
-	}
-	defer keyFile.Close()
-
-	if err := pem.Encode(keyFile, privateKeyPEM); err != nil {
-		return fmt.Errorf("failed to write private key: %v", err)
-	}
-
-	return nil
-}
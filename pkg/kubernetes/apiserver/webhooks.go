@@ -2,13 +2,17 @@ package apiserver
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
+	"time"
 
+	"github.com/portainer/kubesolo/internal/core/audit"
+	"github.com/portainer/kubesolo/internal/core/pki"
 	kubesolokubernetes "github.com/portainer/kubesolo/internal/kubernetes"
 	"github.com/portainer/kubesolo/types"
 	"github.com/rs/zerolog/log"
@@ -30,48 +34,87 @@ var (
 )
 
 // webhoook is a webhook that handles pod mutations for KubeSolo
+// hostAliases holds the host aliases added to pods and mutationRules the rules changing the objects the webhook receives,
+// both come from an optional file and a ConfigMap, see ruleSource
+// pods are left pending for the built-in scheduler to bind when scheduler is set
+// registeredAt is when the mutating webhook configuration was last written, see diagnoseWebhook
+// auditLog receives the audit events of the API server when audit logging is on
 type webhoook struct {
-	server       *http.Server
-	nodeName     string
-	pkiPath      string
-	clientset    *kubernetes.Clientset
-	hostsEntries map[string]string
+	server        *http.Server
+	nodeName      string
+	pkiPath       string
+	hostAliases   *ruleSource[hostAliasRule]
+	mutationRules *ruleSource[mutationRule]
+	scheduler     bool
+	clientset     *kubernetes.Clientset
+	registeredAt  time.Time
+	auditLog      *audit.Log
 }
 
 // newWebhook creates a new webhook server
-func newWebhook(nodeName, pkiPath string) *webhoook {
+func newWebhook(nodeName, pkiPath, hostAliasesFile, mutationRulesFile string, scheduler bool) *webhoook {
 	return &webhoook{
-		nodeName:     nodeName,
-		pkiPath:      pkiPath,
-		hostsEntries: make(map[string]string),
+		nodeName:      nodeName,
+		pkiPath:       pkiPath,
+		hostAliases:   newRuleSource("host aliases", hostAliasesFile, hostAliasesConfigMapName, hostAliasesConfigMapKey, parseHostAliases),
+		mutationRules: newRuleSource("mutation rules", mutationRulesFile, mutationRulesConfigMapName, mutationRulesConfigMapKey, parseMutationRules),
+		scheduler:     scheduler,
 	}
 }
 
 // start starts the webhook server
+// the certificate is served through a reloader so a renewed certificate is picked up without a restart
 func (w *webhoook) start(ctx context.Context) error {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/mutate", w.serveMutate)
+	mux.HandleFunc("/validate", w.serveValidate)
+	if w.auditLog != nil {
+		mux.HandleFunc(auditWebhookPath, w.serveAudit)
+	}
+
+	certPath := filepath.Join(w.pkiPath, "webhook", "webhook.crt")
+	keyPath := filepath.Join(w.pkiPath, "webhook", "webhook.key")
+
+	reloader, err := pki.NewKeyPairReloader(certPath, keyPath)
+	if err != nil {
+		return fmt.Errorf("failed to load webhook certificate: %v", err)
+	}
 
 	w.server = &http.Server{
 		Addr:    fmt.Sprintf(":%d", types.DefaultWebhookPort),
 		Handler: mux,
+		TLSConfig: &tls.Config{
+			GetCertificate: reloader.GetCertificate,
+			// the API server presents its certificate when it sends audit events, admission requests come without one
+			ClientAuth: tls.RequestClientCert,
+		},
 	}
 
-	certPath := filepath.Join(w.pkiPath, "webhook", "webhook.crt")
-	keyPath := filepath.Join(w.pkiPath, "webhook", "webhook.key")
+	w.hostAliases.watchFile(ctx)
+	w.mutationRules.watchFile(ctx)
 
 	log.Info().Str("component", "webhook").Msgf("starting webhook server on :%d", types.DefaultWebhookPort)
 
-	w.startServer(certPath, keyPath)
+	w.startServer()
 	w.handleShutdown(ctx)
 
 	return nil
 }
 
+// watchRuleConfigMaps keeps the host aliases and mutation rules of the ConfigMaps in sync once the client is set
+func (w *webhoook) watchRuleConfigMaps(ctx context.Context) {
+	if w.clientset == nil {
+		log.Error().Str("component", "webhook").Msg("no kubernetes client, the host aliases and mutation rules ConfigMaps are not watched")
+		return
+	}
+	w.hostAliases.watchConfigMap(ctx, w.clientset)
+	w.mutationRules.watchConfigMap(ctx, w.clientset)
+}
+
 // startServer starts the webhook server
-func (w *webhoook) startServer(certPath, keyPath string) {
+func (w *webhoook) startServer() {
 	go func() {
-		if err := w.server.ListenAndServeTLS(certPath, keyPath); err != nil && err != http.ErrServerClosed {
+		if err := w.server.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
 			log.Error().Str("component", "webhook").Err(err).Msg("webhook server failed")
 		}
 	}()
@@ -84,6 +127,11 @@ func (w *webhoook) handleShutdown(ctx context.Context) {
 		if err := w.server.Shutdown(context.Background()); err != nil {
 			log.Error().Str("component", "webhook").Err(err).Msg("error shutting down webhook server")
 		}
+		if w.auditLog != nil {
+			if err := w.auditLog.Close(); err != nil {
+				log.Error().Str("component", "webhook").Err(err).Msg("error closing the audit log")
+			}
+		}
 	}()
 }
 
@@ -106,6 +154,7 @@ func (w *webhoook) serveMutate(resp http.ResponseWriter, req *http.Request) {
 	case "PersistentVolumeClaim":
 		patches = w.processPVCMutation(admissionReview)
 	}
+	patches = w.applyMutationRules(admissionReview, patches)
 
 	w.sendResponse(resp, admissionReview, patches)
 }
@@ -162,16 +211,24 @@ func (w *webhoook) processPodMutation(admissionReview *admissionv1.AdmissionRevi
 		Str("currentNode", pod.Spec.NodeName).
 		Msg("processing pod")
 
-	if pod.Spec.NodeName == "" {
-		return w.createNodeNamePatch(pod)
+	var patches []map[string]interface{}
+	if pod.Spec.NodeName == "" && w.scheduler {
+		log.Debug().Str("component", "webhook").
+			Str("pod", pod.Name).
+			Str("namespace", pod.Namespace).
+			Msg("leaving pod to the scheduler")
+	} else if pod.Spec.NodeName == "" {
+		patches = append(patches, w.createNodeNamePatch(pod)...)
+	} else {
+		log.Debug().Str("component", "webhook").
+			Str("pod", pod.Name).
+			Str("namespace", pod.Namespace).
+			Str("node", pod.Spec.NodeName).
+			Msg("pod already has node name assigned")
 	}
 
-	log.Debug().Str("component", "webhook").
-		Str("pod", pod.Name).
-		Str("namespace", pod.Namespace).
-		Str("node", pod.Spec.NodeName).
-		Msg("pod already has node name assigned")
-	return nil
+	// the namespace of a pod created through a workload is only set on the request
+	return append(patches, w.createHostAliasesPatch(pod, admissionReview.Request.Namespace)...)
 }
 
 // createNodeNamePatch creates a patch to set the node name for the pod
@@ -274,14 +331,27 @@ func (w *webhoook) RegisterWebhook(kubeconfig string) error {
 		return err
 	}
 
-	return w.createOrUpdateConfig(webhookConfig)
+	if err := w.createOrUpdateConfig(webhookConfig); err != nil {
+		return err
+	}
+	w.registeredAt = time.Now()
+	return w.registerValidatingWebhook()
+}
+
+// readCABundle reads the CA bundle the API server verifies the webhook certificate with
+func (w *webhoook) readCABundle() ([]byte, error) {
+	caCert, err := os.ReadFile(filepath.Join(w.pkiPath, "ca", "ca-bundle.crt"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA bundle: %v", err)
+	}
+	return caCert, nil
 }
 
 // createConfiguration creates the webhook configuration
 func (w *webhoook) createConfiguration() (*admissionregistrationv1.MutatingWebhookConfiguration, error) {
-	caCert, err := os.ReadFile(filepath.Join(w.pkiPath, "webhook", "webhook.crt"))
+	caCert, err := w.readCABundle()
 	if err != nil {
-		return nil, fmt.Errorf("failed to read CA certificate: %v", err)
+		return nil, err
 	}
 
 	failurePolicy := admissionregistrationv1.Ignore
@@ -323,8 +393,9 @@ func (w *webhoook) createConfiguration() (*admissionregistrationv1.MutatingWebho
 }
 
 // createOrUpdateConfig creates or updates the webhook configuration
+// an existing configuration is updated so the CA bundle follows a renewed certificate
 func (w *webhoook) createOrUpdateConfig(webhookConfig *admissionregistrationv1.MutatingWebhookConfiguration) error {
-	_, err := w.clientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(
+	existing, err := w.clientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(
 		context.Background(),
 		types.DefaultWebhookName,
 		metav1.GetOptions{},
@@ -333,12 +404,15 @@ func (w *webhoook) createOrUpdateConfig(webhookConfig *admissionregistrationv1.M
 	if err != nil {
 		if k8serrors.IsNotFound(err) {
 			return w.createConfig(webhookConfig)
-		} else if k8serrors.IsAlreadyExists(err) {
-			return w.updateConfig(webhookConfig)
 		}
 		return fmt.Errorf("failed to get webhook configuration: %v", err)
 	}
 
+	webhookConfig.ResourceVersion = existing.ResourceVersion
+	if err := w.updateConfig(webhookConfig); err != nil {
+		return err
+	}
+
 	log.Info().Str("component", "webhook").Msgf("webhook %s registered with API server", types.DefaultWebhookName)
 	return nil
 }
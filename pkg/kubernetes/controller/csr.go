@@ -0,0 +1,239 @@
+package controller
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/portainer/kubesolo/internal/core/pki"
+	kubesolokubernetes "github.com/portainer/kubesolo/internal/kubernetes"
+	"github.com/portainer/kubesolo/internal/runtime/network"
+	"github.com/rs/zerolog/log"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// csrCertificateValidity is how long certificates issued for kubelet CSRs are valid when the request does not ask for less
+const csrCertificateValidity = 365 * 24 * time.Hour
+
+// csrSigner describes the certificates the built-in signer issues for a signer name
+type csrSigner struct {
+	// allowedUsages are the usages a request may ask for, requiredUsage must be one of them
+	allowedUsages []certificatesv1.KeyUsage
+	requiredUsage certificatesv1.KeyUsage
+	extKeyUsage   x509.ExtKeyUsage
+	// allowSANs is true for serving certificates, client certificates carry no SANs
+	allowSANs bool
+}
+
+// csrSigners are the signer names handled by the built-in approver and signer
+// requests for any other signer are left for the cluster administrator
+var csrSigners = map[string]csrSigner{
+	certificatesv1.KubeAPIServerClientKubeletSignerName: {
+		allowedUsages: []certificatesv1.KeyUsage{certificatesv1.UsageDigitalSignature, certificatesv1.UsageKeyEncipherment, certificatesv1.UsageClientAuth},
+		requiredUsage: certificatesv1.UsageClientAuth,
+		extKeyUsage:   x509.ExtKeyUsageClientAuth,
+	},
+	certificatesv1.KubeletServingSignerName: {
+		allowedUsages: []certificatesv1.KeyUsage{certificatesv1.UsageDigitalSignature, certificatesv1.UsageKeyEncipherment, certificatesv1.UsageServerAuth},
+		requiredUsage: certificatesv1.UsageServerAuth,
+		extKeyUsage:   x509.ExtKeyUsageServerAuth,
+		allowSANs:     true,
+	},
+}
+
+// runCSRController approves and signs the kubelet client and serving certificate requests of this node until the context is cancelled
+// a request is only approved when it comes from the node itself and asks for the node identity,
+// the hostname and the host addresses, so the kubelet can rotate its certificates through the Kubernetes API
+func (s *service) runCSRController() {
+	clientset, err := kubesolokubernetes.GetKubernetesClient(s.adminKubeconfigFile)
+	if err != nil {
+		log.Error().Str("component", "controller").Msgf("failed to create kubernetes client for the CSR controller: %v", err)
+		return
+	}
+
+	factory := informers.NewSharedInformerFactory(clientset, 0)
+	informer := factory.Certificates().V1().CertificateSigningRequests().Informer()
+	if _, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj any) {
+			if csr, ok := obj.(*certificatesv1.CertificateSigningRequest); ok {
+				s.handleCSR(clientset, csr.DeepCopy())
+			}
+		},
+		UpdateFunc: func(_, obj any) {
+			if csr, ok := obj.(*certificatesv1.CertificateSigningRequest); ok {
+				s.handleCSR(clientset, csr.DeepCopy())
+			}
+		},
+	}); err != nil {
+		log.Error().Str("component", "controller").Msgf("failed to watch certificate signing requests: %v", err)
+		return
+	}
+
+	log.Info().Str("component", "controller").Msgf("CSR approver and signer started for node %s", s.nodeName)
+	factory.Start(s.ctx.Done())
+	<-s.ctx.Done()
+	factory.Shutdown()
+}
+
+// handleCSR approves a pending request of this node, then signs it once it is approved
+func (s *service) handleCSR(clientset *kubernetes.Clientset, csr *certificatesv1.CertificateSigningRequest) {
+	signer, ok := csrSigners[csr.Spec.SignerName]
+	if !ok || len(csr.Status.Certificate) > 0 || hasCSRCondition(csr, certificatesv1.CertificateDenied) || hasCSRCondition(csr, certificatesv1.CertificateFailed) {
+		return
+	}
+
+	request, err := parseCSR(csr)
+	if err != nil {
+		log.Warn().Str("component", "controller").Str("csr", csr.Name).Msgf("ignoring certificate signing request: %v", err)
+		return
+	}
+	if err := s.validateCSR(csr, request, signer); err != nil {
+		log.Warn().Str("component", "controller").Str("csr", csr.Name).Msgf("leaving certificate signing request for the administrator: %v", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, 30*time.Second)
+	defer cancel()
+
+	if !hasCSRCondition(csr, certificatesv1.CertificateApproved) {
+		csr.Status.Conditions = append(csr.Status.Conditions, certificatesv1.CertificateSigningRequestCondition{
+			Type:           certificatesv1.CertificateApproved,
+			Status:         corev1.ConditionTrue,
+			Reason:         "KubeSoloAutoApproved",
+			Message:        "approved by the kubesolo CSR approver for this node",
+			LastUpdateTime: metav1.Now(),
+		})
+		if _, err := clientset.CertificatesV1().CertificateSigningRequests().UpdateApproval(ctx, csr.Name, csr, metav1.UpdateOptions{}); err != nil {
+			log.Error().Str("component", "controller").Str("csr", csr.Name).Msgf("failed to approve certificate signing request: %v", err)
+		}
+		// the approval triggers an update event, the request is signed then
+		return
+	}
+
+	keyUsage, err := x509KeyUsage(csr.Spec.Usages)
+	if err != nil {
+		log.Warn().Str("component", "controller").Str("csr", csr.Name).Msgf("cannot sign certificate signing request: %v", err)
+		return
+	}
+
+	validity := csrCertificateValidity
+	if csr.Spec.ExpirationSeconds != nil {
+		validity = min(validity, time.Duration(*csr.Spec.ExpirationSeconds)*time.Second)
+	}
+
+	certPEM, err := pki.SignCertificateRequest(s.embedded, request, keyUsage, []x509.ExtKeyUsage{signer.extKeyUsage}, validity)
+	if err != nil {
+		log.Error().Str("component", "controller").Str("csr", csr.Name).Msgf("failed to sign certificate signing request: %v", err)
+		return
+	}
+
+	csr.Status.Certificate = certPEM
+	if _, err := clientset.CertificatesV1().CertificateSigningRequests().UpdateStatus(ctx, csr, metav1.UpdateOptions{}); err != nil {
+		log.Error().Str("component", "controller").Str("csr", csr.Name).Msgf("failed to store signed certificate: %v", err)
+		return
+	}
+	log.Info().Str("component", "controller").Str("csr", csr.Name).Msgf("signed %s certificate for %s", csr.Spec.SignerName, request.Subject.CommonName)
+}
+
+// validateCSR checks that the request comes from this node and only asks for what the node is allowed to have
+func (s *service) validateCSR(csr *certificatesv1.CertificateSigningRequest, request *x509.CertificateRequest, signer csrSigner) error {
+	nodeUser := "system:node:" + s.nodeName
+
+	if csr.Spec.Username != nodeUser {
+		return fmt.Errorf("requested by %s, not by node %s", csr.Spec.Username, s.nodeName)
+	}
+	if request.Subject.CommonName != nodeUser {
+		return fmt.Errorf("common name %s is not %s", request.Subject.CommonName, nodeUser)
+	}
+	if !slices.Equal(request.Subject.Organization, []string{"system:nodes"}) {
+		return fmt.Errorf("organization %v is not [system:nodes]", request.Subject.Organization)
+	}
+	if len(request.EmailAddresses) > 0 || len(request.URIs) > 0 {
+		return fmt.Errorf("email and URI SANs are not allowed")
+	}
+
+	for _, usage := range csr.Spec.Usages {
+		if !slices.Contains(signer.allowedUsages, usage) {
+			return fmt.Errorf("usage %q is not allowed", usage)
+		}
+	}
+	if !slices.Contains(csr.Spec.Usages, signer.requiredUsage) {
+		return fmt.Errorf("usage %q is required", signer.requiredUsage)
+	}
+
+	if !signer.allowSANs {
+		if len(request.DNSNames) > 0 || len(request.IPAddresses) > 0 {
+			return fmt.Errorf("client certificates cannot have SANs")
+		}
+		return nil
+	}
+
+	if len(request.DNSNames) == 0 && len(request.IPAddresses) == 0 {
+		return fmt.Errorf("serving certificates need at least one SAN")
+	}
+	for _, name := range request.DNSNames {
+		if name != s.nodeName && name != "localhost" {
+			return fmt.Errorf("DNS name %s is not the node hostname", name)
+		}
+	}
+	hostIPs, err := network.GetLocalIPs()
+	if err != nil {
+		return fmt.Errorf("failed to read the host addresses: %v", err)
+	}
+	for _, ip := range request.IPAddresses {
+		if !slices.ContainsFunc(hostIPs, ip.Equal) {
+			return fmt.Errorf("IP address %s is not a host address", ip)
+		}
+	}
+	return nil
+}
+
+// parseCSR decodes the PEM encoded certificate request of a CSR
+func parseCSR(csr *certificatesv1.CertificateSigningRequest) (*x509.CertificateRequest, error) {
+	block, _ := pem.Decode(csr.Spec.Request)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, fmt.Errorf("request is not a PEM encoded certificate request")
+	}
+
+	request, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate request: %v", err)
+	}
+	return request, nil
+}
+
+// x509KeyUsage converts the key usages of a CSR into x509 key usages
+func x509KeyUsage(usages []certificatesv1.KeyUsage) (x509.KeyUsage, error) {
+	var keyUsage x509.KeyUsage
+	for _, usage := range usages {
+		switch usage {
+		case certificatesv1.UsageDigitalSignature:
+			keyUsage |= x509.KeyUsageDigitalSignature
+		case certificatesv1.UsageKeyEncipherment:
+			keyUsage |= x509.KeyUsageKeyEncipherment
+		case certificatesv1.UsageClientAuth, certificatesv1.UsageServerAuth:
+			// extended key usages are set from the signer
+		default:
+			return 0, fmt.Errorf("unsupported usage %q", usage)
+		}
+	}
+	return keyUsage, nil
+}
+
+// hasCSRCondition reports whether the CSR has a true condition of the given type
+func hasCSRCondition(csr *certificatesv1.CertificateSigningRequest, conditionType certificatesv1.RequestConditionType) bool {
+	for _, condition := range csr.Status.Conditions {
+		if condition.Type == conditionType && condition.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
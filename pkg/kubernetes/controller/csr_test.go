@@ -0,0 +1,270 @@
+package controller
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+
+	certificatesv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const testNodeName = "edge-01"
+
+// newTestCSR returns a CSR of the signer with a PEM encoded request built from the template
+func newTestCSR(t *testing.T, signerName, username string, usages []certificatesv1.KeyUsage, template *x509.CertificateRequest) *certificatesv1.CertificateSigningRequest {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &certificatesv1.CertificateSigningRequest{
+		Spec: certificatesv1.CertificateSigningRequestSpec{
+			Request:    pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}),
+			SignerName: signerName,
+			Username:   username,
+			Usages:     usages,
+		},
+	}
+}
+
+// nodeSubject returns the subject a kubelet of the node puts in its requests
+func nodeSubject(nodeName string) pkix.Name {
+	return pkix.Name{CommonName: "system:node:" + nodeName, Organization: []string{"system:nodes"}}
+}
+
+func TestValidateCSR(t *testing.T) {
+	clientUsages := []certificatesv1.KeyUsage{certificatesv1.UsageDigitalSignature, certificatesv1.UsageClientAuth}
+	servingUsages := []certificatesv1.KeyUsage{certificatesv1.UsageDigitalSignature, certificatesv1.UsageKeyEncipherment, certificatesv1.UsageServerAuth}
+	nodeUser := "system:node:" + testNodeName
+	spiffe, _ := url.Parse("spiffe://cluster.local/node")
+
+	tests := []struct {
+		name       string
+		signerName string
+		username   string
+		usages     []certificatesv1.KeyUsage
+		template   *x509.CertificateRequest
+		wantErr    string
+	}{
+		{
+			name:       "kubelet client certificate",
+			signerName: certificatesv1.KubeAPIServerClientKubeletSignerName,
+			username:   nodeUser,
+			usages:     clientUsages,
+			template:   &x509.CertificateRequest{Subject: nodeSubject(testNodeName)},
+		},
+		{
+			name:       "kubelet serving certificate",
+			signerName: certificatesv1.KubeletServingSignerName,
+			username:   nodeUser,
+			usages:     servingUsages,
+			template: &x509.CertificateRequest{
+				Subject:     nodeSubject(testNodeName),
+				DNSNames:    []string{testNodeName, "localhost"},
+				IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+			},
+		},
+		{
+			name:       "requested by another user",
+			signerName: certificatesv1.KubeAPIServerClientKubeletSignerName,
+			username:   "system:node:other",
+			usages:     clientUsages,
+			template:   &x509.CertificateRequest{Subject: nodeSubject(testNodeName)},
+			wantErr:    "requested by",
+		},
+		{
+			name:       "common name of another node",
+			signerName: certificatesv1.KubeAPIServerClientKubeletSignerName,
+			username:   nodeUser,
+			usages:     clientUsages,
+			template:   &x509.CertificateRequest{Subject: nodeSubject("other")},
+			wantErr:    "common name",
+		},
+		{
+			name:       "extra organization",
+			signerName: certificatesv1.KubeAPIServerClientKubeletSignerName,
+			username:   nodeUser,
+			usages:     clientUsages,
+			template: &x509.CertificateRequest{
+				Subject: pkix.Name{CommonName: nodeUser, Organization: []string{"system:nodes", "system:masters"}},
+			},
+			wantErr: "organization",
+		},
+		{
+			name:       "email SAN",
+			signerName: certificatesv1.KubeAPIServerClientKubeletSignerName,
+			username:   nodeUser,
+			usages:     clientUsages,
+			template:   &x509.CertificateRequest{Subject: nodeSubject(testNodeName), EmailAddresses: []string{"node@example.com"}},
+			wantErr:    "email and URI",
+		},
+		{
+			name:       "URI SAN",
+			signerName: certificatesv1.KubeAPIServerClientKubeletSignerName,
+			username:   nodeUser,
+			usages:     clientUsages,
+			template:   &x509.CertificateRequest{Subject: nodeSubject(testNodeName), URIs: []*url.URL{spiffe}},
+			wantErr:    "email and URI",
+		},
+		{
+			name:       "client certificate asking for server auth",
+			signerName: certificatesv1.KubeAPIServerClientKubeletSignerName,
+			username:   nodeUser,
+			usages:     []certificatesv1.KeyUsage{certificatesv1.UsageClientAuth, certificatesv1.UsageServerAuth},
+			template:   &x509.CertificateRequest{Subject: nodeSubject(testNodeName)},
+			wantErr:    "is not allowed",
+		},
+		{
+			name:       "client certificate without client auth",
+			signerName: certificatesv1.KubeAPIServerClientKubeletSignerName,
+			username:   nodeUser,
+			usages:     []certificatesv1.KeyUsage{certificatesv1.UsageDigitalSignature},
+			template:   &x509.CertificateRequest{Subject: nodeSubject(testNodeName)},
+			wantErr:    "is required",
+		},
+		{
+			name:       "client certificate with SANs",
+			signerName: certificatesv1.KubeAPIServerClientKubeletSignerName,
+			username:   nodeUser,
+			usages:     clientUsages,
+			template:   &x509.CertificateRequest{Subject: nodeSubject(testNodeName), DNSNames: []string{testNodeName}},
+			wantErr:    "cannot have SANs",
+		},
+		{
+			name:       "serving certificate without SANs",
+			signerName: certificatesv1.KubeletServingSignerName,
+			username:   nodeUser,
+			usages:     servingUsages,
+			template:   &x509.CertificateRequest{Subject: nodeSubject(testNodeName)},
+			wantErr:    "at least one SAN",
+		},
+		{
+			name:       "serving certificate for another hostname",
+			signerName: certificatesv1.KubeletServingSignerName,
+			username:   nodeUser,
+			usages:     servingUsages,
+			template:   &x509.CertificateRequest{Subject: nodeSubject(testNodeName), DNSNames: []string{"kubernetes.default"}},
+			wantErr:    "not the node hostname",
+		},
+		{
+			name:       "serving certificate for a foreign address",
+			signerName: certificatesv1.KubeletServingSignerName,
+			username:   nodeUser,
+			usages:     servingUsages,
+			template:   &x509.CertificateRequest{Subject: nodeSubject(testNodeName), IPAddresses: []net.IP{net.ParseIP("203.0.113.9")}},
+			wantErr:    "not a host address",
+		},
+	}
+
+	s := &service{nodeName: testNodeName}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			csr := newTestCSR(t, tt.signerName, tt.username, tt.usages, tt.template)
+			request, err := parseCSR(csr)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = s.validateCSR(csr, request, csrSigners[tt.signerName])
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("expected an error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestParseCSR(t *testing.T) {
+	tests := []struct {
+		name    string
+		request []byte
+		wantErr bool
+	}{
+		{name: "not PEM", request: []byte("garbage"), wantErr: true},
+		{name: "wrong PEM type", request: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte{1}}), wantErr: true},
+		{name: "invalid request", request: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: []byte{1}}), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			csr := &certificatesv1.CertificateSigningRequest{Spec: certificatesv1.CertificateSigningRequestSpec{Request: tt.request}}
+			if _, err := parseCSR(csr); (err != nil) != tt.wantErr {
+				t.Fatalf("parseCSR() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestX509KeyUsage(t *testing.T) {
+	tests := []struct {
+		name    string
+		usages  []certificatesv1.KeyUsage
+		expect  x509.KeyUsage
+		wantErr bool
+	}{
+		{
+			name:   "client usages",
+			usages: []certificatesv1.KeyUsage{certificatesv1.UsageDigitalSignature, certificatesv1.UsageClientAuth},
+			expect: x509.KeyUsageDigitalSignature,
+		},
+		{
+			name:   "serving usages",
+			usages: []certificatesv1.KeyUsage{certificatesv1.UsageDigitalSignature, certificatesv1.UsageKeyEncipherment, certificatesv1.UsageServerAuth},
+			expect: x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		},
+		{
+			name:    "unsupported usage",
+			usages:  []certificatesv1.KeyUsage{certificatesv1.UsageCertSign},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := x509KeyUsage(tt.usages)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("x509KeyUsage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.expect {
+				t.Errorf("x509KeyUsage() = %v, expected %v", got, tt.expect)
+			}
+		})
+	}
+}
+
+func TestHasCSRCondition(t *testing.T) {
+	csr := &certificatesv1.CertificateSigningRequest{
+		Status: certificatesv1.CertificateSigningRequestStatus{
+			Conditions: []certificatesv1.CertificateSigningRequestCondition{
+				{Type: certificatesv1.CertificateApproved, Status: corev1.ConditionTrue},
+				{Type: certificatesv1.CertificateFailed, Status: corev1.ConditionFalse},
+			},
+		},
+	}
+
+	if !hasCSRCondition(csr, certificatesv1.CertificateApproved) {
+		t.Error("expected the approved condition")
+	}
+	if hasCSRCondition(csr, certificatesv1.CertificateFailed) {
+		t.Error("a false condition must not count")
+	}
+	if hasCSRCondition(csr, certificatesv1.CertificateDenied) {
+		t.Error("a missing condition must not count")
+	}
+}
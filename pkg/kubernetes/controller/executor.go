@@ -63,7 +63,10 @@ func (s *service) postSetup() {
 	if err := s.checkControllerManagerHealth(); err != nil {
 		log.Error().Str("component", "controller").Msgf("controller manager health check failed: %v", err)
 		s.terminate()
+		return
 	}
+
+	go s.runCSRController()
 }
 
 func (s *service) terminate() {
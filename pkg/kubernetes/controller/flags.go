@@ -1,22 +1,72 @@
 package controller
 
 import (
+	"slices"
+	"strings"
+
 	"github.com/portainer/kubesolo/types"
 	"github.com/spf13/cobra"
 )
 
+// defaultControllers are the controllers run on every node
+var defaultControllers = []string{
+	"deployment",
+	"replicaset",
+	"service",
+	"serviceaccount",
+	"namespace",
+	"attachdetach",
+	"endpoint",
+	"daemonset",
+	"statefulset",
+	"root-ca-certificate-publisher-controller",
+	"serviceaccount-token-controller",
+	"node-ipam-controller",
+	"endpointslice-controller",
+	"garbage-collector-controller",
+	"ttl-after-finished-controller",
+	"persistentvolume-binder-controller",
+	"certificatesigningrequest-cleaner-controller",
+}
+
+// metricsAPIControllers are the controllers that read the resource metrics API, they only run when kubesolo serves it
+var metricsAPIControllers = []string{
+	"horizontal-pod-autoscaler-controller",
+}
+
+// admissionPluginControllers are the controllers an admission plugin depends on
+// without them quotas would never be recalculated, protected volumes never released and resized claims never expanded
+var admissionPluginControllers = map[string][]string{
+	"ResourceQuota":                {"resourcequota-controller"},
+	"StorageObjectInUseProtection": {"persistentvolumeclaim-protection-controller", "persistentvolume-protection-controller"},
+	"PersistentVolumeClaimResize":  {"persistentvolume-expander-controller"},
+}
+
+// controllers returns the default controllers, the controllers needed by the enabled admission plugins
+// and the controllers reading the resource metrics API when it is served
+func (s *service) controllers() string {
+	controllers := slices.Clone(defaultControllers)
+	if s.metricsAPI {
+		controllers = append(controllers, metricsAPIControllers...)
+	}
+	for _, plugin := range s.admissionPlugins {
+		controllers = append(controllers, admissionPluginControllers[plugin]...)
+	}
+	return strings.Join(controllers, ",")
+}
+
 func (s *service) configureControllerManagerFlags(command *cobra.Command) {
 	flags := command.Flags()
 	_ = flags.Set("service-account-private-key-file", s.serviceAccountKeyFile)
 	_ = flags.Set("kubeconfig", s.adminKubeconfigFile)
 	_ = flags.Set("authentication-kubeconfig", s.adminKubeconfigFile)
 	_ = flags.Set("authorization-kubeconfig", s.adminKubeconfigFile)
-	_ = flags.Set("root-ca-file", s.caFile)
-	_ = flags.Set("requestheader-client-ca-file", s.caFile)
+	_ = flags.Set("root-ca-file", s.caBundleFile)
+	_ = flags.Set("requestheader-client-ca-file", s.frontProxyCAFile)
 	_ = flags.Set("tls-cert-file", s.controllerManagerCertFile)
 	_ = flags.Set("tls-private-key-file", s.controllerManagerKeyFile)
 	_ = flags.Set("leader-elect", "false")
-	_ = flags.Set("controllers", "deployment,replicaset,service,serviceaccount,namespace,attachdetach,endpoint,daemonset,statefulset,root-ca-certificate-publisher-controller,serviceaccount-token-controller,node-ipam-controller,endpointslice-controller,garbage-collector-controller,ttl-after-finished-controller,persistentvolume-binder-controller")
+	_ = flags.Set("controllers", s.controllers())
 	_ = flags.Set("profiling", "false")
 	_ = flags.Set("use-service-account-credentials", "true")
 	_ = flags.Set("bind-address", "0.0.0.0")
@@ -36,5 +86,8 @@ func (s *service) configureControllerManagerFlags(command *cobra.Command) {
 	_ = flags.Set("unhealthy-zone-threshold", "0.7")
 	_ = flags.Set("node-monitor-period", "30s")
 	_ = flags.Set("node-monitor-grace-period", "60s")
+	if len(s.featureGates) > 0 {
+		_ = flags.Set("feature-gates", s.featureGates.String())
+	}
 	_ = flags.Set("v", "0")
 }
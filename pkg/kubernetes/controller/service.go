@@ -3,6 +3,8 @@ package controller
 import (
 	"context"
 
+	"github.com/portainer/kubesolo/internal/core/featuregates"
+	"github.com/portainer/kubesolo/internal/system"
 	"github.com/portainer/kubesolo/types"
 )
 
@@ -14,13 +16,19 @@ type service struct {
 	controllerDir             string
 	controllerManagerCertFile string
 	controllerManagerKeyFile  string
-	caFile                    string
+	frontProxyCAFile          string
+	caBundleFile              string
 	adminKubeconfigFile       string
 	serviceAccountKeyFile     string
+	nodeName                  string
+	admissionPlugins          []string
+	featureGates              featuregates.Gates
+	metricsAPI                bool
+	embedded                  types.Embedded
 }
 
 // NewService creates a new controller service
-func NewService(ctx context.Context, cancel context.CancelFunc, controllerReady chan<- struct{}, controllerDir string, embedded types.Embedded) *service {
+func NewService(ctx context.Context, cancel context.CancelFunc, controllerReady chan<- struct{}, controllerDir string, embedded types.Embedded, admissionPlugins []string, featureGates featuregates.Gates, metricsAPI bool) *service {
 	return &service{
 		ctx:                       ctx,
 		cancel:                    cancel,
@@ -28,8 +36,14 @@ func NewService(ctx context.Context, cancel context.CancelFunc, controllerReady
 		controllerDir:             controllerDir,
 		controllerManagerCertFile: embedded.ControllerManagerCerts.Cert,
 		controllerManagerKeyFile:  embedded.ControllerManagerCerts.Key,
-		caFile:                    embedded.CACerts.Cert,
-		adminKubeconfigFile:       embedded.AdminKubeconfigFile,
+		frontProxyCAFile:          embedded.FrontProxyCACerts.Cert,
+		caBundleFile:              embedded.CACerts.Bundle,
+		adminKubeconfigFile:       embedded.ComponentKubeconfigFile,
 		serviceAccountKeyFile:     embedded.ServiceAccountKeyFile,
+		nodeName:                  system.GetHostname(),
+		admissionPlugins:          admissionPlugins,
+		featureGates:              featureGates,
+		metricsAPI:                metricsAPI,
+		embedded:                  embedded,
 	}
 }
@@ -71,9 +71,7 @@ func (s *service) generateKubeletConfig() map[string]any {
 		"clusterDomain": "cluster.local",
 		"clusterDNS":    []string{types.DefaultCoreDNSIP},
 
-		"resolvConf":        "/etc/resolv.conf",
-		"tlsCertFile":       s.certFile,
-		"tlsPrivateKeyFile": s.keyFile,
+		"resolvConf": "/etc/resolv.conf",
 
 		"cgroupDriver": "systemd",
 
@@ -82,6 +80,11 @@ func (s *service) generateKubeletConfig() map[string]any {
 		"port":                           10250,
 		"streamingConnectionIdleTimeout": "1h0m0s",
 		"rotateCertificates":             true,
+		// the serving certificate is requested through a CSR approved and signed by the kubesolo CSR controller,
+		// the static certificate is served until the first request is signed, or for good if the signer never runs
+		"serverTLSBootstrap": true,
+		"tlsCertFile":        s.servingCertFile,
+		"tlsPrivateKeyFile":  s.servingKeyFile,
 
 		"registerWithTaints": []map[string]any{},
 
@@ -111,8 +114,8 @@ func (s *service) generateKubeletConfig() map[string]any {
 		"enableDebugFlagsHandler": false,
 		"maxPods":                 20,
 
-		"featureGates": map[string]bool{
+		"featureGates": s.featureGates.With(map[string]bool{
 			"RotateKubeletServerCertificate": true,
-		},
+		}),
 	}
 }
@@ -0,0 +1,122 @@
+package kubelet
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/portainer/kubesolo/internal/core/pki"
+	"github.com/portainer/kubesolo/types"
+	"k8s.io/client-go/util/certificate"
+)
+
+// testEmbedded returns the certificate paths of a node under the directory
+func testEmbedded(dir string) types.Embedded {
+	pkiDir := filepath.Join(dir, "pki")
+	return types.Embedded{
+		PKIDir:           pkiDir,
+		PKICADir:         filepath.Join(pkiDir, "ca"),
+		PKIAdminDir:      filepath.Join(pkiDir, "admin"),
+		PKIAPIServerDir:  filepath.Join(pkiDir, "apiserver"),
+		PKIControllerDir: filepath.Join(pkiDir, "controller-manager"),
+		PKIKubeletDir:    filepath.Join(pkiDir, "kubelet"),
+		PKIWebhookDir:    filepath.Join(pkiDir, "webhook"),
+		PKIFrontProxyDir: filepath.Join(pkiDir, "front-proxy"),
+		CACerts: types.CACertificatePaths{
+			Cert:   filepath.Join(pkiDir, "ca", "ca.crt"),
+			Key:    filepath.Join(pkiDir, "ca", "ca.key"),
+			Chain:  filepath.Join(pkiDir, "ca", "ca-chain.crt"),
+			Bundle: filepath.Join(pkiDir, "ca", "ca-bundle.crt"),
+		},
+		FrontProxyCACerts: types.CACertificatePaths{
+			Cert: filepath.Join(pkiDir, "front-proxy", "front-proxy-ca.crt"),
+			Key:  filepath.Join(pkiDir, "front-proxy", "front-proxy-ca.key"),
+		},
+		FrontProxyClientCerts: types.FrontProxyCertificatePaths{CertificatePaths: types.CertificatePaths{
+			Cert: filepath.Join(pkiDir, "front-proxy", "front-proxy-client.crt"),
+			Key:  filepath.Join(pkiDir, "front-proxy", "front-proxy-client.key"),
+		}},
+		KubeletCerts: types.KubeletCertificatePaths{
+			CertificatePaths: types.CertificatePaths{
+				CACert: filepath.Join(pkiDir, "ca", "ca.crt"),
+				Cert:   filepath.Join(pkiDir, "kubelet", "kubelet.crt"),
+				Key:    filepath.Join(pkiDir, "kubelet", "kubelet.key"),
+			},
+			ServingCert: filepath.Join(pkiDir, "kubelet", "kubelet-serving.crt"),
+			ServingKey:  filepath.Join(pkiDir, "kubelet", "kubelet-serving.key"),
+		},
+	}
+}
+
+// TestServingBeforeFirstCSR checks that a fresh node serves the static certificate before any serving CSR is signed
+// the kubelet loads its serving certificate from a file store in its pki directory that falls back to tlsCertFile
+func TestServingBeforeFirstCSR(t *testing.T) {
+	dir := t.TempDir()
+	embedded := testEmbedded(dir)
+	if err := pki.GenerateAllCertificates(embedded, pki.Config{RenewBeforeDays: 30, KeyAlgorithm: pki.KeyAlgorithmECDSAP256}); err != nil {
+		t.Fatalf("failed to generate certificates: %v", err)
+	}
+
+	s := NewService(t.Context(), func() {}, make(chan struct{}), &embedded, nil)
+	config := s.generateKubeletConfig()
+	if config["serverTLSBootstrap"] != true {
+		t.Fatalf("serverTLSBootstrap = %v, expected true", config["serverTLSBootstrap"])
+	}
+	certFile, _ := config["tlsCertFile"].(string)
+	keyFile, _ := config["tlsPrivateKeyFile"].(string)
+	if certFile == "" || keyFile == "" {
+		t.Fatalf("no static serving certificate configured: tlsCertFile=%q tlsPrivateKeyFile=%q", certFile, keyFile)
+	}
+
+	// the same store the kubelet server certificate manager uses, with nothing signed yet in its directory
+	kubeletPKIDir := filepath.Join(dir, "kubelet", "pki")
+	if err := os.MkdirAll(kubeletPKIDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	store, err := certificate.NewFileStore("kubelet-server", kubeletPKIDir, kubeletPKIDir, certFile, keyFile)
+	if err != nil {
+		t.Fatalf("failed to create the certificate store: %v", err)
+	}
+	serving, err := store.Current()
+	if err != nil {
+		t.Fatalf("no serving certificate before the first CSR is signed: %v", err)
+	}
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{*serving}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_ = conn.(*tls.Conn).Handshake()
+	}()
+
+	caPEM, err := os.ReadFile(embedded.CACerts.Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(caPEM)
+
+	// the API server reaches the kubelet on the node addresses and verifies it against the cluster CA
+	conn, err := tls.Dial("tcp", listener.Addr().String(), &tls.Config{RootCAs: roots, ServerName: "localhost"})
+	if err != nil {
+		t.Fatalf("TLS handshake with the static serving certificate failed: %v", err)
+	}
+	defer conn.Close()
+
+	leaf := conn.ConnectionState().PeerCertificates[0]
+	if leaf.Subject.CommonName != "system:node:"+s.nodeName {
+		t.Errorf("serving certificate common name %s, expected system:node:%s", leaf.Subject.CommonName, s.nodeName)
+	}
+	if len(leaf.IPAddresses) == 0 {
+		t.Errorf("serving certificate has no IP address SANs")
+	}
+}
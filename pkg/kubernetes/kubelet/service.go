@@ -4,6 +4,7 @@ import (
 	"context"
 
 	client "github.com/containerd/containerd/v2/client"
+	"github.com/portainer/kubesolo/internal/core/featuregates"
 	"github.com/portainer/kubesolo/internal/system"
 	"github.com/portainer/kubesolo/types"
 )
@@ -22,13 +23,17 @@ type service struct {
 	caFile                string
 	certFile              string
 	keyFile               string
+	servingCertFile       string
+	servingKeyFile        string
 	nodeName              string
 	kubeletCertPath       string
 	adminKubeconfig       string
+	featureGates          featuregates.Gates
+	embedded              *types.Embedded
 }
 
 // NewService creates a new kubelet service
-func NewService(ctx context.Context, cancel context.CancelFunc, kubeletReady chan<- struct{}, embedded *types.Embedded) *service {
+func NewService(ctx context.Context, cancel context.CancelFunc, kubeletReady chan<- struct{}, embedded *types.Embedded, featureGates featuregates.Gates) *service {
 	return &service{
 		ctx:                   ctx,
 		cancel:                cancel,
@@ -43,7 +48,11 @@ func NewService(ctx context.Context, cancel context.CancelFunc, kubeletReady cha
 		caFile:                embedded.KubeletCerts.CACert,
 		certFile:              embedded.KubeletCerts.Cert,
 		keyFile:               embedded.KubeletCerts.Key,
+		servingCertFile:       embedded.KubeletCerts.ServingCert,
+		servingKeyFile:        embedded.KubeletCerts.ServingKey,
 		nodeName:              system.GetHostname(),
 		adminKubeconfig:       embedded.AdminKubeconfigFile,
+		featureGates:          featureGates,
+		embedded:              embedded,
 	}
 }
@@ -0,0 +1,76 @@
+package kubelet
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/portainer/kubesolo/types"
+)
+
+// servingCertificateFile is where the kubelet keeps the serving certificate signed for its last CSR, under its root directory
+const servingCertificateFile = "pki/kubelet-server-current.pem"
+
+// WaitForServingCertificate waits until the serving certificate the kubelet got through a CSR only lists current host addresses
+// the kubelet requests a new certificate by itself once its node status carries the new addresses and the CSR controller signs it,
+// the certificate is checked here so a request that is never signed does not leave a stale certificate unnoticed
+// it returns nil right away while the kubelet still serves the static certificate, which kubesolo reissues itself
+func WaitForServingCertificate(ctx context.Context, kubeletDir string, addresses []net.IP, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	path := filepath.Join(kubeletDir, servingCertificateFile)
+	for {
+		cert, err := readServingCertificate(path)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if servingCertificateMatches(cert, addresses) {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("the kubelet serving certificate still lists %v after %s", cert.IPAddresses, timeout)
+		case <-time.After(types.DefaultComponentSleep):
+		}
+	}
+}
+
+// readServingCertificate reads the leaf certificate of the kubelet serving certificate and key file
+func readServingCertificate(path string) (*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type == "CERTIFICATE" {
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse the kubelet serving certificate: %v", err)
+			}
+			return cert, nil
+		}
+	}
+	return nil, fmt.Errorf("no certificate found in %s", path)
+}
+
+// servingCertificateMatches reports whether every IP address of the certificate is still a host address
+func servingCertificateMatches(cert *x509.Certificate, addresses []net.IP) bool {
+	for _, ip := range cert.IPAddresses {
+		if !slices.ContainsFunc(addresses, ip.Equal) {
+			return false
+		}
+	}
+	return true
+}
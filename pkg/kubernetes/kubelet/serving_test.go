@@ -0,0 +1,100 @@
+package kubelet
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestServingCertificateMatches(t *testing.T) {
+	addresses := []net.IP{net.ParseIP("192.168.1.20"), net.ParseIP("127.0.0.1")}
+
+	tests := []struct {
+		name     string
+		ips      []net.IP
+		expected bool
+	}{
+		{name: "current address", ips: []net.IP{net.ParseIP("192.168.1.20")}, expected: true},
+		{name: "no addresses", ips: nil, expected: true},
+		{name: "stale address", ips: []net.IP{net.ParseIP("192.168.1.10")}, expected: false},
+		{name: "current and stale address", ips: []net.IP{net.ParseIP("192.168.1.20"), net.ParseIP("192.168.1.10")}, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cert := &x509.Certificate{IPAddresses: tt.ips}
+			if got := servingCertificateMatches(cert, addresses); got != tt.expected {
+				t.Errorf("servingCertificateMatches() = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestWaitForServingCertificate(t *testing.T) {
+	addresses := []net.IP{net.ParseIP("192.168.1.20")}
+
+	t.Run("static certificate only", func(t *testing.T) {
+		if err := WaitForServingCertificate(t.Context(), t.TempDir(), addresses, time.Second); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("current certificate", func(t *testing.T) {
+		dir := t.TempDir()
+		writeServingCertificate(t, dir, net.ParseIP("192.168.1.20"))
+		if err := WaitForServingCertificate(t.Context(), dir, addresses, time.Second); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("stale certificate", func(t *testing.T) {
+		dir := t.TempDir()
+		writeServingCertificate(t, dir, net.ParseIP("192.168.1.10"))
+		if err := WaitForServingCertificate(t.Context(), dir, addresses, time.Second); err == nil {
+			t.Error("expected an error for a certificate listing a former address")
+		}
+	})
+}
+
+// writeServingCertificate writes a certificate and key file the way the kubelet certificate store does
+func writeServingCertificate(t *testing.T, kubeletDir string, ip net.IP) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "system:node:test"},
+		IPAddresses:  []net.IP{ip},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(kubeletDir, servingCertificateFile)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	data := append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})...)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
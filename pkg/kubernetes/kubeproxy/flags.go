@@ -18,4 +18,7 @@ func (s *service) configureKubeProxyFlags(command *cobra.Command) {
 	_ = flags.Set("conntrack-max-per-core", "1024")
 	_ = flags.Set("conntrack-min", "1024")
 	_ = flags.Set("min-sync-period", "10s")
+	if len(s.featureGates) > 0 {
+		_ = flags.Set("feature-gates", s.featureGates.String())
+	}
 }
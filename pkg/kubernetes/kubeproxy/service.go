@@ -1,6 +1,10 @@
 package kubeproxy
 
-import "context"
+import (
+	"context"
+
+	"github.com/portainer/kubesolo/internal/core/featuregates"
+)
 
 // service is the service for the kube proxy
 type service struct {
@@ -8,14 +12,16 @@ type service struct {
 	cancel              context.CancelFunc
 	kubeproxyReady      chan<- struct{}
 	adminKubeconfigFile string
+	featureGates        featuregates.Gates
 }
 
 // NewService creates a new kube proxy service
-func NewService(ctx context.Context, cancel context.CancelFunc, kubeproxyReady chan<- struct{}, adminKubeconfigFile string) *service {
+func NewService(ctx context.Context, cancel context.CancelFunc, kubeproxyReady chan<- struct{}, adminKubeconfigFile string, featureGates featuregates.Gates) *service {
 	return &service{
 		ctx:                 ctx,
 		cancel:              cancel,
 		kubeproxyReady:      kubeproxyReady,
 		adminKubeconfigFile: adminKubeconfigFile,
+		featureGates:        featureGates,
 	}
 }
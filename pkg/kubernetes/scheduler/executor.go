@@ -0,0 +1,118 @@
+package scheduler
+
+import (
+	"time"
+
+	kubesolokubernetes "github.com/portainer/kubesolo/internal/kubernetes"
+	"github.com/rs/zerolog/log"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+// schedulerResyncInterval is how often pending pods are retried without a change to the pods or the node,
+// a pod waiting for preempted pods to go away or for an unschedulable condition to clear is picked up by then
+const schedulerResyncInterval = 10 * time.Second
+
+// Run starts the scheduler in the following order:
+// 1. it waits for the API server to be ready
+// 2. it starts watching the pods, the node and the pod disruption budgets
+// 3. it schedules the pending pods on every change and every schedulerResyncInterval
+// 4. it stops when the context is cancelled
+func (s *service) Run(apiServerReadyCh chan struct{}) error {
+	select {
+	case <-apiServerReadyCh:
+	case <-s.ctx.Done():
+		return nil
+	}
+
+	log.Info().Str("component", "scheduler").Msg("starting scheduler...")
+
+	clientset, err := kubesolokubernetes.GetKubernetesClient(s.adminKubeconfigFile)
+	if err != nil {
+		log.Error().Str("component", "scheduler").Msgf("failed to create kubernetes client: %v...", err)
+		s.terminate()
+		return err
+	}
+
+	factory := informers.NewSharedInformerFactory(clientset, 0)
+	podInformer := factory.Core().V1().Pods()
+	nodeInformer := factory.Core().V1().Nodes()
+	pdbInformer := factory.Policy().V1().PodDisruptionBudgets()
+
+	// changes are coalesced, a burst of pod events results in a single scheduling pass
+	trigger := make(chan struct{}, 1)
+	notify := func() {
+		select {
+		case trigger <- struct{}{}:
+		default:
+		}
+	}
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(any) { notify() },
+		UpdateFunc: func(_, _ any) { notify() },
+		DeleteFunc: func(any) { notify() },
+	}
+	// the disruption budgets are only read when preempting, a change to them does not need a scheduling pass
+	pdbInformer.Informer()
+	for _, informer := range []cache.SharedIndexInformer{podInformer.Informer(), nodeInformer.Informer()} {
+		if _, err := informer.AddEventHandler(handler); err != nil {
+			log.Error().Str("component", "scheduler").Msgf("failed to watch pods and nodes: %v...", err)
+			s.terminate()
+			return err
+		}
+	}
+
+	factory.Start(s.ctx.Done())
+	defer factory.Shutdown()
+	factory.WaitForCacheSync(s.ctx.Done())
+
+	log.Info().Str("component", "scheduler").Msgf("scheduler started for node %s...", s.nodeName)
+	close(s.schedulerReady)
+
+	ticker := time.NewTicker(schedulerResyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			log.Info().Str("component", "scheduler").Msg("stopping scheduler...")
+			return nil
+		case <-trigger:
+		case <-ticker.C:
+		}
+
+		node, err := nodeInformer.Lister().Get(s.nodeName)
+		if err != nil {
+			log.Debug().Str("component", "scheduler").Msgf("node %s is not registered yet: %v", s.nodeName, err)
+			continue
+		}
+		pods, err := podInformer.Lister().List(everything)
+		if err != nil {
+			log.Error().Str("component", "scheduler").Msgf("failed to list pods: %v", err)
+			continue
+		}
+
+		pdbs, err := pdbInformer.Lister().List(everything)
+		if err != nil {
+			log.Error().Str("component", "scheduler").Msgf("failed to list pod disruption budgets: %v", err)
+			continue
+		}
+
+		s.schedulePending(clientset, node.DeepCopy(), copyPods(pods), pdbs)
+	}
+}
+
+// copyPods copies the pods of the informer cache, they must not be modified in place
+func copyPods(pods []*corev1.Pod) []corev1.Pod {
+	copies := make([]corev1.Pod, 0, len(pods))
+	for _, pod := range pods {
+		copies = append(copies, *pod.DeepCopy())
+	}
+	return copies
+}
+
+func (s *service) terminate() {
+	log.Info().Str("component", "scheduler").Msg("terminating scheduler...")
+	s.cancel()
+}
@@ -0,0 +1,98 @@
+package scheduler
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	resourcehelper "k8s.io/component-helpers/resource"
+	corev1helpers "k8s.io/component-helpers/scheduling/corev1"
+	"k8s.io/component-helpers/scheduling/corev1/nodeaffinity"
+)
+
+// SchedulingReasons returns the reasons the node cannot run the pod regardless of its capacity
+// it checks the node selector, the required node affinity and the taints of the node
+func SchedulingReasons(pod *corev1.Pod, node *corev1.Node) []string {
+	reasons := []string{}
+
+	if matches, err := nodeaffinity.GetRequiredNodeAffinity(pod).Match(node); err != nil {
+		reasons = append(reasons, fmt.Sprintf("invalid node affinity: %v", err))
+	} else if !matches {
+		mismatched := []string{}
+		for _, key := range slices.Sorted(maps.Keys(pod.Spec.NodeSelector)) {
+			if node.Labels[key] != pod.Spec.NodeSelector[key] {
+				mismatched = append(mismatched, key+"="+pod.Spec.NodeSelector[key])
+			}
+		}
+		if len(mismatched) > 0 {
+			reasons = append(reasons, fmt.Sprintf("the node does not have the labels %s of the nodeSelector, remove them from the pod or label the node with kubectl label node %s %s",
+				strings.Join(mismatched, ","), node.Name, strings.Join(mismatched, " ")))
+		} else {
+			reasons = append(reasons, "the node does not match the required node affinity of the pod, relax the affinity or label the node")
+		}
+	}
+
+	taint, untolerated := corev1helpers.FindMatchingUntoleratedTaint(node.Spec.Taints, pod.Spec.Tolerations, func(t *corev1.Taint) bool {
+		return t.Effect == corev1.TaintEffectNoSchedule || t.Effect == corev1.TaintEffectNoExecute
+	})
+	if untolerated {
+		reasons = append(reasons, fmt.Sprintf("the node has the taint %s which the pod does not tolerate, add a toleration to the pod or remove the taint with kubectl taint node %s %s-",
+			taint.ToString(), node.Name, taint.ToString()))
+	}
+
+	return reasons
+}
+
+// CapacityReasons checks the requests of the pod against the allocatable resources of the node left by its other pods
+// finished pods do not hold resources, terminating pods do until they are gone
+func CapacityReasons(pod *corev1.Pod, node *corev1.Node, nodePods []corev1.Pod) []string {
+	reasons := []string{}
+
+	used := corev1.ResourceList{}
+	running := 0
+	for i := range nodePods {
+		existing := &nodePods[i]
+		if existing.Status.Phase == corev1.PodSucceeded || existing.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		running++
+		for name, quantity := range resourcehelper.PodRequests(existing, resourcehelper.PodResourcesOptions{}) {
+			total := used[name]
+			total.Add(quantity)
+			used[name] = total
+		}
+	}
+
+	if maxPods, ok := node.Status.Allocatable[corev1.ResourcePods]; ok && int64(running) >= maxPods.Value() {
+		reasons = append(reasons, fmt.Sprintf("the node already runs %d pods, the most it allows, delete unused pods first", running))
+	}
+
+	requests := resourcehelper.PodRequests(pod, resourcehelper.PodResourcesOptions{})
+	for _, name := range slices.Sorted(maps.Keys(requests)) {
+		requested := requests[name]
+		if requested.IsZero() {
+			continue
+		}
+
+		allocatable, ok := node.Status.Allocatable[name]
+		if !ok {
+			reasons = append(reasons, fmt.Sprintf("the pod requests %s %s but the node does not provide %s", requested.String(), name, name))
+			continue
+		}
+
+		free := allocatable.DeepCopy()
+		free.Sub(used[name])
+		if requested.Cmp(free) > 0 {
+			if free.Sign() < 0 {
+				free = resource.Quantity{}
+			}
+			reasons = append(reasons, fmt.Sprintf("the pod requests %s %s but only %s of the %s allocatable are free, lower the requests of the pod or remove other workloads",
+				requested.String(), name, free.String(), allocatable.String()))
+		}
+	}
+
+	return reasons
+}
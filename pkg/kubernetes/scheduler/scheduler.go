@@ -0,0 +1,284 @@
+package scheduler
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/portainer/kubesolo/types"
+	"github.com/rs/zerolog/log"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	corev1helpers "k8s.io/component-helpers/scheduling/corev1"
+)
+
+// everything selects all the objects of an informer cache
+var everything = labels.Everything()
+
+// schedulePending binds the pending pods that fit on the node, highest priority first
+// a pod that does not fit preempts pods of a lower priority when that frees enough resources,
+// otherwise it is marked unschedulable with the reasons and retried on the next pass
+func (s *service) schedulePending(clientset *kubernetes.Clientset, node *corev1.Node, pods []corev1.Pod, pdbs []*policyv1.PodDisruptionBudget) {
+	bound := []corev1.Pod{}
+	pending := []*corev1.Pod{}
+	for i := range pods {
+		pod := &pods[i]
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		if pod.Spec.NodeName == s.nodeName {
+			bound = append(bound, *pod)
+		} else if pod.Spec.NodeName == "" && pod.DeletionTimestamp == nil && IsScheduledByKubeSolo(pod) {
+			pending = append(pending, pod)
+		}
+	}
+
+	slices.SortStableFunc(pending, func(a, b *corev1.Pod) int {
+		if pa, pb := corev1helpers.PodPriority(a), corev1helpers.PodPriority(b); pa != pb {
+			return cmp.Compare(pb, pa)
+		}
+		return a.CreationTimestamp.Compare(b.CreationTimestamp.Time)
+	})
+
+	scheduled := map[k8stypes.UID]bool{}
+	for _, pod := range pending {
+		if reasons := SchedulingReasons(pod, node); len(reasons) > 0 {
+			s.markUnschedulable(clientset, pod, "", reasons)
+			continue
+		}
+
+		// the resources freed for a nominated pod of at least the same priority are kept for it
+		reserved := slices.Clone(bound)
+		for _, other := range pending {
+			if other != pod && !scheduled[other.UID] && other.Status.NominatedNodeName == s.nodeName &&
+				corev1helpers.PodPriority(other) >= corev1helpers.PodPriority(pod) {
+				reserved = append(reserved, *other)
+			}
+		}
+
+		reasons := CapacityReasons(pod, node, reserved)
+		if len(reasons) == 0 {
+			if err := s.bind(clientset, pod); err != nil {
+				log.Error().Str("component", "scheduler").Str("pod", pod.Name).Str("namespace", pod.Namespace).Msgf("failed to bind pod: %v", err)
+				continue
+			}
+			pod.Spec.NodeName = s.nodeName
+			bound = append(bound, *pod)
+			scheduled[pod.UID] = true
+			continue
+		}
+
+		if pod.Status.NominatedNodeName == s.nodeName && hasTerminatingPods(bound) {
+			log.Debug().Str("component", "scheduler").Str("pod", pod.Name).Str("namespace", pod.Namespace).Msg("waiting for preempted pods to terminate")
+			continue
+		}
+		if victims := selectVictims(pod, node, reserved, pdbs); len(victims) > 0 {
+			s.preempt(clientset, pod, victims)
+			continue
+		}
+		s.markUnschedulable(clientset, pod, "", reasons)
+	}
+}
+
+// IsScheduledByKubeSolo reports whether the pod asks for the default scheduler, pods for other schedulers are left to them
+func IsScheduledByKubeSolo(pod *corev1.Pod) bool {
+	return pod.Spec.SchedulerName == "" || pod.Spec.SchedulerName == corev1.DefaultSchedulerName
+}
+
+// hasTerminatingPods reports whether any of the pods is being deleted
+func hasTerminatingPods(pods []corev1.Pod) bool {
+	return slices.ContainsFunc(pods, func(pod corev1.Pod) bool {
+		return pod.DeletionTimestamp != nil
+	})
+}
+
+// selectVictims returns the pods of a lower priority to delete so the pod fits, nil when preemption cannot make it fit
+// like kube-scheduler every lower priority pod is removed first, then as many as possible are reprieved,
+// those whose eviction would exceed a PodDisruptionBudget first, each group highest priority and oldest first,
+// so the lowest priority and most recently created pods are the ones deleted
+// mirror pods are never picked, deleting them does not stop the static pods of the kubelet
+func selectVictims(pod *corev1.Pod, node *corev1.Node, reserved []corev1.Pod, pdbs []*policyv1.PodDisruptionBudget) []corev1.Pod {
+	if pod.Spec.PreemptionPolicy != nil && *pod.Spec.PreemptionPolicy == corev1.PreemptNever {
+		return nil
+	}
+
+	priority := corev1helpers.PodPriority(pod)
+	remaining := []corev1.Pod{}
+	candidates := []corev1.Pod{}
+	for _, other := range reserved {
+		_, mirror := other.Annotations[corev1.MirrorPodAnnotationKey]
+		if other.Spec.NodeName == node.Name && other.DeletionTimestamp == nil && !mirror && corev1helpers.PodPriority(&other) < priority {
+			candidates = append(candidates, other)
+		} else {
+			remaining = append(remaining, other)
+		}
+	}
+	if len(candidates) == 0 || len(CapacityReasons(pod, node, remaining)) > 0 {
+		return nil
+	}
+
+	slices.SortStableFunc(candidates, func(a, b corev1.Pod) int {
+		if pa, pb := corev1helpers.PodPriority(&a), corev1helpers.PodPriority(&b); pa != pb {
+			return cmp.Compare(pb, pa)
+		}
+		return a.CreationTimestamp.Compare(b.CreationTimestamp.Time)
+	})
+	violating, nonViolating := splitByPDBViolation(candidates, pdbs)
+
+	victims := []corev1.Pod{}
+	for _, candidate := range append(violating, nonViolating...) {
+		if len(CapacityReasons(pod, node, append(slices.Clone(remaining), candidate))) == 0 {
+			remaining = append(remaining, candidate)
+			continue
+		}
+		victims = append(victims, candidate)
+	}
+	return victims
+}
+
+// splitByPDBViolation splits the pods, in order, into those whose eviction would exceed the disruptions allowed by a
+// PodDisruptionBudget and the others, the pods are counted as evicted one after the other like kube-scheduler does
+// pods the budget already counts as disrupted do not use up its allowance
+func splitByPDBViolation(pods []corev1.Pod, pdbs []*policyv1.PodDisruptionBudget) ([]corev1.Pod, []corev1.Pod) {
+	allowed := make([]int32, len(pdbs))
+	selectors := make([]labels.Selector, len(pdbs))
+	for i, pdb := range pdbs {
+		allowed[i] = pdb.Status.DisruptionsAllowed
+		selector, err := metav1.LabelSelectorAsSelector(pdb.Spec.Selector)
+		if err != nil {
+			log.Warn().Str("component", "scheduler").Str("pdb", pdb.Name).Str("namespace", pdb.Namespace).Msgf("ignoring PodDisruptionBudget with an invalid selector: %v", err)
+			selector = labels.Nothing()
+		}
+		selectors[i] = selector
+	}
+
+	violating := []corev1.Pod{}
+	nonViolating := []corev1.Pod{}
+	for _, pod := range pods {
+		violates := false
+		for i, pdb := range pdbs {
+			// like kube-scheduler a budget without a selector protects no pod here
+			if pdb.Namespace != pod.Namespace || selectors[i].Empty() || !selectors[i].Matches(labels.Set(pod.Labels)) {
+				continue
+			}
+			if _, disrupted := pdb.Status.DisruptedPods[pod.Name]; disrupted {
+				continue
+			}
+			allowed[i]--
+			if allowed[i] < 0 {
+				violates = true
+			}
+		}
+		if violates {
+			violating = append(violating, pod)
+		} else {
+			nonViolating = append(nonViolating, pod)
+		}
+	}
+	return violating, nonViolating
+}
+
+// preempt deletes the victims and nominates the node for the pod, it is bound once the victims are gone
+func (s *service) preempt(clientset *kubernetes.Clientset, pod *corev1.Pod, victims []corev1.Pod) {
+	names := []string{}
+	for _, victim := range victims {
+		ctx, cancel := context.WithTimeout(s.ctx, types.DefaultContextTimeout)
+		err := clientset.CoreV1().Pods(victim.Namespace).Delete(ctx, victim.Name, metav1.DeleteOptions{})
+		cancel()
+		if err != nil {
+			log.Error().Str("component", "scheduler").Str("pod", victim.Name).Str("namespace", victim.Namespace).Msgf("failed to preempt pod: %v", err)
+			return
+		}
+		names = append(names, victim.Namespace+"/"+victim.Name)
+	}
+
+	log.Info().Str("component", "scheduler").
+		Str("pod", pod.Name).
+		Str("namespace", pod.Namespace).
+		Msgf("preempted %s to make room for the pod", strings.Join(names, ", "))
+
+	s.markUnschedulable(clientset, pod, s.nodeName, []string{fmt.Sprintf("preempting lower priority pods %s", strings.Join(names, ", "))})
+}
+
+// bind binds the pod to the node of the scheduler
+func (s *service) bind(clientset *kubernetes.Clientset, pod *corev1.Pod) error {
+	ctx, cancel := context.WithTimeout(s.ctx, types.DefaultContextTimeout)
+	defer cancel()
+
+	if err := Bind(ctx, clientset, pod, s.nodeName); err != nil {
+		return err
+	}
+
+	log.Info().Str("component", "scheduler").Str("pod", pod.Name).Str("namespace", pod.Namespace).Msgf("bound pod to node %s", s.nodeName)
+	return nil
+}
+
+// Bind binds the pod to the node through the Binding API, the API server marks it scheduled
+// the pod UID is part of the binding so a pod recreated with the same name is not bound by mistake
+func Bind(ctx context.Context, clientset kubernetes.Interface, pod *corev1.Pod, nodeName string) error {
+	return clientset.CoreV1().Pods(pod.Namespace).Bind(ctx, &corev1.Binding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pod.Name,
+			Namespace: pod.Namespace,
+			UID:       pod.UID,
+		},
+		Target: corev1.ObjectReference{
+			Kind: "Node",
+			Name: nodeName,
+		},
+	}, metav1.CreateOptions{})
+}
+
+// markUnschedulable sets the PodScheduled condition of the pod to false with the reasons, as kubectl describe shows them
+func (s *service) markUnschedulable(clientset *kubernetes.Clientset, pod *corev1.Pod, nominatedNodeName string, reasons []string) {
+	ctx, cancel := context.WithTimeout(s.ctx, types.DefaultContextTimeout)
+	defer cancel()
+
+	message, err := MarkUnschedulable(ctx, clientset, pod, nominatedNodeName, reasons)
+	if err != nil {
+		log.Error().Str("component", "scheduler").Str("pod", pod.Name).Str("namespace", pod.Namespace).Msgf("failed to update pod status: %v", err)
+		return
+	}
+	if message != "" {
+		log.Info().Str("component", "scheduler").Str("pod", pod.Name).Str("namespace", pod.Namespace).Msg(message)
+	}
+}
+
+// MarkUnschedulable sets the PodScheduled condition of the pod to false with the reason Unschedulable and the reasons as message
+// the status is only written when the condition or the nominated node changes, it returns the message when it was written
+func MarkUnschedulable(ctx context.Context, clientset kubernetes.Interface, pod *corev1.Pod, nominatedNodeName string, reasons []string) (string, error) {
+	message := fmt.Sprintf("0/1 nodes are available: %s", strings.Join(reasons, "; "))
+	condition := corev1.PodCondition{
+		Type:               corev1.PodScheduled,
+		Status:             corev1.ConditionFalse,
+		Reason:             corev1.PodReasonUnschedulable,
+		Message:            message,
+		LastTransitionTime: metav1.Now(),
+	}
+
+	index := slices.IndexFunc(pod.Status.Conditions, func(c corev1.PodCondition) bool {
+		return c.Type == corev1.PodScheduled
+	})
+	if index >= 0 {
+		existing := pod.Status.Conditions[index]
+		if existing.Status == condition.Status && existing.Reason == condition.Reason && existing.Message == condition.Message &&
+			pod.Status.NominatedNodeName == nominatedNodeName {
+			return "", nil
+		}
+		pod.Status.Conditions[index] = condition
+	} else {
+		pod.Status.Conditions = append(pod.Status.Conditions, condition)
+	}
+	pod.Status.NominatedNodeName = nominatedNodeName
+
+	if _, err := clientset.CoreV1().Pods(pod.Namespace).UpdateStatus(ctx, pod, metav1.UpdateOptions{}); err != nil {
+		return "", err
+	}
+	return message, nil
+}
@@ -0,0 +1,396 @@
+package scheduler
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const testNodeName = "edge-01"
+
+// testNode returns a node with the CPU and pods it can allocate
+func testNode(cpu string, pods int64) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: testNodeName, Labels: map[string]string{"zone": "factory"}},
+		Status: corev1.NodeStatus{
+			Allocatable: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse(cpu),
+				corev1.ResourceMemory: resource.MustParse("4Gi"),
+				corev1.ResourcePods:   *resource.NewQuantity(pods, resource.DecimalSI),
+			},
+		},
+	}
+}
+
+// testPod returns a pod of the default namespace requesting the CPU with the priority, created age ago
+func testPod(name, cpu string, priority int32, age time.Duration) corev1.Pod {
+	return corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         "default",
+			UID:               k8stypes.UID(name),
+			Labels:            map[string]string{"app": name},
+			CreationTimestamp: metav1.NewTime(time.Now().Add(-age)),
+		},
+		Spec: corev1.PodSpec{
+			NodeName: testNodeName,
+			Priority: &priority,
+			Containers: []corev1.Container{{
+				Name: "main",
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse(cpu)},
+				},
+			}},
+		},
+	}
+}
+
+// pending returns the pod without a node
+func pending(pod corev1.Pod) *corev1.Pod {
+	pod.Spec.NodeName = ""
+	return &pod
+}
+
+// testPDB returns a budget of the default namespace selecting the app that allows the disruptions
+func testPDB(app string, allowed int32) *policyv1.PodDisruptionBudget {
+	minAvailable := intstr.FromInt32(1)
+	return &policyv1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{Name: app, Namespace: "default"},
+		Spec: policyv1.PodDisruptionBudgetSpec{
+			MinAvailable: &minAvailable,
+			Selector:     &metav1.LabelSelector{MatchLabels: map[string]string{"app": app}},
+		},
+		Status: policyv1.PodDisruptionBudgetStatus{DisruptionsAllowed: allowed},
+	}
+}
+
+// podNames returns the names of the pods in order
+func podNames(pods []corev1.Pod) []string {
+	names := []string{}
+	for _, pod := range pods {
+		names = append(names, pod.Name)
+	}
+	return names
+}
+
+func TestSchedulingReasons(t *testing.T) {
+	tests := []struct {
+		name   string
+		pod    func(*corev1.Pod)
+		node   func(*corev1.Node)
+		expect []string
+	}{
+		{name: "fits", expect: []string{}},
+		{
+			name:   "matching node selector",
+			pod:    func(pod *corev1.Pod) { pod.Spec.NodeSelector = map[string]string{"zone": "factory"} },
+			expect: []string{},
+		},
+		{
+			name:   "mismatched node selector",
+			pod:    func(pod *corev1.Pod) { pod.Spec.NodeSelector = map[string]string{"zone": "office", "gpu": "true"} },
+			expect: []string{"labels gpu=true,zone=office of the nodeSelector"},
+		},
+		{
+			name: "mismatched node affinity",
+			pod: func(pod *corev1.Pod) {
+				pod.Spec.Affinity = &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+					RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+						NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+							MatchExpressions: []corev1.NodeSelectorRequirement{{Key: "zone", Operator: corev1.NodeSelectorOpIn, Values: []string{"office"}}},
+						}},
+					},
+				}}
+			},
+			expect: []string{"required node affinity"},
+		},
+		{
+			name: "untolerated taint",
+			node: func(node *corev1.Node) {
+				node.Spec.Taints = []corev1.Taint{{Key: "dedicated", Value: "db", Effect: corev1.TaintEffectNoSchedule}}
+			},
+			expect: []string{"taint dedicated=db:NoSchedule"},
+		},
+		{
+			name: "tolerated taint",
+			pod: func(pod *corev1.Pod) {
+				pod.Spec.Tolerations = []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "db", Effect: corev1.TaintEffectNoSchedule}}
+			},
+			node: func(node *corev1.Node) {
+				node.Spec.Taints = []corev1.Taint{{Key: "dedicated", Value: "db", Effect: corev1.TaintEffectNoSchedule}}
+			},
+			expect: []string{},
+		},
+		{
+			name: "prefer no schedule taint",
+			node: func(node *corev1.Node) {
+				node.Spec.Taints = []corev1.Taint{{Key: "dedicated", Value: "db", Effect: corev1.TaintEffectPreferNoSchedule}}
+			},
+			expect: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := pending(testPod("web", "100m", 0, 0))
+			node := testNode("2", 110)
+			if tt.pod != nil {
+				tt.pod(pod)
+			}
+			if tt.node != nil {
+				tt.node(node)
+			}
+
+			reasons := SchedulingReasons(pod, node)
+			if len(reasons) != len(tt.expect) {
+				t.Fatalf("SchedulingReasons() = %v, expected %d reasons", reasons, len(tt.expect))
+			}
+			for i, expect := range tt.expect {
+				if !strings.Contains(reasons[i], expect) {
+					t.Errorf("reason %q does not contain %q", reasons[i], expect)
+				}
+			}
+		})
+	}
+}
+
+func TestCapacityReasons(t *testing.T) {
+	finished := testPod("job", "1500m", 0, time.Hour)
+	finished.Status.Phase = corev1.PodSucceeded
+
+	tests := []struct {
+		name     string
+		pod      *corev1.Pod
+		node     *corev1.Node
+		nodePods []corev1.Pod
+		expect   []string
+	}{
+		{name: "empty node", pod: pending(testPod("web", "1", 0, 0)), node: testNode("2", 110), expect: []string{}},
+		{
+			name:     "enough free CPU",
+			pod:      pending(testPod("web", "1", 0, 0)),
+			node:     testNode("2", 110),
+			nodePods: []corev1.Pod{testPod("db", "1", 0, time.Hour)},
+			expect:   []string{},
+		},
+		{
+			name:     "not enough free CPU",
+			pod:      pending(testPod("web", "1", 0, 0)),
+			node:     testNode("2", 110),
+			nodePods: []corev1.Pod{testPod("db", "1500m", 0, time.Hour)},
+			expect:   []string{"only 500m of the 2 allocatable are free"},
+		},
+		{
+			name:     "finished pods hold no resources",
+			pod:      pending(testPod("web", "1", 0, 0)),
+			node:     testNode("2", 110),
+			nodePods: []corev1.Pod{finished},
+			expect:   []string{},
+		},
+		{
+			name:     "pod limit reached",
+			pod:      pending(testPod("web", "100m", 0, 0)),
+			node:     testNode("2", 1),
+			nodePods: []corev1.Pod{testPod("db", "100m", 0, time.Hour)},
+			expect:   []string{"already runs 1 pods"},
+		},
+		{
+			name: "resource the node does not provide",
+			pod: func() *corev1.Pod {
+				pod := pending(testPod("web", "100m", 0, 0))
+				pod.Spec.Containers[0].Resources.Requests["nvidia.com/gpu"] = resource.MustParse("1")
+				return pod
+			}(),
+			node:   testNode("2", 110),
+			expect: []string{"the node does not provide nvidia.com/gpu"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reasons := CapacityReasons(tt.pod, tt.node, tt.nodePods)
+			if len(reasons) != len(tt.expect) {
+				t.Fatalf("CapacityReasons() = %v, expected %d reasons", reasons, len(tt.expect))
+			}
+			for i, expect := range tt.expect {
+				if !strings.Contains(reasons[i], expect) {
+					t.Errorf("reason %q does not contain %q", reasons[i], expect)
+				}
+			}
+		})
+	}
+}
+
+func TestSelectVictims(t *testing.T) {
+	never := corev1.PreemptNever
+	mirror := testPod("static", "1", 0, time.Hour)
+	mirror.Annotations = map[string]string{corev1.MirrorPodAnnotationKey: "hash"}
+	terminating := testPod("terminating", "1", 0, time.Hour)
+	terminating.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+
+	tests := []struct {
+		name     string
+		pod      *corev1.Pod
+		nodePods []corev1.Pod
+		pdbs     []*policyv1.PodDisruptionBudget
+		expect   []string
+	}{
+		{
+			name:     "lowest priority pod first",
+			pod:      pending(testPod("critical", "1", 1000, 0)),
+			nodePods: []corev1.Pod{testPod("low", "1", 10, time.Hour), testPod("lowest", "1", 0, time.Hour)},
+			expect:   []string{"lowest"},
+		},
+		{
+			name:     "priorities spanning the int32 range",
+			pod:      pending(testPod("critical", "1", 2000001000, 0)),
+			nodePods: []corev1.Pod{testPod("negative", "1", -2000000000, time.Hour), testPod("high", "1", 2000000000, time.Hour)},
+			expect:   []string{"negative"},
+		},
+		{
+			name:     "most recent pod of the same priority first",
+			pod:      pending(testPod("critical", "1", 1000, 0)),
+			nodePods: []corev1.Pod{testPod("old", "1", 0, 2*time.Hour), testPod("new", "1", 0, time.Hour)},
+			expect:   []string{"new"},
+		},
+		{
+			name:     "several victims",
+			pod:      pending(testPod("critical", "2", 1000, 0)),
+			nodePods: []corev1.Pod{testPod("a", "1", 0, time.Hour), testPod("b", "1", 0, 2*time.Hour)},
+			expect:   []string{"b", "a"},
+		},
+		{
+			name:     "victims not needed are spared",
+			pod:      pending(testPod("critical", "1500m", 1000, 0)),
+			nodePods: []corev1.Pod{testPod("small", "500m", 0, time.Hour), testPod("large", "1500m", 10, time.Hour)},
+			expect:   []string{"large"},
+		},
+		{
+			name:     "pods of the same or a higher priority are kept",
+			pod:      pending(testPod("critical", "1", 100, 0)),
+			nodePods: []corev1.Pod{testPod("peer", "1", 100, time.Hour), testPod("higher", "1", 200, time.Hour)},
+			expect:   nil,
+		},
+		{
+			name:     "preemption cannot free enough",
+			pod:      pending(testPod("critical", "3", 1000, 0)),
+			nodePods: []corev1.Pod{testPod("low", "1", 0, time.Hour), testPod("higher", "1", 2000, time.Hour)},
+			expect:   nil,
+		},
+		{
+			name: "preemption policy never",
+			pod: func() *corev1.Pod {
+				pod := pending(testPod("critical", "1", 1000, 0))
+				pod.Spec.PreemptionPolicy = &never
+				return pod
+			}(),
+			nodePods: []corev1.Pod{testPod("low", "2", 0, time.Hour)},
+			expect:   nil,
+		},
+		{
+			name:     "mirror pods are never picked",
+			pod:      pending(testPod("critical", "1", 1000, 0)),
+			nodePods: []corev1.Pod{mirror, testPod("low", "1", 10, time.Hour)},
+			expect:   []string{"low"},
+		},
+		{
+			name:     "mirror pods alone cannot make room",
+			pod:      pending(testPod("critical", "1", 1000, 0)),
+			nodePods: []corev1.Pod{mirror, testPod("higher", "1", 2000, time.Hour)},
+			expect:   nil,
+		},
+		{
+			name:     "terminating pods are not picked again",
+			pod:      pending(testPod("critical", "1", 1000, 0)),
+			nodePods: []corev1.Pod{terminating, testPod("low", "1", 10, time.Hour)},
+			expect:   []string{"low"},
+		},
+		{
+			name:     "pods protected by a budget are picked last",
+			pod:      pending(testPod("critical", "1", 1000, 0)),
+			nodePods: []corev1.Pod{testPod("protected", "1", 0, time.Hour), testPod("unprotected", "1", 10, time.Hour)},
+			pdbs:     []*policyv1.PodDisruptionBudget{testPDB("protected", 0)},
+			expect:   []string{"unprotected"},
+		},
+		{
+			name:     "a budget allowing disruptions does not protect",
+			pod:      pending(testPod("critical", "1", 1000, 0)),
+			nodePods: []corev1.Pod{testPod("covered", "1", 0, time.Hour), testPod("other", "1", 10, time.Hour)},
+			pdbs:     []*policyv1.PodDisruptionBudget{testPDB("covered", 1)},
+			expect:   []string{"covered"},
+		},
+		{
+			name:     "a protected pod is picked when nothing else makes room",
+			pod:      pending(testPod("critical", "2", 1000, 0)),
+			nodePods: []corev1.Pod{testPod("protected", "1", 0, time.Hour), testPod("unprotected", "1", 10, time.Hour)},
+			pdbs:     []*policyv1.PodDisruptionBudget{testPDB("protected", 0)},
+			expect:   []string{"protected", "unprotected"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			victims := selectVictims(tt.pod, testNode("2", 110), tt.nodePods, tt.pdbs)
+			if tt.expect == nil {
+				if victims != nil {
+					t.Fatalf("selectVictims() = %v, expected no preemption", podNames(victims))
+				}
+				return
+			}
+			if got := podNames(victims); !slices.Equal(got, tt.expect) {
+				t.Fatalf("selectVictims() = %v, expected %v", got, tt.expect)
+			}
+		})
+	}
+}
+
+func TestSplitByPDBViolation(t *testing.T) {
+	web1 := testPod("web-1", "100m", 0, time.Hour)
+	web2 := testPod("web-2", "100m", 0, time.Hour)
+	for _, pod := range []*corev1.Pod{&web1, &web2} {
+		pod.Labels = map[string]string{"app": "web"}
+	}
+	other := testPod("other", "100m", 0, time.Hour)
+	elsewhere := testPod("elsewhere", "100m", 0, time.Hour)
+	elsewhere.Namespace = "apps"
+	elsewhere.Labels = map[string]string{"app": "web"}
+
+	disrupted := testPDB("web", 0)
+	disrupted.Status.DisruptedPods = map[string]metav1.Time{"web-1": metav1.Now()}
+	noSelector := testPDB("web", 0)
+	noSelector.Spec.Selector = &metav1.LabelSelector{}
+
+	tests := []struct {
+		name      string
+		pods      []corev1.Pod
+		pdbs      []*policyv1.PodDisruptionBudget
+		violating []string
+	}{
+		{name: "no budgets", pods: []corev1.Pod{web1, web2}, violating: []string{}},
+		{name: "budget allowing one disruption", pods: []corev1.Pod{web1, web2, other}, pdbs: []*policyv1.PodDisruptionBudget{testPDB("web", 1)}, violating: []string{"web-2"}},
+		{name: "budget allowing no disruption", pods: []corev1.Pod{web1, web2, other}, pdbs: []*policyv1.PodDisruptionBudget{testPDB("web", 0)}, violating: []string{"web-1", "web-2"}},
+		{name: "pods already disrupted", pods: []corev1.Pod{web1, web2}, pdbs: []*policyv1.PodDisruptionBudget{disrupted}, violating: []string{"web-2"}},
+		{name: "budget of another namespace", pods: []corev1.Pod{elsewhere}, pdbs: []*policyv1.PodDisruptionBudget{testPDB("web", 0)}, violating: []string{}},
+		{name: "budget without a selector", pods: []corev1.Pod{web1}, pdbs: []*policyv1.PodDisruptionBudget{noSelector}, violating: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violating, nonViolating := splitByPDBViolation(tt.pods, tt.pdbs)
+			if got := podNames(violating); !slices.Equal(got, tt.violating) {
+				t.Errorf("violating = %v, expected %v", got, tt.violating)
+			}
+			if len(violating)+len(nonViolating) != len(tt.pods) {
+				t.Errorf("split %d pods into %d and %d", len(tt.pods), len(violating), len(nonViolating))
+			}
+		})
+	}
+}
@@ -0,0 +1,23 @@
+package scheduler
+
+import "context"
+
+// service is the service for the built-in scheduler
+type service struct {
+	ctx                 context.Context
+	cancel              context.CancelFunc
+	schedulerReady      chan<- struct{}
+	nodeName            string
+	adminKubeconfigFile string
+}
+
+// NewService creates a new scheduler service
+func NewService(ctx context.Context, cancel context.CancelFunc, schedulerReady chan<- struct{}, nodeName, adminKubeconfigFile string) *service {
+	return &service{
+		ctx:                 ctx,
+		cancel:              cancel,
+		schedulerReady:      schedulerReady,
+		nodeName:            nodeName,
+		adminKubeconfigFile: adminKubeconfigFile,
+	}
+}
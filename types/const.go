@@ -5,9 +5,11 @@ import "time"
 const (
 	DefaultNodeName                       = "kubesolo-node"
 	DefaultWebhookName                    = "webhook.kubesolo.io"
+	DefaultValidatingWebhookName          = "validate.webhook.kubesolo.io"
 	DefaultSystemCNIDir                   = "/opt/cni"
 	DefaultEmbeddedCNIDir                 = "bin/cni"
 	DefaultWebhookPort                    = 10443
+	DefaultMetricsPort                    = 10444
 	DefaultPKIDir                         = "pki"
 	DefaultContainerdDir                  = "containerd"
 	DefaultContainerdSocket               = "containerd.sock"
@@ -20,6 +22,7 @@ const (
 	DefaultK8sNamespace                   = "k8s.io"
 	DefaultKubeletDir                     = "kubelet"
 	DefaultAPIServerDir                   = "apiserver"
+	DefaultAuditDir                       = "audit"
 	DefaultAPIServerAddress               = "https://127.0.0.1:6443"
 	DefaultKineEndpoint                   = "127.0.0.1:2379"
 	DefaultPodCIDR                        = "10.42.0.0/16"
@@ -35,7 +38,16 @@ const (
 	DefaultLocalPathProvisionerImage      = "rancher/local-path-provisioner:v0.0.31"
 	DefaultGCPercent                      = 30
 	DefaultContextTimeout                 = 15 * time.Second
+	DefaultCommandTimeout                 = 5 * time.Minute
 	DefaultMemoryLimit                    = 75 * 1024 * 1024
 	DefaultComponentSleep                 = 5 * time.Second
 	DefaultRetryCount                     = 12
+	DefaultCertRenewalInterval            = 12 * time.Hour
+	DefaultAddressChangeDebounce          = 5 * time.Second
+	DefaultAddressPollInterval            = 30 * time.Second
+	DefaultEndpointsReconcileInterval     = time.Minute
+	DefaultEndpointsRetryDelay            = 2 * time.Second
+	DefaultServingCertificateTimeout      = 2 * time.Minute
+	DefaultAPIServerPort                  = 6443
+	DefaultServiceAccountKeyGracePeriod   = 7 * 24 * time.Hour
 )
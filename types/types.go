@@ -8,14 +8,21 @@ type CertificatePaths struct {
 }
 
 // CACertificatePaths defines paths for CA certificates
+// Chain holds the certificates above an operator-supplied CA up to the root, it only exists for such a CA
+// Bundle is the CA certificate followed by the chain, it is handed to clients that verify the cluster servers
 type CACertificatePaths struct {
-	Cert string
-	Key  string
+	Cert   string
+	Key    string
+	Chain  string
+	Bundle string
 }
 
 // KubeletCertificatePaths defines paths for kubelet certificates
+// Cert and Key are the client certificate, ServingCert and ServingKey the serving certificate used until the kubelet has its own
 type KubeletCertificatePaths struct {
 	CertificatePaths
+	ServingCert string
+	ServingKey  string
 }
 
 // APIServerCertificatePaths defines paths for API server certificates
@@ -38,6 +45,11 @@ type WebhookCertificatePaths struct {
 	CertificatePaths
 }
 
+// FrontProxyCertificatePaths defines paths for the front-proxy client certificate the API server uses for aggregated APIs
+type FrontProxyCertificatePaths struct {
+	CertificatePaths
+}
+
 type Embedded struct {
 	// System paths (not managed by kubesolo)
 	SystemCNIDir string
@@ -50,9 +62,12 @@ type Embedded struct {
 	PKIControllerDir string
 	PKIKubeletDir    string
 	PKIWebhookDir    string
+	PKIFrontProxyDir string
 
 	// Admin kubeconfig file
 	AdminKubeconfigFile string
+	// Kubeconfig file for the in-process components, it references the admin certificate files
+	ComponentKubeconfigFile string
 
 	// Certificate paths
 	KubeletCerts           KubeletCertificatePaths
@@ -61,6 +76,8 @@ type Embedded struct {
 	AdminCerts             AdminCertificatePaths
 	WebhookCerts           WebhookCertificatePaths
 	CACerts                CACertificatePaths
+	FrontProxyCACerts      CACertificatePaths
+	FrontProxyClientCerts  FrontProxyCertificatePaths
 
 	// Containerd directories and files
 	ContainerdDir            string
@@ -88,8 +105,14 @@ type Embedded struct {
 	KubeletPluginsDir     string
 
 	// API Server directory
-	APIServerDir          string
-	ServiceAccountKeyFile string
+	APIServerDir                string
+	ServiceAccountKeyFile       string
+	ServiceAccountPublicKeyFile string
+	EncryptionConfigFile        string
+
+	// Audit log, the seal key is kept with the other keys
+	AuditLogFile     string
+	AuditSealKeyFile string
 
 	// Kine directories and files
 	KineDir        string